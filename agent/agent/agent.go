@@ -3,10 +3,16 @@
 package agent
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"sync"
+	"time"
 
-	"github.com/parakeet-nest/parakeet/completion"
+	"github.com/codefromthecrypt/practical-genai-go/metrics"
+	"github.com/codefromthecrypt/practical-genai-go/telemetry"
+	"github.com/codefromthecrypt/practical-genai-go/usage"
 	"github.com/parakeet-nest/parakeet/llm"
 )
 
@@ -14,17 +20,38 @@ import (
 // problem. Technically, the LLM response requests to invoke tools, but it is
 // the agent that actually does it. In other words, there is no RPC connection
 // to the LLM.
+//
+// An Agent is safe for concurrent use, though requests are handled one at a
+// time as each continues the same conversation. Use SessionManager for
+// independent conversations.
 type Agent struct {
+	// mu guards the conversation, and is held for the duration of a request.
+	mu sync.Mutex
 	// ollamaURL is the endpoint of Ollama. This isn't yet ported to OpenAI, so only works with Ollama.
 	ollamaURL string
 	// q includes the message history, which is naively managed. It is never
 	// summarized or truncated.
 	q *llm.Query
+	// created is when the conversation started, and times are when each
+	// message in q.Messages was added. These are only used for transcripts.
+	created time.Time
+	times   []time.Time
 	// goFuncs are the allowed functions that the LLM can request us to invoke.
 	goFuncs map[string]struct {
 		fn         reflect.Value
 		paramNames []string
 	}
+	// toolboxes are the toolboxes that handle tools not in goFuncs.
+	toolboxes map[string]Toolbox
+	// ownToolboxes are Config.Toolboxes, closed by Close.
+	ownToolboxes []Toolbox
+	// chat and tool are the LLM and tool calls, wrapped with any middleware.
+	chat ChatHandler
+	tool ToolHandler
+	// usage is the total of all requests. It has its own lock, so it can be
+	// read during a request.
+	usageMu sync.Mutex
+	usage   usage.Usage
 }
 
 type Config struct {
@@ -39,60 +66,351 @@ type Config struct {
 	// the Go function representing the tool. All functions must be defined in
 	// ToolSource and return string and an error  result.
 	Tools map[string]reflect.Value
+	// Toolboxes provide tools in addition to Tools, such as MCP servers or
+	// those defined with NewTool. Each tool name must be unique across Tools
+	// and Toolboxes.
+	Toolboxes []Toolbox
+	// ToolMiddleware wraps each tool call, the first being outermost. For
+	// example, LogTools or TruncateOutput.
+	ToolMiddleware []ToolMiddleware
+	// ChatMiddleware wraps each LLM call, the first being outermost. For
+	// example, LogChat or TimeChat.
+	ChatMiddleware []ChatMiddleware
+	// Options tune the model, such as temperature and context length. Tool
+	// calling is more reliable at a low temperature, and with a context
+	// length (NumCtx) large enough for tool results. Use Deterministic for
+	// repeatable answers, such as in tests.
+	Options llm.Options
+	// Retry retries LLM calls which fail with a transient error, such as a
+	// connection reset. By default, they aren't retried.
+	Retry RetryPolicy
+	// Fallbacks are tried in order when an LLM call still fails after any
+	// retries, or the model is unavailable. For example, a smaller model on
+	// the same Ollama. Other errors, such as a bad request, don't fall back.
+	Fallbacks []Endpoint
+	// ToolProtocol is how the LLM is asked to call tools. By default, it is
+	// decided by whether each model, including Fallbacks, supports tools.
+	ToolProtocol ToolProtocol
+}
+
+// DeterministicSeed is the seed set by Deterministic.
+const DeterministicSeed = 42
+
+// Deterministic returns the options with a temperature of zero and a fixed
+// seed, so that the same model gives the same answers to the same
+// conversation. Other options, such as NumCtx, are kept.
+//
+// TopK is also set to 1, which always picks the most likely token. This keeps
+// answers repeatable even if a zero temperature is omitted when encoding,
+// leaving the model's default.
+func Deterministic(options llm.Options) llm.Options {
+	options.Temperature = 0
+	options.TopK = 1
+	options.Seed = DeterministicSeed
+	return options
+}
+
+// RequestOptions change how the agent handles one request.
+type RequestOptions struct {
+	// Options replace Config.Options for this request, when not nil. Start
+	// from Agent.Options to change only some.
+	Options *llm.Options
+	// Budget limits the tokens, time and tool calls of this request, when
+	// not nil.
+	Budget *Budget
+}
+
+// Result is the outcome of a request.
+type Result struct {
+	// Content is the final answer of the LLM.
+	Content string
+	// Usage is the tokens and time spent on the request.
+	Usage usage.Usage
 }
 
 // New creates a new agent that will use Ollama with a specific model for
 // requests (Agent.Request).
 func New(url, model string, config *Config) (*Agent, error) {
+	now := time.Now()
 	a := &Agent{
 		ollamaURL: url,
 		q: &llm.Query{
 			Model:    model,
 			Messages: []llm.Message{{Role: "system", Content: config.SystemPrompt}},
+			Options:  config.Options,
 		},
+		created: now,
+		times:   []time.Time{now},
 		goFuncs: map[string]struct {
 			fn         reflect.Value
 			paramNames []string
 		}{},
+		toolboxes:    map[string]Toolbox{},
+		ownToolboxes: config.Toolboxes,
 	}
-	return a, a.parseFunctions(config)
+	switch config.ToolProtocol {
+	case ToolProtocolAuto, ToolProtocolNative, ToolProtocolReAct:
+	default:
+		return nil, fmt.Errorf("unsupported tool protocol: %s", config.ToolProtocol)
+	}
+	endpoints := []Endpoint{{URL: url, Model: model}}
+	for _, e := range config.Fallbacks {
+		if e.URL == "" {
+			e.URL = url
+		}
+		if e.Model == "" {
+			e.Model = model
+		}
+		endpoints = append(endpoints, e)
+	}
+	// Each endpoint decides its own tool protocol, as a fallback model may
+	// not support tools when the primary does.
+	chats := map[Endpoint]ChatHandler{}
+	for _, e := range endpoints {
+		chats[e] = toolProtocolChat(e.URL, e.Model, config.ToolProtocol, func(ctx context.Context, q llm.Query) (llm.Answer, error) {
+			return telemetry.Chat(ctx, e.URL, q)
+		})
+	}
+	a.chat = chainChat(func(ctx context.Context, q llm.Query) (llm.Answer, error) {
+		return chatWithRetry(ctx, q, endpoints, config.Retry, func(ctx context.Context, e Endpoint, q llm.Query) (llm.Answer, error) {
+			return chats[e](ctx, q)
+		})
+	}, config.ChatMiddleware)
+	tool := chainTools(a.callTool, config.ToolMiddleware)
+	a.tool = func(ctx context.Context, toolCall llm.FunctionTool) (string, error) {
+		ctx, span := telemetry.StartTool(ctx, toolCall.Name)
+		start := time.Now()
+		result, err := tool(ctx, toolCall)
+		metrics.ObserveTool(toolCall.Name, time.Since(start), err)
+		telemetry.End(span, err)
+		return result, err
+	}
+	if err := a.parseFunctions(config); err != nil {
+		return a, err
+	}
+	return a, a.addToolboxes(context.Background(), config.Toolboxes)
 }
 
 // Request a task for the agent to perform. The result will only use tools if
 // the LLM determines it necessary. For example, if the message asks a question
 // that can be answered without side effects, it won't likely use tools.
 func (a *Agent) Request(message string) (string, error) {
-	a.q.Messages = append(a.q.Messages, llm.Message{Role: "user", Content: message})
+	return a.RequestContext(context.Background(), message)
+}
+
+// RequestContext is like Request, except it gives up between LLM calls when
+// the context is done. For example, when an HTTP client disconnects.
+func (a *Agent) RequestContext(ctx context.Context, message string) (string, error) {
+	result, err := a.Do(ctx, message, nil)
+	if err != nil {
+		return "", err
+	}
+	return result.Content, nil
+}
+
+// Options returns the model options from Config.Options.
+func (a *Agent) Options() llm.Options {
+	return a.q.Options
+}
+
+// Do is like RequestContext, except opts can change how this request is
+// handled, such as the model options or a budget. When the budget is
+// exceeded, Do returns a partial Result and a *BudgetExceededError.
+//
+// If the request fails before any tool ran, it is removed from the
+// conversation. Otherwise, an assistant message says why it stopped, so that
+// the next request continues from a complete turn.
+func (a *Agent) Do(ctx context.Context, message string, opts *RequestOptions) (result *Result, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Deferred before the usage below, so that it runs after, and errors
+	// include the usage.
+	before := len(a.q.Messages)
+	defer func() {
+		switch {
+		case err == nil:
+		case len(a.q.Messages) == before+1:
+			a.q.Messages, a.times = a.q.Messages[:before], a.times[:before]
+		case a.q.Messages[len(a.q.Messages)-1].Role != "assistant":
+			a.addMessages(llm.Message{Role: "assistant", Content: fmt.Sprintf("[stopped: %v]", err)})
+		}
+	}()
+
+	// Trace the request, so that its LLM and tool calls are grouped.
+	ctx, span := telemetry.StartAgent(ctx, a.q.Model)
+	defer func() { telemetry.End(span, err) }()
+
+	// Account for the request, even if it fails, in the session's usage.
+	var u usage.Usage
+	start := time.Now()
+	defer func() {
+		u.Duration = time.Since(start)
+		if result != nil {
+			result.Usage = u
+		}
+		var budgetErr *BudgetExceededError
+		if errors.As(err, &budgetErr) {
+			budgetErr.Usage = u
+		}
+		a.usageMu.Lock()
+		a.usage.Add(u)
+		a.usageMu.Unlock()
+	}()
+
+	var budget *Budget
+	if opts != nil {
+		budget = opts.Budget
+	}
+	// The duration limit interrupts calls in progress, so keep the parent
+	// context to tell if it was the budget that stopped the request.
+	parent := ctx
+	if budget != nil && budget.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, start.Add(budget.MaxDuration))
+		defer cancel()
+	}
+	// stopped returns a partial result if err is because the request ran out
+	// of time, and the original error otherwise.
+	var content string
+	stopped := func(err error) (*Result, error) {
+		if ctx.Err() != nil && parent.Err() == nil {
+			return &Result{Content: content}, &BudgetExceededError{Limit: LimitDuration}
+		}
+		return nil, err
+	}
+
+	a.addMessages(llm.Message{Role: "user", Content: message})
+
+	// chat sends the conversation so far, with any options for this request.
+	chat := func() (llm.Answer, error) {
+		q := *a.q
+		if opts != nil && opts.Options != nil {
+			q.Options = *opts.Options
+		}
+		chatStart := time.Now()
+		answer, err := a.chat(ctx, q)
+		u.AddAnswer(answer, time.Since(chatStart))
+		return answer, err
+	}
 
 	// Ask the agent to solve our request goal
-	answer, err := completion.Chat(a.ollamaURL, *a.q)
+	answer, err := chat()
 	if err != nil {
-		return "", fmt.Errorf("failed to get chat response: %w", err)
+		return stopped(fmt.Errorf("failed to get chat response: %w", err))
 	}
 
 	// Loop until the agent is done asking to invoke tools. When certain LLMs
 	// hallucinate, they accidentally write tools into Message.Content, instead
 	// of Message.ToolCalls. Handling this is tricky in real Agent frameworks.
 	// Tool hallucination happens, but is less frequent in large models.
+	warned := false
 	for len(answer.Message.ToolCalls) == 1 {
 		toolCall := answer.Message.ToolCalls[0]
+		content = answer.Message.Content
+
+		// Refuse the tool call when out of budget, instead of leaving it
+		// unanswered, so the conversation can continue in a later request.
+		if limit, ok := budget.exceeded(u, time.Since(start)); ok {
+			a.addMessages(
+				answer.Message,
+				llm.Message{Role: "tool", Content: fmt.Sprintf("not run: the %s budget of this request was exceeded", limit)},
+			)
+			return &Result{Content: content}, &BudgetExceededError{Limit: limit}
+		}
 
 		// A tool call may fail, but the assistant may still be able to resolve
 		// it. That's why we don't handle errors like usual.
-		result := a.callFunction(toolCall.Function)
+		toolStart := time.Now()
+		toolResult, toolErr := a.tool(ctx, toolCall.Function)
+		u.AddTool(time.Since(toolStart), toolErr)
 
-		a.q.Messages = append(a.q.Messages,
+		a.addMessages(
 			answer.Message,
-			llm.Message{Role: "tool", Content: fmt.Sprintf("%v", result)},
+			llm.Message{Role: "tool", Content: fmt.Sprintf("%v", encodeResult(toolResult, toolErr))},
 		)
 
-		if answer, err = completion.Chat(a.ollamaURL, *a.q); err != nil {
-			return "", fmt.Errorf("failed to get chat response after tool call: %w", err)
+		// The tool result is kept even if we stop, as it may have had side
+		// effects the LLM should know about in the next request.
+		if err = ctx.Err(); err != nil {
+			return stopped(fmt.Errorf("request canceled after tool call: %w", err))
+		}
+
+		// Tell the LLM once when it is close to the budget, so it can answer
+		// before being stopped.
+		if warning := budget.warning(u, time.Since(start)); warning != "" && !warned {
+			a.addMessages(llm.Message{Role: "system", Content: warning})
+			warned = true
+		}
+
+		if answer, err = chat(); err != nil {
+			return stopped(fmt.Errorf("failed to get chat response after tool call: %w", err))
+		}
+	}
+
+	a.addMessages(answer.Message)
+	// Token usage is only known after the call, so the answer may overshoot.
+	if budget != nil && budget.MaxTokens > 0 && u.TotalTokens() > budget.MaxTokens {
+		return &Result{Content: answer.Message.Content}, &BudgetExceededError{Limit: LimitTokens}
+	}
+	return &Result{Content: answer.Message.Content}, nil
+}
+
+// Usage returns the total usage of all requests so far, including any before
+// the session was resumed.
+func (a *Agent) Usage() usage.Usage {
+	a.usageMu.Lock()
+	defer a.usageMu.Unlock()
+	return a.usage
+}
+
+// Undo removes the last request from the conversation, along with the tool
+// calls and answer that followed it, and returns its message. It returns false
+// when there is no request to remove. Changes made by tools, such as to files,
+// aren't undone, nor is the usage of the request.
+func (a *Agent) Undo() (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i := len(a.q.Messages) - 1; i >= 0; i-- {
+		if m := a.q.Messages[i]; m.Role == "user" {
+			a.q.Messages = a.q.Messages[:i]
+			a.times = a.times[:i]
+			return m.Content, true
 		}
 	}
+	return "", false
+}
+
+// Replay adds user and assistant messages of an earlier conversation, such as
+// those a client resends to a new session, so that the next request continues
+// it. Other messages are ignored. It returns false, without adding anything,
+// if the agent has already handled a request.
+func (a *Agent) Replay(messages ...llm.Message) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, m := range a.q.Messages {
+		if m.Role != "system" {
+			return false
+		}
+	}
+	for _, m := range messages {
+		if m.Role == "user" || m.Role == "assistant" {
+			a.addMessages(llm.Message{Role: m.Role, Content: m.Content})
+		}
+	}
+	return true
+}
 
-	a.q.Messages = append(a.q.Messages, answer.Message)
-	return answer.Message.Content, nil
+// addMessages appends to the conversation, recording when for transcripts.
+// The caller must hold a.mu.
+func (a *Agent) addMessages(messages ...llm.Message) {
+	now := time.Now()
+	for range messages {
+		a.times = append(a.times, now)
+	}
+	a.q.Messages = append(a.q.Messages, messages...)
 }
 
 // callFunction invokes the tool call, taking care to order parameters
@@ -101,9 +419,14 @@ func (a *Agent) Request(message string) (string, error) {
 // LLMs can understand problems, and attempt to resolve them. Hence, we encode
 // the error into a string instead of returning two values.
 func (a *Agent) callFunction(toolCall llm.FunctionTool) string {
+	return encodeResult(a.invokeFunction(toolCall))
+}
+
+// invokeFunction is like callFunction, except it returns any error.
+func (a *Agent) invokeFunction(toolCall llm.FunctionTool) (string, error) {
 	fn, ok := a.goFuncs[toolCall.Name]
 	if !ok {
-		return toolCall.Name + " is not a registered tool"
+		return "", callError(toolCall.Name + " is not a registered tool")
 	}
 
 	// Get the type of the function
@@ -118,7 +441,7 @@ func (a *Agent) callFunction(toolCall llm.FunctionTool) string {
 		if value, ok := toolCall.Arguments[paramName]; ok {
 			args[i] = reflect.ValueOf(value)
 		} else {
-			return fmt.Sprintf("Missing parameter: %s", paramName)
+			return "", callError(fmt.Sprintf("Missing parameter: %s", paramName))
 		}
 	}
 
@@ -127,7 +450,7 @@ func (a *Agent) callFunction(toolCall llm.FunctionTool) string {
 
 	// Extract and handle the results
 	if len(results) != 2 {
-		return fmt.Sprintf("unexpected number of results")
+		return "", callError("unexpected number of results")
 	}
 
 	// Extract the success message
@@ -136,6 +459,26 @@ func (a *Agent) callFunction(toolCall llm.FunctionTool) string {
 	// Extract the error
 	if !results[1].IsNil() {
 		err, _ := results[1].Interface().(error)
+		return result, err
+	}
+	return result, nil
+}
+
+// callError is a problem calling a tool, as opposed to an error returned by
+// the tool itself. Its message is given to the LLM as-is.
+type callError string
+
+func (e callError) Error() string {
+	return string(e)
+}
+
+// encodeResult formats the result of a tool call for the LLM, including any
+// error.
+func encodeResult(result string, err error) string {
+	var ce callError
+	if errors.As(err, &ce) {
+		return string(ce)
+	} else if err != nil {
 		return fmt.Sprintf("%v\n\nError:\n%v", result, err)
 	}
 	return result
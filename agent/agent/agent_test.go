@@ -1,10 +1,17 @@
 package agent
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sync"
 	"testing"
 
+	"github.com/codefromthecrypt/practical-genai-go/llmtest"
 	"github.com/parakeet-nest/parakeet/llm"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -93,3 +100,146 @@ func TestCallFunction(t *testing.T) {
 		require.Equal(t, "shell2 is not a registered tool", result)
 	})
 }
+
+func TestRequest(t *testing.T) {
+	ollama := llmtest.NewServer(t,
+		llmtest.ToolCall("shell", map[string]any{"command": "echo Hello, World!"}),
+		llmtest.ToolCall("patch_file", map[string]any{"path": "README.md", "before": "hello", "after": "hello world"}),
+		llmtest.Text("I patched README.md."),
+	)
+
+	agent, err := New(ollama.URL, "test-model", testConfig)
+	require.NoError(t, err)
+
+	reply, err := agent.Request("Patch README.md with the output of echo")
+	require.NoError(t, err)
+	require.Equal(t, "I patched README.md.", reply)
+
+	// Each LLM call includes the results of the tools before it.
+	requests := ollama.Requests()
+	require.Len(t, requests, 3)
+	require.Equal(t, []string{"shell", "patch_file"}, requests[0].Tools)
+	last := requests[2].Messages
+	require.Equal(t, llm.Message{Role: "tool", Content: "hello world"}, last[3])
+	require.Equal(t, llm.Message{Role: "tool", Content: "Successfully replaced before with after."}, last[5])
+
+	t.Run("continues the conversation", func(t *testing.T) {
+		ollama.Script(llmtest.Text("You're welcome."))
+		reply, err := agent.Request("Thanks!")
+		require.NoError(t, err)
+		require.Equal(t, "You're welcome.", reply)
+
+		requests := ollama.Requests()
+		require.Len(t, requests[3].Messages, 1+6+1)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ollama.Script(llmtest.Error(http.StatusBadRequest))
+		_, err := agent.Request("hello")
+		require.EqualError(t, err, "failed to get chat response: status code: 400")
+	})
+}
+
+func TestUndo(t *testing.T) {
+	ollama := llmtest.NewServer(t,
+		llmtest.Text("Hello!"),
+		llmtest.ToolCall("shell", map[string]any{"command": "echo hello"}),
+		llmtest.Text("It printed hello."),
+	)
+
+	agent, err := New(ollama.URL, "test-model", testConfig)
+	require.NoError(t, err)
+
+	_, ok := agent.Undo()
+	require.False(t, ok)
+
+	_, err = agent.Request("Hi")
+	require.NoError(t, err)
+	_, err = agent.Request("What does echo hello print?")
+	require.NoError(t, err)
+	require.Len(t, agent.q.Messages, 1+2+4)
+
+	// The request, tool call, its result and the answer are removed.
+	request, ok := agent.Undo()
+	require.True(t, ok)
+	require.Equal(t, "What does echo hello print?", request)
+	require.Equal(t, []llm.Message{
+		{Role: "system", Content: testConfig.SystemPrompt},
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Hello!"},
+	}, agent.q.Messages)
+	require.Len(t, agent.Transcript().Messages, 3)
+}
+
+func TestRequest_concurrent(t *testing.T) {
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"model":"test-model","message":{"role":"assistant","content":"hello"},"done":true}`))
+	}))
+	defer ollama.Close()
+
+	agent, err := New(ollama.URL, "test-model", testConfig)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reply, err := agent.Request("hello")
+			assert.NoError(t, err)
+			assert.Equal(t, "hello", reply)
+		}()
+	}
+	wg.Wait()
+
+	// Each request adds a user message followed by the assistant's reply.
+	messages := agent.Transcript().Messages
+	require.Len(t, messages, 1+2*10)
+	for i := 1; i < len(messages); i += 2 {
+		require.Equal(t, "user", messages[i].Role)
+		require.Equal(t, "assistant", messages[i+1].Role)
+	}
+}
+
+// ollamaChat serves h on Ollama's chat endpoint only, so that other requests,
+// such as checking if the model supports tools, don't use its responses.
+func ollamaChat(h http.HandlerFunc) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("POST /api/chat", h)
+	return mux
+}
+
+func TestDo_options(t *testing.T) {
+	var options []llm.Options
+	ollama := httptest.NewServer(ollamaChat(func(w http.ResponseWriter, r *http.Request) {
+		var q llm.Query
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&q))
+		options = append(options, q.Options)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"model":"test-model","message":{"role":"assistant","content":"hello"},"done":true}`))
+	}))
+	defer ollama.Close()
+
+	config := *testConfig
+	config.Options = Deterministic(llm.Options{NumCtx: 8192})
+	agent, err := New(ollama.URL, "test-model", &config)
+	require.NoError(t, err)
+	require.Equal(t, llm.Options{Temperature: 0, TopK: 1, Seed: DeterministicSeed, NumCtx: 8192}, agent.Options())
+
+	_, err = agent.Request("hello")
+	require.NoError(t, err)
+
+	override := agent.Options()
+	override.Temperature = 0.7
+	override.Stop = []string{"\n"}
+	result, err := agent.Do(context.Background(), "hello", &RequestOptions{Options: &override})
+	require.NoError(t, err)
+	require.Equal(t, "hello", result.Content)
+
+	// The override only applies to its request.
+	_, err = agent.Do(context.Background(), "hello", &RequestOptions{})
+	require.NoError(t, err)
+
+	require.Equal(t, []llm.Options{config.Options, override, config.Options}, options)
+}
@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/codefromthecrypt/practical-genai-go/usage"
+)
+
+// Budget limits the resources one request can use. Zero fields are
+// unlimited.
+type Budget struct {
+	// MaxTokens limits the prompt and completion tokens of all LLM calls.
+	// Usage is only known after each call, so the last one can overshoot it,
+	// in which case its answer is returned with a *BudgetExceededError.
+	MaxTokens int
+	// MaxDuration limits the wall time of the request, interrupting any tool
+	// call in progress. An LLM call in progress finishes first, as Parakeet
+	// can't cancel it.
+	MaxDuration time.Duration
+	// MaxToolCalls limits the tools run. Further tool calls are refused.
+	MaxToolCalls int
+	// WarnAt is the fraction of any limit at which the LLM is told to finish
+	// up. Defaults to 0.8.
+	WarnAt float64
+}
+
+// Limit is a resource limited by a Budget.
+type Limit string
+
+const (
+	LimitTokens    Limit = "tokens"
+	LimitDuration  Limit = "duration"
+	LimitToolCalls Limit = "tool calls"
+)
+
+// BudgetExceededError is returned by Agent.Do with a partial Result when a
+// request stops because of its Budget.
+type BudgetExceededError struct {
+	// Limit is the one that stopped the request.
+	Limit Limit
+	// Usage is what the request used before it stopped.
+	Usage usage.Usage
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("%s budget exceeded: %s", e.Limit, e.Usage)
+}
+
+// exceeded returns the first limit reached by u, if any.
+func (b *Budget) exceeded(u usage.Usage, elapsed time.Duration) (Limit, bool) {
+	switch {
+	case b == nil:
+		return "", false
+	case b.MaxTokens > 0 && u.TotalTokens() >= b.MaxTokens:
+		return LimitTokens, true
+	case b.MaxDuration > 0 && elapsed >= b.MaxDuration:
+		return LimitDuration, true
+	case b.MaxToolCalls > 0 && u.ToolCalls >= b.MaxToolCalls:
+		return LimitToolCalls, true
+	}
+	return "", false
+}
+
+// warning returns a message for the LLM when u is close to a limit, or
+// empty if not.
+func (b *Budget) warning(u usage.Usage, elapsed time.Duration) string {
+	if b == nil {
+		return ""
+	}
+	warnAt := b.WarnAt
+	if warnAt <= 0 {
+		warnAt = 0.8
+	}
+	var near []string
+	if b.MaxTokens > 0 && float64(u.TotalTokens()) >= warnAt*float64(b.MaxTokens) {
+		near = append(near, fmt.Sprintf("%d of %d tokens", u.TotalTokens(), b.MaxTokens))
+	}
+	if b.MaxDuration > 0 && float64(elapsed) >= warnAt*float64(b.MaxDuration) {
+		near = append(near, fmt.Sprintf("%s of %s", elapsed.Round(time.Second), b.MaxDuration))
+	}
+	if b.MaxToolCalls > 0 && float64(u.ToolCalls) >= warnAt*float64(b.MaxToolCalls) {
+		near = append(near, fmt.Sprintf("%d of %d tool calls", u.ToolCalls, b.MaxToolCalls))
+	}
+	if len(near) == 0 {
+		return ""
+	}
+	return "You are close to the budget for this request, having used " +
+		strings.Join(near, ", ") + ". Only call a tool if it is essential, " +
+		"then give your final answer."
+}
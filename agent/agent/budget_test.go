@@ -0,0 +1,163 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codefromthecrypt/practical-genai-go/llmtest"
+	"github.com/codefromthecrypt/practical-genai-go/usage"
+	"github.com/parakeet-nest/parakeet/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loopingOllama always asks for the echo tool, using 100 tokens each call,
+// and records the messages it was sent.
+func loopingOllama(t *testing.T, delay time.Duration) (*httptest.Server, *[][]llm.Message) {
+	var requests [][]llm.Message
+	ollama := httptest.NewServer(ollamaChat(func(w http.ResponseWriter, r *http.Request) {
+		var q llm.Query
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&q))
+		requests = append(requests, q.Messages)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":{"role":"assistant","content":"Let me check.",` +
+			`"tool_calls":[{"function":{"name":"echo","arguments":{"text":"hi"}}}]},` +
+			`"done":true,"prompt_eval_count":90,"eval_count":10}`))
+	}))
+	t.Cleanup(ollama.Close)
+	return ollama, &requests
+}
+
+func TestDo_budget(t *testing.T) {
+	tests := []struct {
+		name      string
+		budget    Budget
+		delay     time.Duration
+		limit     Limit
+		toolCalls int
+	}{
+		{name: "tool calls", budget: Budget{MaxToolCalls: 2}, limit: LimitToolCalls, toolCalls: 2},
+		{name: "tokens", budget: Budget{MaxTokens: 250}, limit: LimitTokens, toolCalls: 2},
+		{name: "duration", budget: Budget{MaxDuration: 100 * time.Millisecond}, delay: 40 * time.Millisecond, limit: LimitDuration, toolCalls: 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ollama, _ := loopingOllama(t, tc.delay)
+			config := *testConfig
+			config.Toolboxes = []Toolbox{echoToolbox{}}
+			agent, err := New(ollama.URL, "test-model", &config)
+			require.NoError(t, err)
+
+			result, err := agent.Do(context.Background(), "Echo hi forever", &RequestOptions{Budget: &tc.budget})
+			var budgetErr *BudgetExceededError
+			require.True(t, errors.As(err, &budgetErr), "unexpected error: %v", err)
+			require.Equal(t, tc.limit, budgetErr.Limit)
+			require.Equal(t, "Let me check.", result.Content)
+			require.Equal(t, result.Usage, budgetErr.Usage)
+			require.Equal(t, tc.toolCalls, result.Usage.ToolCalls)
+		})
+	}
+}
+
+func TestDo_budgetRefusesToolCall(t *testing.T) {
+	ollama, requests := loopingOllama(t, 0)
+	config := *testConfig
+	config.Toolboxes = []Toolbox{echoToolbox{}}
+	agent, err := New(ollama.URL, "test-model", &config)
+	require.NoError(t, err)
+
+	budget := &Budget{MaxToolCalls: 1}
+	_, err = agent.Do(context.Background(), "Echo hi forever", &RequestOptions{Budget: budget})
+	require.ErrorContains(t, err, "tool calls budget exceeded: 2 LLM calls in ")
+
+	// The LLM was warned before its last call, as it had used all tool calls.
+	last := (*requests)[len(*requests)-1]
+	require.Equal(t, llm.Message{Role: "system", Content: "You are close to the budget for this request, " +
+		"having used 1 of 1 tool calls. Only call a tool if it is essential, then give your final answer."},
+		last[len(last)-1])
+
+	// The refused tool call is answered, and the turn ends saying why, so the
+	// next request can continue.
+	messages := agent.Transcript().Messages
+	require.Equal(t, "not run: the tool calls budget of this request was exceeded", messages[len(messages)-2].Content)
+	require.Equal(t, "assistant", messages[len(messages)-1].Role)
+	require.True(t, strings.HasPrefix(messages[len(messages)-1].Content, "[stopped: tool calls budget exceeded: 2 LLM calls in "),
+		messages[len(messages)-1].Content)
+
+	// The next request has its own budget.
+	_, err = agent.Do(context.Background(), "Echo hi once", &RequestOptions{Budget: budget})
+	require.Error(t, err)
+	require.Equal(t, 2, agent.Usage().ToolCalls)
+}
+
+func TestDo_budgetFinalAnswer(t *testing.T) {
+	ollama := llmtest.NewServer(t, llmtest.Reply{Content: "A long answer.", PromptTokens: 90, CompletionTokens: 20})
+	agent, err := New(ollama.URL, "test-model", testConfig)
+	require.NoError(t, err)
+
+	result, err := agent.Do(context.Background(), "Answer at length", &RequestOptions{Budget: &Budget{MaxTokens: 100}})
+	var budgetErr *BudgetExceededError
+	require.True(t, errors.As(err, &budgetErr), "unexpected error: %v", err)
+	require.Equal(t, LimitTokens, budgetErr.Limit)
+	require.Equal(t, "A long answer.", result.Content)
+}
+
+func TestDo_rollsBackFailedRequest(t *testing.T) {
+	ollama := llmtest.NewServer(t, llmtest.Error(400))
+	agent, err := New(ollama.URL, "test-model", testConfig)
+	require.NoError(t, err)
+
+	_, err = agent.Do(context.Background(), "hello", nil)
+	require.Error(t, err)
+
+	// Only the system prompt is left, so the next request isn't after an
+	// unanswered one.
+	messages := agent.Transcript().Messages
+	require.Len(t, messages, 1)
+	require.Equal(t, "system", messages[0].Role)
+}
+
+func TestBudget_warning(t *testing.T) {
+	tests := []struct {
+		name     string
+		budget   *Budget
+		usage    usage.Usage
+		elapsed  time.Duration
+		expected string
+	}{
+		{name: "nil"},
+		{name: "unlimited", budget: &Budget{}, usage: usage.Usage{PromptTokens: 1000, ToolCalls: 10}},
+		{name: "below", budget: &Budget{MaxTokens: 1000}, usage: usage.Usage{PromptTokens: 700}},
+		{
+			name:     "default",
+			budget:   &Budget{MaxTokens: 1000, MaxDuration: time.Minute},
+			usage:    usage.Usage{PromptTokens: 800},
+			elapsed:  50 * time.Second,
+			expected: "You are close to the budget for this request, having used 800 of 1000 tokens, 50s of 1m0s. Only call a tool if it is essential, then give your final answer.",
+		},
+		{
+			name:     "WarnAt",
+			budget:   &Budget{MaxToolCalls: 10, WarnAt: 0.5},
+			usage:    usage.Usage{ToolCalls: 5},
+			expected: "You are close to the budget for this request, having used 5 of 10 tool calls. Only call a tool if it is essential, then give your final answer.",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, tc.budget.warning(tc.usage, tc.elapsed))
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// ToolHandler invokes a tool the LLM requested. The result and error are
+// encoded for the LLM after all middleware has run.
+type ToolHandler func(ctx context.Context, toolCall llm.FunctionTool) (string, error)
+
+// ToolMiddleware wraps tool calls, for example to log or rewrite results.
+// It must call next to invoke the tool, unless it decides not to.
+type ToolMiddleware func(next ToolHandler) ToolHandler
+
+// ChatHandler sends the conversation to the LLM and returns its answer.
+type ChatHandler func(ctx context.Context, q llm.Query) (llm.Answer, error)
+
+// ChatMiddleware wraps LLM calls, for example to log or time them.
+type ChatMiddleware func(next ChatHandler) ChatHandler
+
+// chainTools wraps h with middleware, so that the first is outermost.
+func chainTools(h ToolHandler, middleware []ToolMiddleware) ToolHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// chainChat wraps h with middleware, so that the first is outermost.
+func chainChat(h ChatHandler, middleware []ChatMiddleware) ChatHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// LogTools logs each tool call, its duration and any error.
+func LogTools(logger *slog.Logger) ToolMiddleware {
+	return func(next ToolHandler) ToolHandler {
+		return func(ctx context.Context, toolCall llm.FunctionTool) (string, error) {
+			start := time.Now()
+			result, err := next(ctx, toolCall)
+			attrs := []any{
+				slog.String("tool", toolCall.Name),
+				slog.Any("arguments", toolCall.Arguments),
+				slog.Duration("duration", time.Since(start)),
+				slog.Int("result_bytes", len(result)),
+			}
+			if err != nil {
+				logger.WarnContext(ctx, "tool call failed", append(attrs, slog.Any("error", err))...)
+			} else {
+				logger.InfoContext(ctx, "tool call", attrs...)
+			}
+			return result, err
+		}
+	}
+}
+
+// LogChat logs each LLM call, its duration and token counts.
+func LogChat(logger *slog.Logger) ChatMiddleware {
+	return func(next ChatHandler) ChatHandler {
+		return func(ctx context.Context, q llm.Query) (llm.Answer, error) {
+			start := time.Now()
+			answer, err := next(ctx, q)
+			attrs := []any{
+				slog.String("model", q.Model),
+				slog.Int("messages", len(q.Messages)),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if err != nil {
+				logger.WarnContext(ctx, "chat failed", append(attrs, slog.Any("error", err))...)
+				return answer, err
+			}
+			logger.InfoContext(ctx, "chat", append(attrs,
+				slog.Int("prompt_tokens", int(answer.PromptEvalCount)),
+				slog.Int("completion_tokens", int(answer.EvalCount)),
+				slog.Int("tool_calls", len(answer.Message.ToolCalls)),
+			)...)
+			return answer, nil
+		}
+	}
+}
+
+// TimeTools calls record with the duration of each tool call.
+func TimeTools(record func(tool string, d time.Duration, err error)) ToolMiddleware {
+	return func(next ToolHandler) ToolHandler {
+		return func(ctx context.Context, toolCall llm.FunctionTool) (string, error) {
+			start := time.Now()
+			result, err := next(ctx, toolCall)
+			record(toolCall.Name, time.Since(start), err)
+			return result, err
+		}
+	}
+}
+
+// TimeChat calls record with the duration of each LLM call.
+func TimeChat(record func(model string, d time.Duration, err error)) ChatMiddleware {
+	return func(next ChatHandler) ChatHandler {
+		return func(ctx context.Context, q llm.Query) (llm.Answer, error) {
+			start := time.Now()
+			answer, err := next(ctx, q)
+			record(q.Model, time.Since(start), err)
+			return answer, err
+		}
+	}
+}
+
+// TruncateOutput limits tool results to maxBytes, so that a large file or
+// command output doesn't fill the context window. The LLM is told how much
+// was removed, so it can ask for less. Zero or less is unlimited.
+func TruncateOutput(maxBytes int) ToolMiddleware {
+	return func(next ToolHandler) ToolHandler {
+		return func(ctx context.Context, toolCall llm.FunctionTool) (string, error) {
+			result, err := next(ctx, toolCall)
+			if maxBytes <= 0 || len(result) <= maxBytes {
+				return result, err
+			}
+			cut := maxBytes
+			for cut > 0 && !utf8.RuneStart(result[cut]) {
+				cut-- // don't split a multi-byte character
+			}
+			return fmt.Sprintf("%s\n[truncated %d bytes]", result[:cut], len(result)-cut), err
+		}
+	}
+}
+
+// Redactor masks secrets in text, returning the result and how many were
+// masked. *redact.Redactor is one.
+type Redactor interface {
+	Redact(text string) (string, int)
+}
+
+// RedactOutput masks secrets in tool results and errors with r, such as
+// redact.Default(), before the agent adds them to the conversation. It logs
+// how many secrets were masked, never the secrets.
+func RedactOutput(r Redactor) ToolMiddleware {
+	return func(next ToolHandler) ToolHandler {
+		return func(ctx context.Context, toolCall llm.FunctionTool) (string, error) {
+			result, err := next(ctx, toolCall)
+			result, count := r.Redact(result)
+			if err != nil {
+				msg, n := r.Redact(err.Error())
+				if count += n; n > 0 {
+					err = errors.New(msg)
+				}
+			}
+			if count > 0 {
+				log.Printf("Redacted %d secrets from %s", count, toolCall.Name)
+			}
+			return result, err
+		}
+	}
+}
+
+// NormalizeErrors makes tool failures consistent for the LLM: panics become
+// errors instead of crashing the agent, and cancellation is explained in
+// plain words.
+func NormalizeErrors() ToolMiddleware {
+	return func(next ToolHandler) ToolHandler {
+		return func(ctx context.Context, toolCall llm.FunctionTool) (result string, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					result, err = "", fmt.Errorf("%s panicked: %v", toolCall.Name, r)
+				}
+			}()
+			result, err = next(ctx, toolCall)
+			switch {
+			case errors.Is(err, context.DeadlineExceeded):
+				err = fmt.Errorf("%s timed out", toolCall.Name)
+			case errors.Is(err, context.Canceled):
+				err = fmt.Errorf("%s was canceled", toolCall.Name)
+			case err != nil:
+				// Trailing whitespace, often from command output, wastes tokens.
+				var ce callError
+				if !errors.As(err, &ce) {
+					err = errors.New(strings.TrimSpace(err.Error()))
+				}
+			}
+			return result, err
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parakeet-nest/parakeet/llm"
+	"github.com/stretchr/testify/require"
+)
+
+func handlerReturning(result string, err error) ToolHandler {
+	return func(context.Context, llm.FunctionTool) (string, error) {
+		return result, err
+	}
+}
+
+func TestChainTools(t *testing.T) {
+	var calls []string
+	trace := func(name string) ToolMiddleware {
+		return func(next ToolHandler) ToolHandler {
+			return func(ctx context.Context, toolCall llm.FunctionTool) (string, error) {
+				calls = append(calls, name)
+				return next(ctx, toolCall)
+			}
+		}
+	}
+
+	h := chainTools(handlerReturning("ok", nil), []ToolMiddleware{trace("first"), trace("second")})
+	result, err := h(context.Background(), llm.FunctionTool{Name: "shell"})
+	require.NoError(t, err)
+	require.Equal(t, "ok", result)
+	require.Equal(t, []string{"first", "second"}, calls)
+}
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	var timed []string
+	config := *testConfig
+	config.ToolMiddleware = []ToolMiddleware{
+		LogTools(slog.New(slog.NewTextHandler(&buf, nil))),
+		TimeTools(func(tool string, d time.Duration, err error) {
+			timed = append(timed, tool)
+		}),
+		TruncateOutput(5),
+	}
+	agent, err := New("http://localhost:8080", "test-model", &config)
+	require.NoError(t, err)
+
+	result, err := agent.CallTool(context.Background(), "shell", map[string]interface{}{"command": "ls"})
+	require.NoError(t, err)
+	require.Equal(t, "hello\n[truncated 6 bytes]", result)
+	require.Equal(t, []string{"shell"}, timed)
+	require.Contains(t, buf.String(), "msg=\"tool call\" tool=shell arguments=map[command:ls]")
+}
+
+func TestChatMiddleware(t *testing.T) {
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":{"role":"assistant","content":"hi"},"done":true,"prompt_eval_count":12,"eval_count":3}`))
+	}))
+	defer ollama.Close()
+
+	var buf bytes.Buffer
+	var timed []string
+	config := *testConfig
+	config.ChatMiddleware = []ChatMiddleware{
+		LogChat(slog.New(slog.NewTextHandler(&buf, nil))),
+		TimeChat(func(model string, d time.Duration, err error) {
+			timed = append(timed, model)
+		}),
+	}
+	agent, err := New(ollama.URL, "test-model", &config)
+	require.NoError(t, err)
+
+	_, err = agent.Request("hello")
+	require.NoError(t, err)
+	require.Equal(t, []string{"test-model"}, timed)
+	require.Contains(t, buf.String(), "msg=chat model=test-model messages=2")
+	require.Contains(t, buf.String(), "prompt_tokens=12 completion_tokens=3 tool_calls=0")
+}
+
+func TestTruncateOutput(t *testing.T) {
+	ctx := context.Background()
+
+	result, _ := TruncateOutput(10)(handlerReturning("short", nil))(ctx, llm.FunctionTool{})
+	require.Equal(t, "short", result)
+
+	t.Run("doesn't split characters", func(t *testing.T) {
+		result, _ := TruncateOutput(2)(handlerReturning("世界", nil))(ctx, llm.FunctionTool{})
+		require.Equal(t, "\n[truncated 6 bytes]", result)
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		for _, maxBytes := range []int{0, -1} {
+			result, _ := TruncateOutput(maxBytes)(handlerReturning("hello world", nil))(ctx, llm.FunctionTool{})
+			require.Equal(t, "hello world", result)
+		}
+	})
+}
+
+// replacer is a Redactor which masks fixed secrets.
+type replacer map[string]string
+
+func (r replacer) Redact(text string) (string, int) {
+	count := 0
+	for secret, mask := range r {
+		count += strings.Count(text, secret)
+		text = strings.ReplaceAll(text, secret, mask)
+	}
+	return text, count
+}
+
+func TestRedactOutput(t *testing.T) {
+	ctx := context.Background()
+	redactOutput := RedactOutput(replacer{"hunter2": "[REDACTED:password-1]"})
+
+	result, err := redactOutput(handlerReturning("PASSWORD=hunter2\nnothing to see here", nil))(ctx, llm.FunctionTool{})
+	require.NoError(t, err)
+	require.Equal(t, "PASSWORD=[REDACTED:password-1]\nnothing to see here", result)
+
+	t.Run("error", func(t *testing.T) {
+		_, err := redactOutput(handlerReturning("", errors.New("login hunter2 failed")))(ctx, llm.FunctionTool{})
+		require.EqualError(t, err, "login [REDACTED:password-1] failed")
+	})
+}
+
+func TestNormalizeErrors(t *testing.T) {
+	ctx := context.Background()
+	normalize := NormalizeErrors()
+
+	tests := []struct {
+		name     string
+		handler  ToolHandler
+		expected string
+	}{
+		{
+			name: "panic",
+			handler: func(context.Context, llm.FunctionTool) (string, error) {
+				panic("oops")
+			},
+			expected: "shell panicked: oops",
+		},
+		{
+			name:     "timeout",
+			handler:  handlerReturning("", context.DeadlineExceeded),
+			expected: "shell timed out",
+		},
+		{
+			name:     "canceled",
+			handler:  handlerReturning("", context.Canceled),
+			expected: "shell was canceled",
+		},
+		{
+			name:     "whitespace",
+			handler:  handlerReturning("", errors.New("exit status 1\n\n")),
+			expected: "exit status 1",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := normalize(tc.handler)(ctx, llm.FunctionTool{Name: "shell"})
+			require.EqualError(t, err, tc.expected)
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/codefromthecrypt/practical-genai-go/preflight"
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// ToolProtocol is how the LLM is asked to call tools.
+type ToolProtocol string
+
+const (
+	// ToolProtocolAuto uses ToolProtocolNative when Ollama reports the model
+	// supports tools, and ToolProtocolReAct otherwise. It is decided on the
+	// first LLM call.
+	ToolProtocolAuto ToolProtocol = ""
+	// ToolProtocolNative sends tool definitions in the request, and reads
+	// Message.ToolCalls from the answer.
+	ToolProtocolNative ToolProtocol = "native"
+	// ToolProtocolReAct describes tools in the system prompt, and parses
+	// Thought, Action and Action Input lines from the answer. Tool results
+	// are sent back as an Observation. This works with models whose chat
+	// template doesn't support tools, such as many small GGUF models.
+	ToolProtocolReAct ToolProtocol = "react"
+)
+
+var (
+	reactAction      = regexp.MustCompile(`(?m)^[ \t*]*Action[ \t*]*:[ \t*]*(.*?)[ \t*]*$`)
+	reactActionInput = regexp.MustCompile(`(?m)^[ \t*]*Action Input[ \t*]*:`)
+	reactFinalAnswer = regexp.MustCompile(`(?m)^[ \t*]*Final Answer[ \t*]*:`)
+)
+
+// reactObservation is the prefix of tool results. The model is stopped before
+// writing one itself, as small models often imagine the result.
+const reactObservation = "Observation:"
+
+// toolProtocolChat returns a ChatHandler which calls next with the protocol,
+// deciding it on the first call with tools when ToolProtocolAuto.
+func toolProtocolChat(url, model string, protocol ToolProtocol, next ChatHandler) ChatHandler {
+	var once sync.Once
+	return func(ctx context.Context, q llm.Query) (llm.Answer, error) {
+		if len(q.Tools) == 0 {
+			return next(ctx, q)
+		}
+		once.Do(func() {
+			if protocol != ToolProtocolAuto {
+				return
+			}
+			protocol = ToolProtocolNative
+			if !supportsTools(ctx, url, model) {
+				log.Printf("Using the ReAct tool protocol, as %s doesn't support tools", model)
+				protocol = ToolProtocolReAct
+			}
+		})
+		if protocol != ToolProtocolReAct {
+			return next(ctx, q)
+		}
+		return reactChat(ctx, q, next)
+	}
+}
+
+// supportsTools asks Ollama if the model supports tools. It returns true when
+// unknown, such as for versions of Ollama which don't report capabilities.
+func supportsTools(ctx context.Context, url, model string) bool {
+	info, err := preflight.Show(ctx, url, model)
+	if err != nil {
+		log.Printf("Failed to check if %s supports tools: %v", model, err)
+		return true
+	}
+	return info.Supports("tools")
+}
+
+// reactChat calls next with the conversation rewritten for the ReAct
+// protocol, and returns the answer with any action as a tool call. This means
+// the rest of the agent, including transcripts, sees native tool calls.
+func reactChat(ctx context.Context, q llm.Query, next ChatHandler) (llm.Answer, error) {
+	q.Messages = reactMessages(q.Messages, q.Tools)
+	q.Tools = nil
+	q.Options.Stop = append(slices.Clip(q.Options.Stop), reactObservation)
+	answer, err := next(ctx, q)
+	if err != nil {
+		return answer, err
+	}
+	answer.Message = parseReAct(answer.Message)
+	return answer, nil
+}
+
+// reactMessages returns a copy of messages, with the tools described in the
+// system prompt, tool calls written as actions and tool results as
+// observations.
+func reactMessages(messages []llm.Message, tools []llm.Tool) []llm.Message {
+	result := make([]llm.Message, 0, len(messages)+1)
+	if len(messages) == 0 || messages[0].Role != "system" {
+		result = append(result, llm.Message{Role: "system"})
+	}
+	result = append(result, messages...)
+	result[0].Content = strings.TrimSpace(result[0].Content + "\n\n" + reactPrompt(tools))
+
+	for i, m := range result {
+		switch {
+		case m.Role == "assistant" && len(m.ToolCalls) > 0:
+			result[i].Content = formatAction(m.Content, m.ToolCalls[0].Function)
+			result[i].ToolCalls = nil
+		case m.Role == "tool":
+			// Models without tool support often have no template for the
+			// tool role, so send the result as the user.
+			result[i].Role = "user"
+			result[i].Content = reactObservation + " " + m.Content
+		}
+	}
+	return result
+}
+
+// reactPrompt describes the tools and how to call them.
+func reactPrompt(tools []llm.Tool) string {
+	var b strings.Builder
+	b.WriteString("# Tools\n\nYou can call these tools, described in JSON:\n\n")
+	for _, tool := range tools {
+		function, _ := json.Marshal(tool.Function)
+		b.Write(function)
+		b.WriteString("\n")
+	}
+	b.WriteString(`
+To call a tool, reply with the following, then stop:
+
+Thought: why you need the tool
+Action: the tool name
+Action Input: the arguments as a JSON object
+
+You will be given the result as "Observation: <result>". Call one tool at a
+time. When you don't need any more tools, reply with:
+
+Thought: why you are done
+Final Answer: your answer to the user
+`)
+	return b.String()
+}
+
+// formatAction writes a tool call as the model would have, after its thought.
+func formatAction(thought string, toolCall llm.FunctionTool) string {
+	arguments, err := json.Marshal(toolCall.Arguments)
+	if err != nil || toolCall.Arguments == nil {
+		arguments = []byte("{}")
+	}
+	action := fmt.Sprintf("Action: %s\nAction Input: %s", toolCall.Name, arguments)
+	if thought == "" {
+		return action
+	}
+	return thought + "\n" + action
+}
+
+// parseReAct returns the message with any action as a tool call, and its
+// content the thought before it. Otherwise, the content is the final answer.
+func parseReAct(m llm.Message) llm.Message {
+	content := m.Content
+	// Ignore anything after an observation the model imagined.
+	if i := strings.Index(content, "\n"+reactObservation); i >= 0 {
+		content = content[:i]
+	}
+
+	action := reactAction.FindStringSubmatchIndex(content)
+	final := reactFinalAnswer.FindStringIndex(content)
+	if action == nil || (final != nil && final[0] < action[0]) {
+		if final != nil {
+			content = content[final[1]:]
+		}
+		m.Content = strings.TrimSpace(content)
+		return m
+	}
+
+	name := strings.Trim(content[action[2]:action[3]], "`'\"")
+	var arguments map[string]any
+	if input := reactActionInput.FindStringIndex(content[action[1]:]); input != nil {
+		arguments = parseActionInput(content[action[1]+input[1]:])
+	}
+	m.Content = strings.TrimSpace(content[:action[0]])
+	m.ToolCalls = []llm.ToolCall{{Function: llm.FunctionTool{Name: name, Arguments: arguments}}}
+	return m
+}
+
+// parseActionInput returns the JSON object at the start of input, ignoring
+// any markdown code fence around it or text after it. It returns nil if there
+// is no object, so that the tool reports the missing parameters.
+func parseActionInput(input string) map[string]any {
+	input = strings.TrimSpace(strings.TrimLeft(input, "* \t")) // after **Action Input:**
+	input = strings.TrimPrefix(input, "```json")
+	input = strings.TrimPrefix(input, "```")
+	var arguments map[string]any
+	if err := json.NewDecoder(strings.NewReader(input)).Decode(&arguments); err != nil {
+		return nil
+	}
+	return arguments
+}
@@ -0,0 +1,174 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/codefromthecrypt/practical-genai-go/llmtest"
+	"github.com/parakeet-nest/parakeet/llm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDo_react(t *testing.T) {
+	ollama := llmtest.NewServer(t,
+		llmtest.Text("Thought: I need to list the files.\nAction: shell\nAction Input: {\"command\": \"ls\"}\n"),
+		llmtest.Text("Thought: I know the files.\nFinal Answer: There is one file."),
+	)
+	ollama.Capabilities = []string{"completion"}
+
+	a, err := New(ollama.URL, "test-model", testConfig)
+	require.NoError(t, err)
+	result, err := a.Do(context.Background(), "What files are there?", nil)
+	require.NoError(t, err)
+	require.Equal(t, "There is one file.", result.Content)
+	require.Equal(t, 1, result.Usage.ToolCalls)
+
+	requests := ollama.Requests()
+	require.Len(t, requests, 2)
+	require.Empty(t, requests[0].Tools)
+	require.Contains(t, requests[0].Messages[0].Content, testConfig.SystemPrompt+"\n\n# Tools")
+	require.Contains(t, requests[0].Messages[0].Content, `{"name":"shell","description":"shell runs a shell command.`)
+
+	// The action is sent back as the model wrote it, followed by the tool
+	// result as an observation.
+	require.Equal(t, []llm.Message{
+		{Role: "assistant", Content: "Thought: I need to list the files.\nAction: shell\nAction Input: {\"command\":\"ls\"}"},
+		{Role: "user", Content: "Observation: hello world"},
+	}, requests[1].Messages[2:])
+
+	// The conversation itself has a native tool call, so the transcript is
+	// the same either way.
+	transcript := a.Transcript()
+	require.Equal(t, "Thought: I need to list the files.", transcript.Messages[2].Content)
+	require.Equal(t, "shell", transcript.Messages[2].ToolCalls[0].Name)
+	require.Equal(t, "tool", transcript.Messages[3].Role)
+}
+
+func TestDo_toolProtocol(t *testing.T) {
+	tests := []struct {
+		name          string
+		capabilities  []string
+		protocol      ToolProtocol
+		expectedReAct bool
+	}{
+		{name: "auto tools", capabilities: []string{"completion", "tools"}},
+		{name: "auto no tools", capabilities: []string{"completion"}, expectedReAct: true},
+		{name: "auto unknown"},
+		{name: "native", capabilities: []string{"completion"}, protocol: ToolProtocolNative},
+		{name: "react", capabilities: []string{"completion", "tools"}, protocol: ToolProtocolReAct, expectedReAct: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ollama := llmtest.NewServer(t, llmtest.Text("hello"), llmtest.Text("hello again"))
+			ollama.Capabilities = tc.capabilities
+
+			config := *testConfig
+			config.ToolProtocol = tc.protocol
+			a, err := New(ollama.URL, "test-model", &config)
+			require.NoError(t, err)
+			for range 2 {
+				_, err = a.Do(context.Background(), "hello", nil)
+				require.NoError(t, err)
+			}
+
+			for _, r := range ollama.Requests() {
+				if tc.expectedReAct {
+					require.Empty(t, r.Tools)
+					require.Contains(t, r.Messages[0].Content, "Action Input:")
+				} else {
+					require.Equal(t, []string{"shell", "patch_file"}, r.Tools)
+					require.Equal(t, testConfig.SystemPrompt, r.Messages[0].Content)
+				}
+			}
+		})
+	}
+}
+
+func TestDo_toolProtocolFallback(t *testing.T) {
+	ollama := llmtest.NewServer(t, llmtest.Error(404), llmtest.Text("Final Answer: hello"))
+	ollama.Models = []llmtest.Model{
+		{Name: "test-model:latest", Capabilities: []string{"completion", "tools"}},
+		{Name: "small:latest", Capabilities: []string{"completion"}},
+	}
+
+	config := *testConfig
+	config.Fallbacks = []Endpoint{{Model: "small"}}
+	a, err := New(ollama.URL, "test-model", &config)
+	require.NoError(t, err)
+	result, err := a.Do(context.Background(), "hello", nil)
+	require.NoError(t, err)
+	require.Equal(t, "hello", result.Content)
+
+	// The fallback doesn't support tools, so uses ReAct, unlike the primary.
+	requests := ollama.Requests()
+	require.Len(t, requests, 2)
+	require.Equal(t, []string{"shell", "patch_file"}, requests[0].Tools)
+	require.Equal(t, "small", requests[1].Model)
+	require.Empty(t, requests[1].Tools)
+	require.Contains(t, requests[1].Messages[0].Content, "Action Input:")
+}
+
+func TestNew_unsupportedToolProtocol(t *testing.T) {
+	config := *testConfig
+	config.ToolProtocol = "xml"
+	_, err := New("http://localhost:8080", "test-model", &config)
+	require.EqualError(t, err, "unsupported tool protocol: xml")
+}
+
+func TestParseReAct(t *testing.T) {
+	tests := []struct {
+		name, content string
+		expected      llm.Message
+	}{
+		{
+			name:     "final answer",
+			content:  "Thought: I know this.\nFinal Answer: Go 1.24\nwas released.",
+			expected: llm.Message{Role: "assistant", Content: "Go 1.24\nwas released."},
+		},
+		{
+			name:     "plain answer",
+			content:  " Hello! ",
+			expected: llm.Message{Role: "assistant", Content: "Hello!"},
+		},
+		{
+			name:    "action",
+			content: "Thought: Look first.\nAction: read_file\nAction Input: {\"path\": \"go.mod\"}",
+			expected: llm.Message{Role: "assistant", Content: "Thought: Look first.", ToolCalls: []llm.ToolCall{
+				{Function: llm.FunctionTool{Name: "read_file", Arguments: map[string]any{"path": "go.mod"}}},
+			}},
+		},
+		{
+			name:    "markdown",
+			content: "**Action:** `shell`\n**Action Input:**\n```json\n{\"command\": \"ls\"}\n```\nThis lists files.",
+			expected: llm.Message{Role: "assistant", ToolCalls: []llm.ToolCall{
+				{Function: llm.FunctionTool{Name: "shell", Arguments: map[string]any{"command": "ls"}}},
+			}},
+		},
+		{
+			name:    "imagined observation",
+			content: "Action: shell\nAction Input: {\"command\": \"ls\"}\nObservation: go.mod\nFinal Answer: go.mod",
+			expected: llm.Message{Role: "assistant", ToolCalls: []llm.ToolCall{
+				{Function: llm.FunctionTool{Name: "shell", Arguments: map[string]any{"command": "ls"}}},
+			}},
+		},
+		{
+			name:    "invalid input",
+			content: "Action: shell\nAction Input: ls",
+			expected: llm.Message{Role: "assistant", ToolCalls: []llm.ToolCall{
+				{Function: llm.FunctionTool{Name: "shell"}},
+			}},
+		},
+		{
+			name:     "final answer mentions an action",
+			content:  "Final Answer: Reply with\nAction: shell",
+			expected: llm.Message{Role: "assistant", Content: "Reply with\nAction: shell"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, parseReAct(llm.Message{Role: "assistant", Content: tc.content}))
+		})
+	}
+}
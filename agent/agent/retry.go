@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"regexp"
+	"syscall"
+	"time"
+
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// RetryPolicy configures how LLM calls are retried after a transient error,
+// such as Ollama restarting or being overloaded.
+type RetryPolicy struct {
+	// MaxAttempts is the number of calls to each endpoint, including the
+	// first. Zero or one means no retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, doubling after
+	// each. Defaults to 500ms.
+	InitialBackoff time.Duration
+	// MaxBackoff limits the delay between retries. Defaults to 10s.
+	MaxBackoff time.Duration
+	// Retryable decides if an error is transient. Defaults to IsRetryable.
+	Retryable func(error) bool
+}
+
+// Endpoint is an Ollama URL and model to call when the ones before it are
+// unavailable.
+type Endpoint struct {
+	// URL defaults to the agent's URL.
+	URL string
+	// Model defaults to the agent's model.
+	Model string
+}
+
+func (e Endpoint) String() string {
+	return e.Model + "@" + e.URL
+}
+
+// retryableStatus matches HTTP status codes worth retrying in error messages,
+// as the Parakeet client doesn't return typed errors.
+var retryableStatus = regexp.MustCompile(`\b(408|429|500|502|503|504)\b`)
+
+// unavailableStatus matches the status Ollama returns for a model it doesn't
+// have, such as one not pulled yet.
+var unavailableStatus = regexp.MustCompile(`\b404\b`)
+
+// isUnavailable returns true if err means the endpoint can't serve the model
+// at all, so another endpoint might.
+func isUnavailable(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || unavailableStatus.MatchString(err.Error())
+}
+
+// IsRetryable returns true if err looks transient: a network error, a
+// connection closed early or an HTTP status such as 503.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+	return retryableStatus.MatchString(err.Error())
+}
+
+// chatWithRetry calls each endpoint in order with chat until one succeeds, retrying
+// transient errors according to the policy. It only falls back to the next
+// endpoint when the error is transient or the model is unavailable, as others,
+// such as a bad request or failed authentication, would fail there too. The
+// error of the last endpoint called is returned.
+func chatWithRetry(ctx context.Context, q llm.Query, endpoints []Endpoint, policy RetryPolicy, chat func(context.Context, Endpoint, llm.Query) (llm.Answer, error)) (llm.Answer, error) {
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	var err error
+	for i, e := range endpoints {
+		if i > 0 {
+			log.Printf("Falling back to %s after: %v", e, err)
+		}
+		q.Model = e.Model
+		var answer llm.Answer
+		if answer, err = retry(ctx, policy, retryable, func() (llm.Answer, error) {
+			return chat(ctx, e, q)
+		}); err == nil || ctx.Err() != nil {
+			return answer, err
+		}
+		if !retryable(err) && !isUnavailable(err) {
+			return llm.Answer{}, err
+		}
+	}
+	if len(endpoints) > 1 {
+		err = fmt.Errorf("all %d endpoints failed, last error: %w", len(endpoints), err)
+	}
+	return llm.Answer{}, err
+}
+
+// retry calls fn until it succeeds, returns an error that isn't retryable or
+// the policy's attempts are exhausted.
+func retry(ctx context.Context, policy RetryPolicy, retryable func(error) bool, fn func() (llm.Answer, error)) (llm.Answer, error) {
+	backoff := policy.InitialBackoff
+	if backoff <= 0 {
+		backoff = 500 * time.Millisecond
+	}
+	maxBackoff := policy.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 10 * time.Second
+	}
+	for attempt := 1; ; attempt++ {
+		answer, err := fn()
+		if err == nil || attempt >= policy.MaxAttempts || !retryable(err) {
+			return answer, err
+		}
+
+		// Half the backoff plus a random amount up to the other half, so
+		// that many clients retrying at once don't stay in step.
+		delay := backoff/2 + rand.N(backoff/2+1)
+		log.Printf("LLM call failed, retrying in %s: %v", delay.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return answer, fmt.Errorf("%w while retrying: %v", ctx.Err(), err)
+		case <-time.After(delay):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
@@ -0,0 +1,204 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/codefromthecrypt/practical-genai-go/telemetry"
+	"github.com/parakeet-nest/parakeet/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "nil"},
+		{name: "connection refused", err: fmt.Errorf("dial: %w", syscall.ECONNREFUSED), expected: true},
+		{name: "unexpected EOF", err: io.ErrUnexpectedEOF, expected: true},
+		{name: "service unavailable", err: errors.New("status code: 503"), expected: true},
+		{name: "too many requests", err: errors.New("status code: 429"), expected: true},
+		{name: "not found", err: errors.New("status code: 404")},
+		{name: "canceled", err: context.Canceled},
+		{name: "deadline", err: fmt.Errorf("wrapped: %w", context.DeadlineExceeded)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, IsRetryable(tc.err))
+		})
+	}
+}
+
+// fakeOllama answers with the model requested, after failing with each status
+// in failures, in order.
+type fakeOllama struct {
+	t        *testing.T
+	mu       sync.Mutex
+	failures []int
+	models   []string
+}
+
+func (f *fakeOllama) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var q llm.Query
+	assert.NoError(f.t, json.NewDecoder(r.Body).Decode(&q))
+
+	f.mu.Lock()
+	f.models = append(f.models, q.Model)
+	var status int
+	if len(f.failures) > 0 {
+		status, f.failures = f.failures[0], f.failures[1:]
+	}
+	f.mu.Unlock()
+
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"model":%q,"message":{"role":"assistant","content":"hello from %s"},"done":true}`, q.Model, q.Model)
+}
+
+var fastRetry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+func ollamaEndpoint(ctx context.Context, e Endpoint, q llm.Query) (llm.Answer, error) {
+	return telemetry.Chat(ctx, e.URL, q)
+}
+
+func TestChatWithRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  []int
+		fallback  bool
+		expected  string
+		models    []string
+		expectErr string
+	}{
+		{
+			name:     "succeeds",
+			expected: "hello from primary",
+			models:   []string{"primary"},
+		},
+		{
+			name:     "retries transient errors",
+			failures: []int{503, 502},
+			expected: "hello from primary",
+			models:   []string{"primary", "primary", "primary"},
+		},
+		{
+			name:      "gives up after max attempts",
+			failures:  []int{503, 503, 503},
+			expectErr: "status code: 503",
+			models:    []string{"primary", "primary", "primary"},
+		},
+		{
+			name:      "doesn't retry other errors",
+			failures:  []int{404},
+			expectErr: "status code: 404",
+			models:    []string{"primary"},
+		},
+		{
+			name:     "falls back when unavailable",
+			failures: []int{404},
+			fallback: true,
+			expected: "hello from small",
+			models:   []string{"primary", "small"},
+		},
+		{
+			name:     "falls back after retries",
+			failures: []int{503, 503, 503},
+			fallback: true,
+			expected: "hello from small",
+			models:   []string{"primary", "primary", "primary", "small"},
+		},
+		{
+			name:      "doesn't fall back on a bad request",
+			failures:  []int{400},
+			fallback:  true,
+			expectErr: "status code: 400",
+			models:    []string{"primary"},
+		},
+		{
+			name:      "doesn't fall back when unauthorized",
+			failures:  []int{401},
+			fallback:  true,
+			expectErr: "status code: 401",
+			models:    []string{"primary"},
+		},
+		{
+			name:      "all endpoints fail",
+			failures:  []int{404, 404},
+			fallback:  true,
+			expectErr: "all 2 endpoints failed, last error: status code: 404",
+			models:    []string{"primary", "small"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &fakeOllama{t: t, failures: tc.failures}
+			ollama := httptest.NewServer(f)
+			defer ollama.Close()
+
+			config := &Config{ToolSource: "package tools", Retry: fastRetry}
+			if tc.fallback {
+				config.Fallbacks = []Endpoint{{Model: "small"}}
+			}
+			agent, err := New(ollama.URL, "primary", config)
+			require.NoError(t, err)
+
+			reply, err := agent.Request("hello")
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tc.expected, reply)
+			}
+			require.Equal(t, tc.models, f.models)
+		})
+	}
+}
+
+func TestChatWithRetry_fallbackURL(t *testing.T) {
+	down := httptest.NewServer(&fakeOllama{t: t})
+	down.Close() // connection refused
+
+	up := &fakeOllama{t: t}
+	ollama := httptest.NewServer(up)
+	defer ollama.Close()
+
+	reply, err := chatWithRetry(context.Background(), llm.Query{}, []Endpoint{
+		{URL: down.URL, Model: "primary"},
+		{URL: ollama.URL, Model: "primary"},
+	}, fastRetry, ollamaEndpoint)
+	require.NoError(t, err)
+	require.Equal(t, "hello from primary", reply.Message.Content)
+	require.Equal(t, []string{"primary"}, up.models)
+}
+
+func TestChatWithRetry_canceled(t *testing.T) {
+	ollama := httptest.NewServer(&fakeOllama{t: t, failures: []int{503, 503}})
+	defer ollama.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := chatWithRetry(ctx, llm.Query{}, []Endpoint{
+		{URL: ollama.URL, Model: "primary"},
+		{URL: ollama.URL, Model: "small"},
+	}, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour}, ollamaEndpoint)
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorContains(t, err, "status code: 503")
+}
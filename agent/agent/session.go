@@ -0,0 +1,190 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// SessionManager holds many independent conversations keyed by ID, for
+// example one per client of a server. Sessions unused for longer than the
+// idle timeout are discarded, closing their agent.
+//
+// A SessionManager is safe for concurrent use.
+type SessionManager struct {
+	url, model string
+	// newConfig is called for each new session, so that sessions don't share
+	// tool state unless the caller wants them to.
+	newConfig   func(id string) *Config
+	idleTimeout time.Duration
+
+	mu        sync.Mutex
+	sessions  map[string]*session
+	done      chan struct{}
+	closeOnce sync.Once
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+type session struct {
+	agent    *Agent
+	lastUsed time.Time
+}
+
+// NewSessionManager creates agents on demand using the given url and model.
+// newConfig returns the Config for a new session ID. It may be called
+// concurrently, even twice for the same ID, when that session is requested
+// at the same time. A positive idleTimeout
+// starts a goroutine which discards idle sessions until Close is called.
+//
+// Discarded sessions close their agent, which closes toolboxes such as MCP
+// clients. So, newConfig should start any such toolboxes for each session,
+// rather than share them.
+func NewSessionManager(url, model string, newConfig func(id string) *Config, idleTimeout time.Duration) *SessionManager {
+	m := &SessionManager{
+		url:         url,
+		model:       model,
+		newConfig:   newConfig,
+		idleTimeout: idleTimeout,
+		sessions:    map[string]*session{},
+		done:        make(chan struct{}),
+		now:         time.Now,
+	}
+	if idleTimeout > 0 {
+		go m.evictLoop()
+	}
+	return m
+}
+
+// Get returns the agent for the session ID, creating it if it doesn't exist.
+func (m *SessionManager) Get(id string) (*Agent, error) {
+	if a, ok := m.lookup(id); ok {
+		return a, nil
+	}
+
+	// Create the agent without holding the lock, as starting its toolboxes,
+	// such as MCP servers, can be slow.
+	config := m.newConfig(id)
+	a, err := New(m.url, m.model, config)
+	if err != nil {
+		if err := closeToolboxes(config.Toolboxes); err != nil {
+			log.Printf("failed to close session %s: %v", id, err)
+		}
+		return nil, fmt.Errorf("failed to create session %s: %w", id, err)
+	}
+
+	m.mu.Lock()
+	s, ok := m.sessions[id]
+	if !ok {
+		s = &session{agent: a}
+		m.sessions[id] = s
+	}
+	s.lastUsed = m.now()
+	m.mu.Unlock()
+
+	if s.agent != a { // another call created the session first
+		closeAgent(id, a)
+	}
+	return s.agent, nil
+}
+
+// lookup returns the agent for the session ID, if it exists, marking it used.
+func (m *SessionManager) lookup(id string) (*Agent, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	s.lastUsed = m.now()
+	return s.agent, true
+}
+
+// Delete discards the session ID, if it exists. Its agent is closed once any
+// request in progress finishes, so Delete waits for it.
+func (m *SessionManager) Delete(id string) {
+	m.mu.Lock()
+	s, ok := m.sessions[id]
+	delete(m.sessions, id)
+	m.mu.Unlock()
+
+	if ok {
+		closeAgent(id, s.agent)
+	}
+}
+
+// Has returns true if the session ID exists.
+func (m *SessionManager) Has(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.sessions[id]
+	return ok
+}
+
+// Len returns the number of sessions.
+func (m *SessionManager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+// Close stops discarding idle sessions, and discards all sessions. Like
+// Delete, it waits for requests in progress to finish before closing their
+// agents.
+func (m *SessionManager) Close() {
+	m.closeOnce.Do(func() { close(m.done) })
+
+	m.mu.Lock()
+	sessions := m.sessions
+	m.sessions = map[string]*session{}
+	m.mu.Unlock()
+
+	for id, s := range sessions {
+		closeAgent(id, s.agent)
+	}
+}
+
+// closeAgent closes the agent of a discarded session, after any request in
+// progress finishes, so that its tools aren't closed while in use.
+func closeAgent(id string, a *Agent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.Close(); err != nil {
+		log.Printf("failed to close session %s: %v", id, err)
+	}
+}
+
+func (m *SessionManager) evictLoop() {
+	ticker := time.NewTicker(m.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.evictIdle()
+		}
+	}
+}
+
+// evictIdle discards sessions idle longer than the timeout. A session in the
+// middle of a request isn't idle, even if the request is taking a long time.
+func (m *SessionManager) evictIdle() {
+	m.mu.Lock()
+	idle := map[string]*session{}
+	deadline := m.now().Add(-m.idleTimeout)
+	for id, s := range m.sessions {
+		if !s.lastUsed.Before(deadline) || !s.agent.mu.TryLock() {
+			continue
+		}
+		s.agent.mu.Unlock()
+		idle[id] = s
+		delete(m.sessions, id)
+	}
+	m.mu.Unlock()
+
+	for id, s := range idle {
+		closeAgent(id, s.agent)
+	}
+}
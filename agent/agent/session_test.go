@@ -0,0 +1,177 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionManager(t *testing.T) {
+	var configIDs []string
+	m := NewSessionManager("http://localhost:8080", "test-model", func(id string) *Config {
+		configIDs = append(configIDs, id)
+		return testConfig
+	}, time.Hour)
+	defer m.Close()
+
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	alice, err := m.Get("alice")
+	require.NoError(t, err)
+	bob, err := m.Get("bob")
+	require.NoError(t, err)
+	require.NotSame(t, alice, bob)
+
+	again, err := m.Get("alice")
+	require.NoError(t, err)
+	require.Same(t, alice, again)
+	require.Equal(t, []string{"alice", "bob"}, configIDs)
+	require.Equal(t, 2, m.Len())
+
+	t.Run("evicts idle sessions", func(t *testing.T) {
+		now = now.Add(time.Hour + time.Second)
+		_, err := m.Get("bob") // bob is no longer idle
+		require.NoError(t, err)
+
+		m.evictIdle()
+		require.Equal(t, 1, m.Len())
+
+		recreated, err := m.Get("alice")
+		require.NoError(t, err)
+		require.NotSame(t, alice, recreated)
+	})
+
+	t.Run("doesn't evict sessions handling a request", func(t *testing.T) {
+		busy, err := m.Get("busy")
+		require.NoError(t, err)
+		busy.mu.Lock()
+		defer busy.mu.Unlock()
+
+		now = now.Add(2 * time.Hour)
+		m.evictIdle()
+		require.Equal(t, 1, m.Len())
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		m.Delete("busy")
+		require.Zero(t, m.Len())
+	})
+}
+
+// closingToolbox counts how many times it was closed.
+type closingToolbox struct {
+	echoToolbox
+	closed *int
+}
+
+func (tb closingToolbox) Close() error {
+	*tb.closed++
+	return nil
+}
+
+func TestSessionManager_closesAgents(t *testing.T) {
+	closed := map[string]*int{}
+	m := NewSessionManager("http://localhost:8080", "test-model", func(id string) *Config {
+		config := *testConfig
+		closed[id] = new(int)
+		config.Toolboxes = []Toolbox{closingToolbox{closed: closed[id]}}
+		return &config
+	}, time.Hour)
+
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	for _, id := range []string{"idle", "deleted", "open"} {
+		_, err := m.Get(id)
+		require.NoError(t, err)
+	}
+
+	m.Delete("deleted")
+	now = now.Add(time.Hour + time.Second)
+	_, err := m.Get("open")
+	require.NoError(t, err)
+	m.evictIdle() // open was used since
+	require.Equal(t, map[string]int{"idle": 1, "deleted": 1, "open": 0}, counts(closed))
+
+	m.Close()
+	require.Equal(t, map[string]int{"idle": 1, "deleted": 1, "open": 1}, counts(closed))
+	require.Zero(t, m.Len())
+}
+
+func TestSessionManager_Get_closesToolboxesOnError(t *testing.T) {
+	closed := 0
+	m := NewSessionManager("http://localhost:8080", "test-model", func(string) *Config {
+		config := *testConfig
+		config.ToolProtocol = "telepathy"
+		config.Toolboxes = []Toolbox{closingToolbox{closed: &closed}}
+		return &config
+	}, 0)
+	defer m.Close()
+
+	_, err := m.Get("alice")
+	require.EqualError(t, err, "failed to create session alice: unsupported tool protocol: telepathy")
+	require.Equal(t, 1, closed)
+	require.Zero(t, m.Len())
+}
+
+func TestSessionManager_Get_doesntBlockOtherSessions(t *testing.T) {
+	starting, start := make(chan struct{}), make(chan struct{})
+	m := NewSessionManager("http://localhost:8080", "test-model", func(id string) *Config {
+		if id == "slow" {
+			close(starting)
+			<-start // like an MCP server taking a while to start
+		}
+		return testConfig
+	}, 0)
+	defer m.Close()
+
+	slow := make(chan error)
+	go func() {
+		_, err := m.Get("slow")
+		slow <- err
+	}()
+	<-starting
+
+	_, err := m.Get("fast")
+	require.NoError(t, err)
+	require.Equal(t, 1, m.Len())
+
+	close(start)
+	require.NoError(t, <-slow)
+	require.Equal(t, 2, m.Len())
+}
+
+func TestSessionManager_Delete_waitsForRequest(t *testing.T) {
+	closed := 0
+	m := NewSessionManager("http://localhost:8080", "test-model", func(string) *Config {
+		config := *testConfig
+		config.Toolboxes = []Toolbox{closingToolbox{closed: &closed}}
+		return &config
+	}, 0)
+	defer m.Close()
+
+	busy, err := m.Get("busy")
+	require.NoError(t, err)
+	busy.mu.Lock() // like a request in progress
+
+	deleted := make(chan struct{})
+	go func() {
+		m.Delete("busy")
+		close(deleted)
+	}()
+	require.Eventually(t, func() bool { return !m.Has("busy") }, time.Second, time.Millisecond)
+	require.Zero(t, closed) // its tools are still in use
+
+	busy.mu.Unlock()
+	<-deleted
+	require.Equal(t, 1, closed)
+}
+
+func counts(closed map[string]*int) map[string]int {
+	c := map[string]int{}
+	for id, n := range closed {
+		c[id] = *n
+	}
+	return c
+}
@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// Tool is a tool defined with Go types instead of reflection by name. Create
+// one with NewTool.
+//
+// A Tool is a Toolbox with one tool, so add it to Config.Toolboxes.
+type Tool struct {
+	definition llm.Tool
+	call       func(ctx context.Context, arguments map[string]interface{}) (string, error)
+}
+
+// NewTool defines a tool named name, which the LLM calls with arguments
+// decoded into Args. Args must be a struct, and its exported fields are the
+// parameters of the tool. These struct tags define the schema of each:
+//
+//   - json: the parameter name. Parameters are required unless the tag has
+//     omitempty.
+//   - description: explains the parameter to the LLM.
+//   - enum: comma-separated values the parameter must be one of.
+//   - required: "true" or "false", which overrides the json tag.
+//
+// The result is marshalled to JSON for the LLM, except strings which are
+// passed as-is.
+//
+// NewTool panics if Args is not a struct, as that is a programming error.
+func NewTool[Args, Result any](name, description string, fn func(context.Context, Args) (Result, error)) *Tool {
+	params, enums, err := parametersOf(reflect.TypeFor[Args]())
+	if err != nil {
+		panic(fmt.Sprintf("agent.NewTool(%q): %v", name, err))
+	}
+	return &Tool{
+		definition: llm.Tool{
+			Type:     "function",
+			Function: llm.Function{Name: name, Description: description, Parameters: params},
+		},
+		call: func(ctx context.Context, arguments map[string]interface{}) (string, error) {
+			for _, p := range params.Required {
+				if _, ok := arguments[p]; !ok {
+					return "", callError(fmt.Sprintf("Missing parameter: %s", p))
+				}
+			}
+			for p, values := range enums {
+				if v, ok := arguments[p]; ok && !slices.Contains(values, fmt.Sprint(v)) {
+					return "", callError(fmt.Sprintf("Invalid parameter: %s must be one of %s", p, strings.Join(values, ", ")))
+				}
+			}
+			var args Args
+			// Round-trip via JSON, as the arguments were decoded from JSON.
+			b, err := json.Marshal(arguments)
+			if err == nil {
+				err = json.Unmarshal(b, &args)
+			}
+			if err != nil {
+				return "", callError(fmt.Sprintf("Invalid parameters: %v", err))
+			}
+			result, err := fn(ctx, args)
+			if err != nil && reflect.ValueOf(&result).Elem().IsZero() {
+				return "", err // don't confuse the LLM with an empty result
+			}
+			return resultString(result), err
+		},
+	}
+}
+
+// ListTools implements Toolbox.
+func (t *Tool) ListTools(context.Context) ([]llm.Tool, error) {
+	return []llm.Tool{t.definition}, nil
+}
+
+// CallTool implements Toolbox.
+func (t *Tool) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (string, error) {
+	if name != t.definition.Function.Name {
+		return "", callError(name + " is not a registered tool")
+	}
+	return t.call(ctx, arguments)
+}
+
+// resultString formats a tool result for the LLM.
+func resultString(result any) string {
+	switch r := result.(type) {
+	case string:
+		return r
+	case nil:
+		return ""
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Sprintf("%v", result)
+	}
+	return string(b)
+}
+
+// parametersOf returns the tool parameters for the exported fields of a
+// struct type, and the allowed values of any enum parameters.
+func parametersOf(t reflect.Type) (llm.Parameters, map[string][]string, error) {
+	params := llm.Parameters{
+		Type:       "object",
+		Properties: map[string]llm.Property{},
+		Required:   []string{},
+	}
+	enums := map[string][]string{}
+	if t.Kind() != reflect.Struct {
+		return params, nil, fmt.Errorf("Args must be a struct, not %s", t)
+	}
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		} else if name == "" {
+			name = field.Name
+		}
+
+		required := !strings.Contains(opts, "omitempty")
+		switch field.Tag.Get("required") {
+		case "true":
+			required = true
+		case "false":
+			required = false
+		}
+		if required {
+			params.Required = append(params.Required, name)
+		}
+
+		description := field.Tag.Get("description")
+		if enum := field.Tag.Get("enum"); enum != "" {
+			enums[name] = strings.Split(enum, ",")
+			// llm.Property has no enum field, so describe them instead.
+			description = strings.TrimSpace(description + " One of: " +
+				strings.Join(enums[name], ", ") + ".")
+		}
+		params.Properties[name] = llm.Property{Type: jsonType(field.Type), Description: description}
+	}
+	return params, enums, nil
+}
+
+// jsonType returns the JSON schema type of a Go type.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return jsonType(t.Elem())
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	default:
+		return "string"
+	}
+}
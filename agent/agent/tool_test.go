@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/parakeet-nest/parakeet/llm"
+	"github.com/stretchr/testify/require"
+)
+
+type weatherArgs struct {
+	City  string `json:"city" description:"The city to get the weather for."`
+	Units string `json:"units,omitempty" enum:"celsius,fahrenheit" description:"Temperature units."`
+	Days  int    `json:"days" required:"false"`
+}
+
+type weather struct {
+	City        string  `json:"city"`
+	Temperature float64 `json:"temperature"`
+}
+
+var weatherTool = NewTool("get_weather", "get_weather returns the current weather.",
+	func(_ context.Context, args weatherArgs) (weather, error) {
+		if args.City == "Atlantis" {
+			return weather{}, errors.New("city not found")
+		}
+		return weather{City: args.City, Temperature: 31.5}, nil
+	})
+
+func TestNewTool(t *testing.T) {
+	tools, err := weatherTool.ListTools(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []llm.Tool{{
+		Type: "function",
+		Function: llm.Function{
+			Name:        "get_weather",
+			Description: "get_weather returns the current weather.",
+			Parameters: llm.Parameters{
+				Type: "object",
+				Properties: map[string]llm.Property{
+					"city":  {Type: "string", Description: "The city to get the weather for."},
+					"units": {Type: "string", Description: "Temperature units. One of: celsius, fahrenheit."},
+					"days":  {Type: "integer"},
+				},
+				Required: []string{"city"},
+			},
+		},
+	}}, tools)
+}
+
+func TestNewTool_notStruct(t *testing.T) {
+	require.PanicsWithValue(t, `agent.NewTool("echo"): Args must be a struct, not string`, func() {
+		NewTool("echo", "", func(_ context.Context, s string) (string, error) { return s, nil })
+	})
+}
+
+func TestTool_CallTool(t *testing.T) {
+	config := *testConfig
+	config.Toolboxes = []Toolbox{weatherTool}
+	agent, err := New("http://localhost:8080", "test-model", &config)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		expected  string
+	}{
+		{
+			name:      "result is JSON",
+			arguments: map[string]interface{}{"city": "Singapore", "days": float64(1)},
+			expected:  `{"city":"Singapore","temperature":31.5}`,
+		},
+		{
+			name:      "error",
+			arguments: map[string]interface{}{"city": "Atlantis"},
+			expected:  "\n\nError:\ncity not found",
+		},
+		{
+			name:      "missing parameter",
+			arguments: map[string]interface{}{"units": "celsius"},
+			expected:  "Missing parameter: city",
+		},
+		{
+			name:      "invalid enum",
+			arguments: map[string]interface{}{"city": "Singapore", "units": "kelvin"},
+			expected:  "Invalid parameter: units must be one of celsius, fahrenheit",
+		},
+		{
+			name:      "invalid type",
+			arguments: map[string]interface{}{"city": 42},
+			expected:  "Invalid parameters: json: cannot unmarshal number into Go struct field weatherArgs.city of type string",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := encodeResult(agent.callTool(context.Background(), llm.FunctionTool{
+				Name:      "get_weather",
+				Arguments: tc.arguments,
+			}))
+			require.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func ExampleNewTool() {
+	type args struct {
+		Name string `json:"name" description:"Who to greet."`
+	}
+	greet := NewTool("greet", "greet says hello.", func(_ context.Context, a args) (string, error) {
+		return "Hello, " + a.Name, nil
+	})
+
+	result, _ := greet.CallTool(context.Background(), "greet", map[string]interface{}{"name": "Gopher"})
+	fmt.Println(result)
+	// Output: Hello, Gopher
+}
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// Toolbox provides tools that aren't Go functions in Config.ToolSource. For
+// example, tools listed by a Model Context Protocol (MCP) server.
+type Toolbox interface {
+	// ListTools returns the definitions the LLM uses to call tools.
+	ListTools(ctx context.Context) ([]llm.Tool, error)
+	// CallTool invokes a tool by name with the arguments the LLM chose.
+	CallTool(ctx context.Context, name string, arguments map[string]interface{}) (string, error)
+}
+
+// addToolboxes adds the tools of each toolbox next to the Go functions, and
+// remembers which toolbox handles each.
+func (a *Agent) addToolboxes(ctx context.Context, toolboxes []Toolbox) error {
+	for _, tb := range toolboxes {
+		tools, err := tb.ListTools(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list tools: %w", err)
+		}
+		for _, tool := range tools {
+			name := tool.Function.Name
+			if _, ok := a.goFuncs[name]; ok {
+				return fmt.Errorf("duplicate tool: %s", name)
+			} else if _, ok = a.toolboxes[name]; ok {
+				return fmt.Errorf("duplicate tool: %s", name)
+			}
+			a.toolboxes[name] = tb
+			a.q.Tools = append(a.q.Tools, tool)
+		}
+	}
+	return nil
+}
+
+// Close closes each of Config.Toolboxes which is an io.Closer, such as an MCP
+// client, stopping its server. The agent can't call their tools afterwards.
+func (a *Agent) Close() error {
+	return closeToolboxes(a.ownToolboxes)
+}
+
+// closeToolboxes closes each toolbox which is an io.Closer.
+func closeToolboxes(toolboxes []Toolbox) error {
+	var errs []error
+	for _, tb := range toolboxes {
+		if c, ok := tb.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// callTool invokes the tool call with the toolbox that listed it, or the
+// Go function with its name.
+func (a *Agent) callTool(ctx context.Context, toolCall llm.FunctionTool) (string, error) {
+	if tb, ok := a.toolboxes[toolCall.Name]; ok {
+		return tb.CallTool(ctx, toolCall.Name, toolCall.Arguments)
+	}
+	return a.invokeFunction(toolCall)
+}
+
+// NewToolbox returns the tools in the config as a Toolbox, without an LLM.
+// For example, to serve them to other agents over MCP.
+func NewToolbox(config *Config) (Toolbox, error) {
+	a, err := New("", "", config)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// ListTools implements Toolbox, returning the definitions of all tools the
+// LLM can call, including those of Config.Toolboxes.
+func (a *Agent) ListTools(context.Context) ([]llm.Tool, error) {
+	return a.q.Tools, nil
+}
+
+// CallTool implements Toolbox. It invokes tools the same way as when the LLM
+// requests them, including Config.ToolMiddleware, except errors are returned
+// instead of encoded in the result.
+func (a *Agent) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (string, error) {
+	return a.tool(ctx, llm.FunctionTool{Name: name, Arguments: arguments})
+}
@@ -0,0 +1,166 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/parakeet-nest/parakeet/llm"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type echoToolbox struct{}
+
+func (echoToolbox) ListTools(context.Context) ([]llm.Tool, error) {
+	return []llm.Tool{{Type: "function", Function: llm.Function{Name: "echo", Description: "echo returns text."}}}, nil
+}
+
+func (echoToolbox) CallTool(_ context.Context, name string, arguments map[string]interface{}) (string, error) {
+	if text, ok := arguments["text"].(string); ok {
+		return text, nil
+	}
+	return "", errors.New("missing text")
+}
+
+func TestToolboxes(t *testing.T) {
+	config := *testConfig
+	config.Toolboxes = []Toolbox{echoToolbox{}}
+
+	agent, err := New("http://localhost:8080", "test-model", &config)
+	require.NoError(t, err)
+	require.Equal(t, "echo", agent.q.Tools[len(agent.q.Tools)-1].Function.Name)
+
+	ctx := context.Background()
+	result, err := agent.CallTool(ctx, "echo", map[string]interface{}{"text": "hi"})
+	require.NoError(t, err)
+	require.Equal(t, "hi", result)
+
+	t.Run("error", func(t *testing.T) {
+		_, err := agent.CallTool(ctx, "echo", nil)
+		require.EqualError(t, err, "missing text")
+	})
+
+	t.Run("falls back to go functions", func(t *testing.T) {
+		result, err := agent.CallTool(ctx, "shell", map[string]interface{}{"command": "ls"})
+		require.NoError(t, err)
+		require.Equal(t, "hello world", result)
+	})
+
+	t.Run("not a tool", func(t *testing.T) {
+		_, err := agent.CallTool(ctx, "shell2", nil)
+		require.EqualError(t, err, "shell2 is not a registered tool")
+	})
+
+	t.Run("duplicate tool", func(t *testing.T) {
+		config.Toolboxes = []Toolbox{echoToolbox{}, echoToolbox{}}
+		_, err := New("http://localhost:8080", "test-model", &config)
+		require.EqualError(t, err, "duplicate tool: echo")
+	})
+}
+
+func TestRequest_toolbox(t *testing.T) {
+	// The first response asks for the echo tool, and the second answers.
+	responses := []string{
+		`{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"echo","arguments":{"text":"hi"}}}]},"done":true}`,
+		`{"message":{"role":"assistant","content":"The tool said hi"},"done":true}`,
+	}
+	ollama := httptest.NewServer(ollamaChat(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(responses[0]))
+		responses = responses[1:]
+	}))
+	defer ollama.Close()
+
+	config := *testConfig
+	config.Toolboxes = []Toolbox{echoToolbox{}}
+	agent, err := New(ollama.URL, "test-model", &config)
+	require.NoError(t, err)
+
+	reply, err := agent.Request("Echo hi")
+	require.NoError(t, err)
+	require.Equal(t, "The tool said hi", reply)
+
+	messages := agent.Transcript().Messages
+	require.Equal(t, "tool", messages[3].Role)
+	require.Equal(t, "echo", messages[3].ToolName)
+	require.Equal(t, "hi", messages[3].Content)
+}
+
+func TestDo_usage(t *testing.T) {
+	responses := []string{
+		`{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"echo","arguments":{"text":"hi"}}}]},` +
+			`"done":true,"prompt_eval_count":100,"eval_count":10,"eval_duration":1000000000}`,
+		`{"message":{"role":"assistant","content":"The tool said hi"},` +
+			`"done":true,"prompt_eval_count":120,"eval_count":5,"eval_duration":500000000}`,
+	}
+	ollama := httptest.NewServer(ollamaChat(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(responses[0]))
+		responses = responses[1:]
+	}))
+	defer ollama.Close()
+
+	config := *testConfig
+	config.Toolboxes = []Toolbox{echoToolbox{}}
+	agent, err := New(ollama.URL, "test-model", &config)
+	require.NoError(t, err)
+
+	result, err := agent.Do(context.Background(), "Echo hi", nil)
+	require.NoError(t, err)
+
+	u := result.Usage
+	require.Equal(t, 2, u.LLMCalls)
+	require.Equal(t, 220, u.PromptTokens)
+	require.Equal(t, 15, u.CompletionTokens)
+	require.Equal(t, 10.0, u.TokensPerSecond())
+	require.Equal(t, 1, u.ToolCalls)
+	require.Zero(t, u.ToolErrors)
+	require.GreaterOrEqual(t, u.Duration, u.LLMDuration+u.ToolDuration)
+
+	// The session adds up each request.
+	require.Equal(t, u, agent.Usage())
+}
+
+func TestRequest_traced(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	responses := []string{
+		`{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"echo","arguments":{"text":"hi"}}}]},"done":true}`,
+		`{"message":{"role":"assistant","content":"The tool said hi"},"done":true}`,
+	}
+	ollama := httptest.NewServer(ollamaChat(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(responses[0]))
+		responses = responses[1:]
+	}))
+	defer ollama.Close()
+
+	config := *testConfig
+	config.Toolboxes = []Toolbox{echoToolbox{}}
+	agent, err := New(ollama.URL, "test-model", &config)
+	require.NoError(t, err)
+
+	_, err = agent.Request("Echo hi")
+	require.NoError(t, err)
+
+	// Spans end children first, so the request is last.
+	spans := recorder.Ended()
+	var names []string
+	for _, span := range spans {
+		names = append(names, span.Name())
+	}
+	require.Equal(t, []string{"chat test-model", "execute_tool echo", "chat test-model", "invoke_agent"}, names)
+	root := spans[3]
+	for _, span := range spans[:3] {
+		require.Equal(t, root.SpanContext().TraceID(), span.SpanContext().TraceID())
+		require.Equal(t, root.SpanContext().SpanID(), span.Parent().SpanID())
+	}
+}
@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/codefromthecrypt/practical-genai-go/usage"
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// TranscriptVersion is the format version written by Agent.SaveTranscript.
+// It is incremented when a change would make older readers misinterpret a
+// file, and LoadTranscript refuses versions it doesn't understand.
+const TranscriptVersion = 1
+
+// Transcript is a JSON record of an agent session. It includes every message
+// in the conversation, including tool calls and their results, so that a
+// session can be resumed after the process exits or crashes.
+type Transcript struct {
+	Version  int                 `json:"version"`
+	Model    string              `json:"model"`
+	Created  time.Time           `json:"created"`
+	Updated  time.Time           `json:"updated"`
+	Messages []TranscriptMessage `json:"messages"`
+	// Usage is the total of all requests in the session.
+	Usage usage.Usage `json:"usage"`
+}
+
+// TranscriptMessage is a message in the conversation and the time it was
+// added to it.
+type TranscriptMessage struct {
+	Time time.Time `json:"time"`
+	// Role is "system", "user", "assistant" or "tool".
+	Role    string `json:"role"`
+	Content string `json:"content,omitempty"`
+	// ToolCalls are the tools an assistant message requested to invoke.
+	ToolCalls []TranscriptToolCall `json:"tool_calls,omitempty"`
+	// ToolName is the tool that produced the content of a "tool" message.
+	// Ollama doesn't need this, but it makes the transcript easier to read.
+	ToolName string `json:"tool_name,omitempty"`
+}
+
+// TranscriptToolCall is a tool the LLM requested the agent to invoke.
+type TranscriptToolCall struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// UserTurns returns the count of user messages, which is the number of
+// requests the session has handled so far.
+func (t *Transcript) UserTurns() (count int) {
+	for _, m := range t.Messages {
+		if m.Role == "user" {
+			count++
+		}
+	}
+	return
+}
+
+// LoadTranscript reads a transcript previously written by
+// Agent.SaveTranscript.
+func LoadTranscript(path string) (*Transcript, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcript: %w", err)
+	}
+	var t Transcript
+	if err = json.Unmarshal(b, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse transcript: %w", err)
+	}
+	if t.Version != TranscriptVersion {
+		return nil, fmt.Errorf("unsupported transcript version %d, expected %d", t.Version, TranscriptVersion)
+	}
+	return &t, nil
+}
+
+// Resume creates an agent like New, except the conversation continues from
+// the transcript instead of starting with Config.SystemPrompt. If model is
+// empty, the model recorded in the transcript is used.
+func Resume(url, model string, config *Config, t *Transcript) (*Agent, error) {
+	if model == "" {
+		model = t.Model
+	}
+	a, err := New(url, model, config)
+	if err != nil {
+		return nil, err
+	}
+	a.created = t.Created
+	a.usage = t.Usage
+	a.q.Messages = make([]llm.Message, 0, len(t.Messages))
+	a.times = make([]time.Time, 0, len(t.Messages))
+	for _, m := range t.Messages {
+		msg := llm.Message{Role: m.Role, Content: m.Content}
+		for _, c := range m.ToolCalls {
+			msg.ToolCalls = append(msg.ToolCalls, llm.ToolCall{
+				Function: llm.FunctionTool{Name: c.Name, Arguments: c.Arguments},
+			})
+		}
+		a.q.Messages = append(a.q.Messages, msg)
+		a.times = append(a.times, m.Time)
+	}
+	return a, nil
+}
+
+// Transcript returns a snapshot of the conversation so far.
+func (a *Agent) Transcript() *Transcript {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	t := &Transcript{
+		Version:  TranscriptVersion,
+		Model:    a.q.Model,
+		Created:  a.created,
+		Messages: make([]TranscriptMessage, 0, len(a.q.Messages)),
+		Usage:    a.Usage(),
+	}
+	for i, m := range a.q.Messages {
+		tm := TranscriptMessage{Time: a.times[i], Role: m.Role, Content: m.Content}
+		for _, c := range m.ToolCalls {
+			tm.ToolCalls = append(tm.ToolCalls, TranscriptToolCall{
+				Name:      c.Function.Name,
+				Arguments: c.Function.Arguments,
+			})
+		}
+		// Tool results follow the assistant message that requested them.
+		if m.Role == "tool" && i > 0 && len(a.q.Messages[i-1].ToolCalls) > 0 {
+			tm.ToolName = a.q.Messages[i-1].ToolCalls[0].Function.Name
+		}
+		t.Messages = append(t.Messages, tm)
+		t.Updated = tm.Time
+	}
+	return t
+}
+
+// SaveTranscript writes the conversation so far to path as JSON. The file is
+// replaced atomically, so a crash while saving doesn't corrupt the previous
+// transcript.
+func (a *Agent) SaveTranscript(path string) error {
+	b, err := json.MarshalIndent(a.Transcript(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode transcript: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create transcript: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save transcript: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codefromthecrypt/practical-genai-go/usage"
+	"github.com/parakeet-nest/parakeet/llm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveTranscript(t *testing.T) {
+	a, err := New("http://localhost:8080", "test-model", testConfig)
+	require.NoError(t, err)
+
+	a.addMessages(
+		llm.Message{Role: "user", Content: "Say hello"},
+		llm.Message{Role: "assistant", ToolCalls: []llm.ToolCall{{Function: llm.FunctionTool{
+			Name:      "shell",
+			Arguments: map[string]interface{}{"command": "echo hello"},
+		}}}},
+		llm.Message{Role: "tool", Content: "hello world"},
+		llm.Message{Role: "assistant", Content: "hello world"},
+	)
+	a.usage = usage.Usage{LLMCalls: 2, PromptTokens: 300, CompletionTokens: 20, ToolCalls: 1, Duration: time.Second}
+
+	path := filepath.Join(t.TempDir(), "session.json")
+	require.NoError(t, a.SaveTranscript(path))
+
+	transcript, err := LoadTranscript(path)
+	require.NoError(t, err)
+	require.Equal(t, TranscriptVersion, transcript.Version)
+	require.Equal(t, "test-model", transcript.Model)
+	require.Equal(t, 1, transcript.UserTurns())
+	require.Len(t, transcript.Messages, 5)
+	require.Equal(t, []TranscriptToolCall{{
+		Name:      "shell",
+		Arguments: map[string]interface{}{"command": "echo hello"},
+	}}, transcript.Messages[2].ToolCalls)
+	require.Equal(t, "shell", transcript.Messages[3].ToolName)
+	require.False(t, transcript.Updated.Before(transcript.Created))
+	require.Equal(t, a.Usage(), transcript.Usage)
+
+	t.Run("resume", func(t *testing.T) {
+		resumed, err := Resume("http://localhost:8080", "", testConfig, transcript)
+		require.NoError(t, err)
+		require.Equal(t, "test-model", resumed.q.Model)
+		require.Equal(t, a.q.Messages, resumed.q.Messages)
+		require.Equal(t, transcript, resumed.Transcript())
+	})
+}
+
+func TestLoadTranscript_unsupportedVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 99}`), 0o644))
+
+	_, err := LoadTranscript(path)
+	require.EqualError(t, err, "unsupported transcript version 99, expected 1")
+}
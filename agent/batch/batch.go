@@ -0,0 +1,203 @@
+package batch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/codefromthecrypt/practical-genai-go/usage"
+)
+
+// Status is the outcome of a task.
+type Status string
+
+const (
+	// StatusSucceeded is when the agent answered.
+	StatusSucceeded Status = "succeeded"
+	// StatusFailed is when the task couldn't start, or the agent failed,
+	// such as the LLM being unavailable.
+	StatusFailed Status = "failed"
+	// StatusBudgetExceeded is when the agent stopped at a limit of the
+	// task's budget.
+	StatusBudgetExceeded Status = "budget_exceeded"
+	// StatusCanceled is when the batch was canceled before the task ended.
+	StatusCanceled Status = "canceled"
+)
+
+// Result is the outcome of a task, written as a line of JSON.
+type Result struct {
+	ID     string `json:"id"`
+	Status Status `json:"status"`
+	// Answer is the final answer of the agent, or what it was doing when it
+	// ran out of budget.
+	Answer string `json:"answer,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// ChangedFiles are the paths, relative to the task directory, of files
+	// added, modified or deleted while the task ran.
+	ChangedFiles []string    `json:"changed_files,omitempty"`
+	Usage        usage.Usage `json:"usage"`
+}
+
+// Runner runs tasks, each with a new agent.
+//
+// Changed files are found by comparing the task directory before and after,
+// so tasks running at the same time in the same directory see each other's
+// changes. Directories named .git are skipped.
+type Runner struct {
+	// URL is the Ollama endpoint and Model the model of the agents.
+	URL, Model string
+	// Config returns the agent config of a task, with tools which run in
+	// dir, limited to tools if any are named. For example, dev.ConfigIn.
+	Config func(dir string, tools ...string) (*agent.Config, error)
+	// Concurrency is how many tasks run at the same time. It defaults to
+	// one.
+	Concurrency int
+	// Budget limits each task, except for any limits the task sets itself.
+	Budget *agent.Budget
+}
+
+// Run runs the tasks, writing each result to w as a line of JSON. Results are
+// written in the order of tasks, as soon as those before them are done.
+//
+// Failed tasks don't stop the others. When ctx is canceled, the tasks left are
+// canceled. Only a failure to write results returns an error.
+func (r *Runner) Run(ctx context.Context, tasks []Task, w io.Writer) ([]Result, error) {
+	results := make([]Result, len(tasks))
+	done := make([]bool, len(tasks))
+	enc := json.NewEncoder(w)
+
+	var mu sync.Mutex
+	var writeErr error
+	next := 0 // the next result to write
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range max(r.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				result := r.run(ctx, tasks[i])
+				mu.Lock()
+				results[i], done[i] = result, true
+				for ; next < len(tasks) && done[next] && writeErr == nil; next++ {
+					writeErr = enc.Encode(results[next])
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range tasks {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results, writeErr
+}
+
+// run runs the task with a new agent.
+func (r *Runner) run(ctx context.Context, t Task) Result {
+	result := Result{ID: t.ID}
+	if err := ctx.Err(); err != nil {
+		result.Status, result.Error = StatusCanceled, err.Error()
+		return result
+	}
+	failed := func(err error) Result {
+		result.Status, result.Error = StatusFailed, err.Error()
+		return result
+	}
+
+	dir := t.Dir
+	if dir == "" {
+		dir = "."
+	}
+	before, err := snapshot(dir)
+	if err != nil {
+		return failed(err)
+	}
+	config, err := r.Config(dir, t.Tools...)
+	if err != nil {
+		return failed(err)
+	}
+	a, err := agent.New(r.URL, r.Model, config)
+	if err != nil {
+		return failed(err)
+	}
+
+	answer, doErr := a.Do(ctx, t.Prompt, &agent.RequestOptions{Budget: t.Budget.apply(r.Budget)})
+	if answer != nil {
+		result.Answer = answer.Content
+	}
+	result.Usage = a.Usage()
+
+	// Tools may have changed files even if the task didn't succeed.
+	after, err := snapshot(dir)
+	if err != nil {
+		return failed(err)
+	}
+	result.ChangedFiles = changed(before, after)
+
+	var budgetErr *agent.BudgetExceededError
+	switch {
+	case doErr == nil:
+		result.Status = StatusSucceeded
+	case errors.As(doErr, &budgetErr):
+		result.Status, result.Error = StatusBudgetExceeded, doErr.Error()
+	case ctx.Err() != nil:
+		result.Status, result.Error = StatusCanceled, doErr.Error()
+	default:
+		result.Status, result.Error = StatusFailed, doErr.Error()
+	}
+	return result
+}
+
+// snapshot returns a hash of each file in dir by its relative path.
+func snapshot(dir string) (map[string][sha256.Size]byte, error) {
+	files := map[string][sha256.Size]byte{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = sha256.Sum256(b)
+		return nil
+	})
+	return files, err
+}
+
+// changed returns the sorted paths which differ between snapshots.
+func changed(before, after map[string][sha256.Size]byte) []string {
+	var paths []string
+	for path, hash := range after {
+		if old, ok := before[path]; !ok || old != hash {
+			paths = append(paths, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
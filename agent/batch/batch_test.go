@@ -0,0 +1,179 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/codefromthecrypt/practical-genai-go/agent/dev"
+	"github.com/codefromthecrypt/practical-genai-go/llmtest"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	log.SetOutput(io.Discard) // the tools log each call
+}
+
+func TestLoadTasks(t *testing.T) {
+	tasks, err := LoadTasks(strings.NewReader(`{"prompt": "say hello"}
+
+{"id": "docs", "prompt": "fix the README", "dir": "docs", "tools": ["read_file", "patch_file"], "budget": {"max_tokens": 1000, "max_duration": "2m"}}
+`))
+	require.NoError(t, err)
+	require.Equal(t, []Task{
+		{ID: "1", Prompt: "say hello"},
+		{
+			ID:     "docs",
+			Prompt: "fix the README",
+			Dir:    "docs",
+			Tools:  []string{"read_file", "patch_file"},
+			Budget: &Budget{MaxTokens: 1000, MaxDuration: Duration(2 * time.Minute)},
+		},
+	}, tasks)
+}
+
+func TestDuration_json(t *testing.T) {
+	b, err := json.Marshal(Budget{MaxDuration: Duration(90 * time.Second)})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"max_duration": "1m30s"}`, string(b))
+
+	var budget Budget
+	require.NoError(t, json.Unmarshal(b, &budget))
+	require.Equal(t, Duration(90*time.Second), budget.MaxDuration)
+}
+
+func TestLoadTasks_invalid(t *testing.T) {
+	tests := []struct {
+		name, tasks, expectedErr string
+	}{
+		{
+			name:        "no prompt",
+			tasks:       `{"id": "a"}`,
+			expectedErr: "line 1: task has no prompt",
+		},
+		{
+			name:        "duplicate id",
+			tasks:       "{\"id\": \"a\", \"prompt\": \"hi\"}\n{\"id\": \"a\", \"prompt\": \"bye\"}",
+			expectedErr: "line 2: duplicate task id a",
+		},
+		{
+			name:        "invalid duration",
+			tasks:       `{"prompt": "hi", "budget": {"max_duration": "soon"}}`,
+			expectedErr: `line 1: failed to parse task: time: invalid duration "soon"`,
+		},
+		{
+			name:        "not JSON",
+			tasks:       `prompt: hi`,
+			expectedErr: "line 1: failed to parse task: invalid character 'p' looking for beginning of value",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := LoadTasks(strings.NewReader(tc.tasks))
+			require.EqualError(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestRunner_Run(t *testing.T) {
+	fixDir, loopDir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(fixDir, "README.md"), []byte("# Helo\n"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(fixDir, ".git"), 0o755))
+
+	ollama := llmtest.NewServer(t,
+		// The first task fixes the README and adds a file.
+		llmtest.ToolCall("patch_file", map[string]any{
+			"path": "README.md", "before": "# Helo", "after": "# Hello",
+		}),
+		llmtest.ToolCall("shell", map[string]any{"command": "touch new.txt .git/index"}),
+		llmtest.Text("Fixed the title."),
+		// The second task runs out of tool calls.
+		llmtest.ToolCall("shell", map[string]any{"command": "echo hello"}),
+		llmtest.ToolCall("shell", map[string]any{"command": "echo again"}),
+		// The third task can't start, so it calls nothing. The fourth fails.
+		llmtest.Error(400),
+	)
+
+	tasks := []Task{
+		{ID: "fix", Prompt: "fix the title", Dir: fixDir},
+		{ID: "loop", Prompt: "say hello", Dir: loopDir, Tools: []string{"shell"}, Budget: &Budget{MaxToolCalls: 1}},
+		{ID: "unknown", Prompt: "say hello", Dir: loopDir, Tools: []string{"browse"}},
+		{ID: "broken", Prompt: "say hello", Dir: loopDir},
+	}
+	runner := &Runner{URL: ollama.URL, Model: "test-model", Config: dev.ConfigIn, Budget: &agent.Budget{MaxToolCalls: 5}}
+	var out bytes.Buffer
+	results, err := runner.Run(context.Background(), tasks, &out)
+	require.NoError(t, err)
+	require.Zero(t, ollama.Remaining())
+
+	var statuses []Status
+	for _, r := range results {
+		statuses = append(statuses, r.Status)
+	}
+	require.Equal(t, []Status{StatusSucceeded, StatusBudgetExceeded, StatusFailed, StatusFailed}, statuses)
+
+	fix := results[0]
+	require.Equal(t, "Fixed the title.", fix.Answer)
+	require.Equal(t, []string{"README.md", "new.txt"}, fix.ChangedFiles)
+	require.Equal(t, 2, fix.Usage.ToolCalls)
+
+	require.True(t, strings.HasPrefix(results[1].Error, "tool calls budget exceeded: "), results[1].Error)
+	require.Equal(t, "unknown tool: browse", results[2].Error)
+	require.NotEmpty(t, results[3].Error)
+
+	// Only the allowed tools were offered.
+	require.Equal(t, []string{"shell"}, ollama.Requests()[3].Tools)
+
+	// Results are written in task order, one per line.
+	var decoded []Result
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var r Result
+		require.NoError(t, dec.Decode(&r))
+		decoded = append(decoded, r)
+	}
+	require.Equal(t, results, decoded)
+}
+
+func TestRunner_Run_concurrency(t *testing.T) {
+	var replies []llmtest.Reply
+	var tasks []Task
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		replies = append(replies, llmtest.Text("done"))
+		tasks = append(tasks, Task{ID: id, Prompt: "say done", Dir: t.TempDir()})
+	}
+	ollama := llmtest.NewServer(t, replies...)
+
+	runner := &Runner{URL: ollama.URL, Model: "test-model", Config: dev.ConfigIn, Concurrency: 3}
+	var out bytes.Buffer
+	_, err := runner.Run(context.Background(), tasks, &out)
+	require.NoError(t, err)
+
+	var ids []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var r Result
+		require.NoError(t, json.Unmarshal([]byte(line), &r))
+		require.Equal(t, StatusSucceeded, r.Status)
+		ids = append(ids, r.ID)
+	}
+	require.Equal(t, []string{"a", "b", "c", "d", "e"}, ids)
+}
+
+func TestRunner_Run_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	runner := &Runner{URL: "http://127.0.0.1:1", Model: "test-model", Config: dev.ConfigIn}
+	results, err := runner.Run(ctx, []Task{{ID: "1", Prompt: "hello"}}, io.Discard)
+	require.NoError(t, err)
+	require.Equal(t, []Result{{ID: "1", Status: StatusCanceled, Error: "context canceled"}}, results)
+}
@@ -0,0 +1,117 @@
+// Package batch runs an agent over tasks without anyone watching, such as in
+// CI to apply the same change across many directories. Each task gets a fresh
+// agent, working in its own directory, and its outcome is written as a line
+// of JSON.
+package batch
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+)
+
+// Task is a request for the agent, read from a line of JSON, such as:
+//
+//	{"id": "api", "prompt": "Add a LICENSE file", "dir": "services/api", "tools": ["write_file"]}
+type Task struct {
+	// ID identifies the task in results. It defaults to the line number.
+	ID string `json:"id,omitempty"`
+	// Prompt is what the user asks the agent to do.
+	Prompt string `json:"prompt"`
+	// Dir is the working directory of the agent's tools. It defaults to the
+	// working directory of the process.
+	Dir string `json:"dir,omitempty"`
+	// Tools are the names of the tools the agent may use, such as
+	// "read_file". All tools are allowed when empty.
+	Tools []string `json:"tools,omitempty"`
+	// Budget limits the task, replacing any limits of Runner.Budget it sets.
+	Budget *Budget `json:"budget,omitempty"`
+}
+
+// Budget is agent.Budget in JSON.
+type Budget struct {
+	MaxTokens    int      `json:"max_tokens,omitempty"`
+	MaxDuration  Duration `json:"max_duration,omitempty"`
+	MaxToolCalls int      `json:"max_tool_calls,omitempty"`
+}
+
+// Duration is a time.Duration written as a string in JSON, such as "2m".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// apply returns a copy of budget with any limits set in b replaced.
+func (b *Budget) apply(budget *agent.Budget) *agent.Budget {
+	if b == nil {
+		return budget
+	}
+	if budget == nil {
+		budget = &agent.Budget{}
+	} else {
+		copied := *budget
+		budget = &copied
+	}
+	if b.MaxTokens > 0 {
+		budget.MaxTokens = b.MaxTokens
+	}
+	if b.MaxDuration > 0 {
+		budget.MaxDuration = time.Duration(b.MaxDuration)
+	}
+	if b.MaxToolCalls > 0 {
+		budget.MaxToolCalls = b.MaxToolCalls
+	}
+	return budget
+}
+
+// LoadTasks reads a task from each line of r, skipping blank lines.
+func LoadTasks(r io.Reader) ([]Task, error) {
+	var tasks []Task
+	ids := map[string]bool{}
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1024*1024) // prompts can be long
+	for line := 1; s.Scan(); line++ {
+		if strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+		var t Task
+		if err := json.Unmarshal(s.Bytes(), &t); err != nil {
+			return nil, fmt.Errorf("line %d: failed to parse task: %w", line, err)
+		}
+		if t.Prompt == "" {
+			return nil, fmt.Errorf("line %d: task has no prompt", line)
+		}
+		if t.ID == "" {
+			t.ID = strconv.Itoa(line)
+		}
+		if ids[t.ID] {
+			return nil, fmt.Errorf("line %d: duplicate task id %s", line, t.ID)
+		}
+		ids[t.ID] = true
+		tasks = append(tasks, t)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tasks: %w", err)
+	}
+	return tasks, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/codefromthecrypt/practical-genai-go/agent/dev"
+	"github.com/codefromthecrypt/practical-genai-go/agent/eval"
+	"github.com/codefromthecrypt/practical-genai-go/telemetry"
+)
+
+// main evaluates the dev agent against scenarios, so that you can tell if a
+// change to its system prompt, or a different model, makes it better or
+// worse. For example, to compare two models:
+//
+//	go run ./agent/cmd/eval -runs 5 -model qwen2.5:14b -json 14b.json
+//	go run ./agent/cmd/eval -runs 5 -model qwen2.5:7b -json 7b.json
+//
+// The report is printed as markdown, and written as JSON with -json.
+func main() {
+	scenarios := flag.String("scenarios", "agent/eval/scenarios", "directory "+
+		"of scenarios, each a directory with a scenario.json.")
+	url := flag.String("url", "http://localhost:11434", "Ollama endpoint")
+	model := flag.String("model", "qwen2.5:14b", "model to evaluate")
+	runs := flag.Int("runs", 3, "times to run each scenario, as answers vary.")
+	deterministic := flag.Bool("deterministic", false, "use a zero "+
+		"temperature and fixed seed. Use -runs 1 with this, as each run "+
+		"gives the same answer.")
+	jsonOut := flag.String("json", "", "file to write the report to as JSON.")
+	maxToolCalls := flag.Int("max-tool-calls", 20, "fail a run after it "+
+		"runs this many tools. Zero is unlimited.")
+	maxDuration := flag.Duration("max-duration", 5*time.Minute, "fail a run "+
+		"after this long. Zero is unlimited.")
+	minPassRate := flag.Float64("min-pass-rate", 0, "exit with an error "+
+		"when fewer runs pass than this ratio, such as 0.8 in CI.")
+	flag.Parse()
+
+	shutdown, err := telemetry.Setup(context.Background(), "eval")
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	defer shutdown(context.Background())
+
+	loaded, err := eval.LoadScenarios(*scenarios)
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+
+	config := *dev.AgentConfig
+	if *deterministic {
+		config.Options = agent.Deterministic(config.Options)
+	}
+	runner := &eval.Runner{
+		URL:    *url,
+		Model:  *model,
+		Config: &config,
+		Runs:   *runs,
+		Budget: &agent.Budget{MaxToolCalls: *maxToolCalls, MaxDuration: *maxDuration},
+	}
+
+	// Stop on Ctrl+C, without leaving the working directory changed.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, err := runner.Run(ctx, loaded)
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+
+	if *jsonOut != "" {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatal("😡:", err)
+		}
+		if err = os.WriteFile(*jsonOut, b, 0o644); err != nil {
+			log.Fatal("😡:", err)
+		}
+	}
+	if err = report.WriteMarkdown(os.Stdout); err != nil {
+		log.Fatal("😡:", err)
+	}
+	if report.PassRate < *minPassRate {
+		log.Fatal("😡:", fmt.Errorf("pass rate %.2f is below %.2f", report.PassRate, *minPassRate))
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/codefromthecrypt/practical-genai-go/agent/dev"
+	"github.com/codefromthecrypt/practical-genai-go/agent/mcp"
+	"github.com/codefromthecrypt/practical-genai-go/telemetry"
+)
+
+// main serves the dev tools to other agents as an MCP server over stdio. For
+// example, add it to the MCP config of another agent like this:
+//
+//	{
+//	  "mcpServers": {
+//	    "dev": {"command": "go", "args": ["run", "./agent/cmd/mcp-server"]}
+//	  }
+//	}
+//
+// stdout is reserved for MCP messages, so the tools log to stderr.
+func main() {
+	shutdown, err := telemetry.Setup(context.Background(), "mcp-server")
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	defer shutdown(context.Background())
+
+	toolbox, err := agent.NewToolbox(dev.AgentConfig)
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	if err = mcp.Serve(context.Background(), "dev", "0.1.0", toolbox, os.Stdin, os.Stdout); err != nil {
+		log.Fatal("😡:", err)
+	}
+}
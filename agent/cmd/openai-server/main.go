@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/codefromthecrypt/practical-genai-go/agent/dev"
+	"github.com/codefromthecrypt/practical-genai-go/agent/server"
+	"github.com/codefromthecrypt/practical-genai-go/metrics"
+	"github.com/codefromthecrypt/practical-genai-go/telemetry"
+)
+
+// main serves the dev agent over an OpenAI-compatible API. Point any OpenAI
+// client at it, for example:
+//
+//	curl http://localhost:8000/v1/chat/completions -d '{
+//	  "model": "dev-agent",
+//	  "messages": [{"role": "user", "content": "What files are in the current directory?"}]
+//	}'
+//
+// Prometheus metrics, such as LLM latency by model, are served on /metrics.
+func main() {
+	addr := flag.String("addr", "localhost:8000", "address to listen on")
+	idleTimeout := flag.Duration("idle-timeout", 30*time.Minute, "discard sessions idle for this long")
+	flag.Parse()
+
+	url := "http://localhost:11434"
+	model := "qwen2.5:14b"
+
+	shutdown, err := telemetry.Setup(context.Background(), "openai-server")
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	defer shutdown(context.Background())
+
+	// The dev tools don't keep state, so each session can share them.
+	sessions := agent.NewSessionManager(url, model, func(string) *agent.Config {
+		return dev.AgentConfig
+	}, *idleTimeout)
+	defer sessions.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/", server.New(sessions, "dev-agent"))
+
+	log.Printf("Serving dev-agent on http://%s/v1", *addr)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		log.Fatal("😡:", err)
+	}
+}
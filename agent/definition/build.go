@@ -0,0 +1,180 @@
+package definition
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/codefromthecrypt/practical-genai-go/agent/dev"
+	"github.com/codefromthecrypt/practical-genai-go/agent/mcp"
+	"github.com/codefromthecrypt/practical-genai-go/agent/redact"
+	"github.com/codefromthecrypt/practical-genai-go/guard"
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// New starts any MCP servers, and returns the agent with a function which
+// stops them.
+func (d *Definition) New(ctx context.Context) (*agent.Agent, func(), error) {
+	config, err := d.Config()
+	if err != nil {
+		return nil, nil, err
+	}
+	clients, err := mcp.StartAll(ctx, d.Servers())
+	if err != nil {
+		return nil, nil, err
+	}
+	stop := func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}
+	for _, client := range clients {
+		config.Toolboxes = append(config.Toolboxes, client)
+	}
+	a, err := agent.New(d.URL, d.Model, config)
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+	return a, stop, nil
+}
+
+// Config returns the config of the agent, without tools of MCP servers.
+func (d *Definition) Config() (*agent.Config, error) {
+	config := &agent.Config{
+		SystemPrompt: d.SystemPrompt,
+		// Only the functions in Tools are offered, so no tools is fine.
+		ToolSource:   dev.AgentConfig.ToolSource,
+		Tools:        map[string]reflect.Value{},
+		Options:      d.Options.llm(),
+		ToolProtocol: agent.ToolProtocol(d.ToolProtocol),
+		Retry: agent.RetryPolicy{
+			MaxAttempts:    d.Retry.MaxAttempts,
+			InitialBackoff: d.Retry.InitialBackoff,
+			MaxBackoff:     d.Retry.MaxBackoff,
+		},
+	}
+	if len(d.Tools) > 0 {
+		builtin, err := dev.ConfigIn("", slices.Sorted(maps.Keys(d.Tools))...)
+		if err != nil {
+			return nil, err
+		}
+		config.Tools = builtin.Tools
+	}
+	for _, f := range d.Fallbacks {
+		config.Fallbacks = append(config.Fallbacks, agent.Endpoint{URL: f.URL, Model: f.Model})
+	}
+
+	config.ToolMiddleware = []agent.ToolMiddleware{agent.LogTools(slog.Default()), d.policies()}
+	if d.guarded() {
+		config.SystemPrompt = strings.TrimRight(config.SystemPrompt, "\n") + "\n" + guard.SystemPrompt
+	}
+	return config, nil
+}
+
+// Servers returns the MCP servers, sorted so that tools are listed in a
+// consistent order.
+func (d *Definition) Servers() []mcp.ServerConfig {
+	var servers []mcp.ServerConfig
+	for _, name := range slices.Sorted(maps.Keys(d.MCPServers)) {
+		s := d.MCPServers[name]
+		servers = append(servers, mcp.ServerConfig{Name: name, Command: s.Command, Args: s.Args, Env: s.Env})
+	}
+	return servers
+}
+
+// RequestOptions returns options for Agent.Do with the budget.
+func (d *Definition) RequestOptions() *agent.RequestOptions {
+	return &agent.RequestOptions{Budget: &agent.Budget{
+		MaxTokens:    d.Budget.MaxTokens,
+		MaxDuration:  d.Budget.MaxDuration,
+		MaxToolCalls: d.Budget.MaxToolCalls,
+		WarnAt:       d.Budget.WarnAt,
+	}}
+}
+
+func (o Options) llm() llm.Options {
+	numCtx := o.NumCtx
+	if numCtx == 0 {
+		numCtx = dev.AgentConfig.Options.NumCtx
+	}
+	return llm.Options{
+		Temperature:   o.Temperature,
+		TopK:          o.TopK,
+		TopP:          o.TopP,
+		Seed:          o.Seed,
+		NumCtx:        numCtx,
+		NumPredict:    o.NumPredict,
+		RepeatPenalty: o.RepeatPenalty,
+		RepeatLastN:   o.RepeatLastN,
+		Stop:          o.Stop,
+	}
+}
+
+// guarded returns true if any tool output is guarded, so the LLM needs to be
+// told what the delimiters mean.
+func (d *Definition) guarded() bool {
+	if d.Policy.Guard != "off" {
+		return true
+	}
+	for _, p := range d.Tools {
+		if p.Guard != "" && p.Guard != "off" {
+			return true
+		}
+	}
+	return false
+}
+
+// policies applies the policy of each built-in tool to its output, and
+// Policy to others, such as tools of MCP servers.
+func (d *Definition) policies() agent.ToolMiddleware {
+	// Share a redactor, so that a secret gets the same mask from any tool.
+	redactor := redact.Default()
+	return func(next agent.ToolHandler) agent.ToolHandler {
+		handlers := map[string]agent.ToolHandler{}
+		for name, p := range d.Tools {
+			handlers[name] = d.Policy.merge(p).wrap(next, redactor)
+		}
+		other := d.Policy.wrap(next, redactor)
+		return func(ctx context.Context, toolCall llm.FunctionTool) (string, error) {
+			if h, ok := handlers[toolCall.Name]; ok {
+				return h(ctx, toolCall)
+			}
+			return other(ctx, toolCall)
+		}
+	}
+}
+
+// merge returns p with the fields set in override replaced.
+func (p Policy) merge(override Policy) Policy {
+	if override.Guard != "" {
+		p.Guard = override.Guard
+	}
+	if override.Redact != nil {
+		p.Redact = override.Redact
+	}
+	if override.MaxOutputBytes != 0 {
+		p.MaxOutputBytes = override.MaxOutputBytes
+	}
+	return p
+}
+
+// wrap returns next with the policy applied. Secrets are redacted first, so
+// truncation can't leave part of one, and guarding is last, so truncation
+// can't cut off its delimiters.
+func (p Policy) wrap(next agent.ToolHandler, redactor *redact.Redactor) agent.ToolHandler {
+	if p.Redact == nil || *p.Redact {
+		next = redactor.ToolMiddleware()(next)
+	}
+	if p.MaxOutputBytes > 0 {
+		next = agent.TruncateOutput(p.MaxOutputBytes)(next)
+	}
+	if p.Guard != "off" {
+		next = guard.New(guard.Policy{Action: guardActions[p.Guard]}).ToolMiddleware()(next)
+	}
+	return next
+}
@@ -0,0 +1,305 @@
+// Package definition builds agents described in YAML, instead of in Go. For
+// example, an agent which reviews code, but can't change it:
+//
+//	name: reviewer
+//	model: qwen2.5:14b
+//	system_prompt_file: reviewer.md
+//	tools:
+//	  read_file:
+//	    guard: block
+//	budget:
+//	  max_tool_calls: 10
+//	  max_duration: 2m
+//
+// Mistakes, such as an unknown tool or a misspelled key, are reported with the
+// line they are on.
+package definition
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/codefromthecrypt/practical-genai-go/agent/dev"
+	"github.com/codefromthecrypt/practical-genai-go/guard"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultURL is the Ollama endpoint of definitions without a url.
+const DefaultURL = "http://localhost:11434"
+
+// Definition describes an agent.
+type Definition struct {
+	// Name identifies the agent, such as in logs.
+	Name string `yaml:"name"`
+	// Model is the Ollama model, such as qwen2.5:14b. It is required.
+	Model string `yaml:"model"`
+	// URL is the Ollama endpoint. It defaults to DefaultURL.
+	URL string `yaml:"url"`
+	// SystemPrompt is the system prompt, or SystemPromptFile a file to read
+	// it from, relative to the definition. Load reads the file into
+	// SystemPrompt.
+	SystemPrompt     string `yaml:"system_prompt"`
+	SystemPromptFile string `yaml:"system_prompt_file"`
+	// Options tune the model.
+	Options Options `yaml:"options"`
+	// ToolProtocol is native or react. By default, it is decided by whether
+	// the model supports tools.
+	ToolProtocol string `yaml:"tool_protocol"`
+	// Retry retries LLM calls which fail with a transient error.
+	Retry Retry `yaml:"retry"`
+	// Fallbacks are tried in order when the model is unavailable.
+	Fallbacks []Fallback `yaml:"fallbacks"`
+	// Policy applies to the output of all tools, unless a tool has its own.
+	Policy Policy `yaml:"policy"`
+	// Tools are the built-in tools to enable, such as read_file, by name.
+	// Each can have a policy, replacing any fields of Policy it sets.
+	Tools map[string]Policy `yaml:"tools"`
+	// MCPServers are servers whose tools the agent can use, by name.
+	MCPServers map[string]MCPServer `yaml:"mcp_servers"`
+	// Budget limits each request.
+	Budget Budget `yaml:"budget"`
+}
+
+// Options are llm.Options. NumCtx defaults to that of the dev agent, as
+// Ollama's default is too small for tool results.
+type Options struct {
+	Temperature   float64  `yaml:"temperature"`
+	TopK          int      `yaml:"top_k"`
+	TopP          float64  `yaml:"top_p"`
+	Seed          int      `yaml:"seed"`
+	NumCtx        int      `yaml:"num_ctx"`
+	NumPredict    int      `yaml:"num_predict"`
+	RepeatPenalty float64  `yaml:"repeat_penalty"`
+	RepeatLastN   int      `yaml:"repeat_last_n"`
+	Stop          []string `yaml:"stop"`
+}
+
+// Retry is agent.RetryPolicy.
+type Retry struct {
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+// Fallback is agent.Endpoint.
+type Fallback struct {
+	URL   string `yaml:"url"`
+	Model string `yaml:"model"`
+}
+
+// Policy decides what happens to the output of a tool before the LLM reads
+// it.
+type Policy struct {
+	// Guard is what to do with output that looks like a prompt injection:
+	// annotate, quarantine, block or off. It defaults to annotate.
+	Guard string `yaml:"guard"`
+	// Redact masks secrets, such as API keys. It defaults to true.
+	Redact *bool `yaml:"redact"`
+	// MaxOutputBytes truncates longer output. Zero is unlimited.
+	MaxOutputBytes int `yaml:"max_output_bytes"`
+}
+
+// MCPServer is mcp.ServerConfig.
+type MCPServer struct {
+	Command string            `yaml:"command"`
+	Args    []string          `yaml:"args"`
+	Env     map[string]string `yaml:"env"`
+}
+
+// Budget is agent.Budget.
+type Budget struct {
+	MaxTokens    int           `yaml:"max_tokens"`
+	MaxDuration  time.Duration `yaml:"max_duration"`
+	MaxToolCalls int           `yaml:"max_tool_calls"`
+	WarnAt       float64       `yaml:"warn_at"`
+}
+
+// guardActions are the values of Policy.Guard, except "off".
+var guardActions = map[string]guard.Action{
+	"":           guard.Annotate,
+	"annotate":   guard.Annotate,
+	"quarantine": guard.Quarantine,
+	"block":      guard.Block,
+}
+
+// Error is a mistake in a definition, at a line of its file.
+type Error struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Message)
+}
+
+// Load reads a definition from a YAML file. If it is invalid, the error joins
+// an *Error for each mistake.
+func Load(path string) (*Definition, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read agent definition: %w", err)
+	}
+	// Decode twice: the nodes have the line of each value, and the decoder
+	// rejects unknown keys.
+	var root yaml.Node
+	if err = yaml.Unmarshal(b, &root); err != nil {
+		return nil, yamlError(path, err)
+	}
+	var d Definition
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err = dec.Decode(&d); err != nil && !errors.Is(err, io.EOF) {
+		return nil, yamlError(path, err)
+	}
+	if err = d.validate(path, &root); err != nil {
+		return nil, err
+	}
+	if d.URL == "" {
+		d.URL = DefaultURL
+	}
+	d.URL = strings.TrimSuffix(d.URL, "/")
+	return &d, nil
+}
+
+// validate checks what YAML can't, and reads SystemPromptFile.
+func (d *Definition) validate(path string, root *yaml.Node) error {
+	var errs []*Error
+	invalid := func(message string, keys ...string) {
+		errs = append(errs, &Error{Path: path, Line: line(root, keys...), Message: message})
+	}
+	checkPolicy := func(p Policy, keys ...string) {
+		if _, ok := guardActions[p.Guard]; !ok && p.Guard != "off" {
+			invalid(fmt.Sprintf("unknown guard %q, expected annotate, quarantine, block or off", p.Guard), append(keys, "guard")...)
+		}
+		if p.MaxOutputBytes < 0 {
+			invalid("max_output_bytes can't be negative", append(keys, "max_output_bytes")...)
+		}
+	}
+
+	if d.Model == "" {
+		invalid("model is required")
+	}
+	if d.SystemPromptFile != "" {
+		if d.SystemPrompt != "" {
+			invalid("set system_prompt or system_prompt_file, not both", "system_prompt_file")
+		} else if b, err := os.ReadFile(relativeTo(path, d.SystemPromptFile)); err != nil {
+			invalid(err.Error(), "system_prompt_file")
+		} else {
+			d.SystemPrompt = string(b)
+		}
+	}
+	switch agent.ToolProtocol(d.ToolProtocol) {
+	case agent.ToolProtocolAuto, agent.ToolProtocolNative, agent.ToolProtocolReAct:
+	default:
+		invalid(fmt.Sprintf("unknown tool_protocol %q, expected native or react", d.ToolProtocol), "tool_protocol")
+	}
+	for i, f := range d.Fallbacks {
+		if f.Model == "" && f.URL == "" {
+			invalid("fallback needs a model or url", "fallbacks", strconv.Itoa(i))
+		}
+	}
+	checkPolicy(d.Policy, "policy")
+	builtin := slices.Sorted(maps.Keys(dev.AgentConfig.Tools))
+	for _, name := range slices.Sorted(maps.Keys(d.Tools)) {
+		if !slices.Contains(builtin, name) {
+			invalid(fmt.Sprintf("unknown tool %s, expected one of %s", name, strings.Join(builtin, ", ")), "tools", name)
+			continue
+		}
+		checkPolicy(d.Tools[name], "tools", name)
+	}
+	for _, name := range slices.Sorted(maps.Keys(d.MCPServers)) {
+		if d.MCPServers[name].Command == "" {
+			invalid(fmt.Sprintf("MCP server %s has no command", name), "mcp_servers", name)
+		}
+	}
+	if d.Budget.WarnAt < 0 || d.Budget.WarnAt > 1 {
+		invalid("warn_at must be between 0 and 1", "budget", "warn_at")
+	}
+
+	// Report mistakes from the top of the file down.
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+	joined := make([]error, len(errs))
+	for i, err := range errs {
+		joined[i] = err
+	}
+	return errors.Join(joined...)
+}
+
+// relativeTo returns path relative to the directory of the definition at
+// definitionPath, unless path is absolute.
+func relativeTo(definitionPath, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(definitionPath), path)
+}
+
+// line returns the line of the key at keys, such as "tools", "shell", or of
+// the closest parent present, so that a missing key is reported where it
+// belongs. Sequence items are keyed by index.
+func line(n *yaml.Node, keys ...string) int {
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	l := n.Line
+	for _, key := range keys {
+		found := false
+		switch n.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == key {
+					l, n, found = n.Content[i].Line, n.Content[i+1], true
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(key); err == nil && i < len(n.Content) {
+				l, n, found = n.Content[i].Line, n.Content[i], true
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return max(l, 1)
+}
+
+var (
+	// yamlLine matches the line yaml.v3 puts at the start of errors.
+	yamlLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): `)
+	// unknownField matches the error for unknown keys, which names Go types.
+	unknownField = regexp.MustCompile(`field (\S+) not found in type \S+`)
+)
+
+// yamlError converts an error from yaml.v3 to an *Error for each mistake.
+func yamlError(path string, err error) error {
+	messages := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+	errs := make([]error, 0, len(messages))
+	for _, message := range messages {
+		l := 1
+		if m := yamlLine.FindStringSubmatch(message); m != nil {
+			l, _ = strconv.Atoi(m[1])
+			message = message[len(m[0]):]
+		}
+		message = unknownField.ReplaceAllString(message, "unknown key $1")
+		errs = append(errs, &Error{Path: path, Line: l, Message: message})
+	}
+	return errors.Join(errs...)
+}
@@ -6,7 +6,7 @@ package dev
 import (
 	_ "embed"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -14,12 +14,38 @@ import (
 	"strings"
 
 	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/codefromthecrypt/practical-genai-go/agent/redact"
+	"github.com/codefromthecrypt/practical-genai-go/guard"
+	"github.com/parakeet-nest/parakeet/llm"
 )
 
 var AgentConfig = &agent.Config{
-	SystemPrompt: systemPrompt,
-	ToolSource:   toolSource,
-	Tools:        tools,
+	SystemPrompt:   systemPrompt + guard.SystemPrompt,
+	ToolSource:     toolSource,
+	Tools:          tools,
+	ToolMiddleware: toolMiddleware(),
+	// Ollama defaults to a 2048 token context, which tool definitions and a
+	// file or two overflow. When that happens, the start of the conversation
+	// is dropped, and with it the system prompt describing the tools.
+	Options: llm.Options{NumCtx: 8192},
+	// Ollama may be loading the model or busy with another request. Retry
+	// rather than lose the work done so far.
+	Retry: agent.RetryPolicy{MaxAttempts: 3},
+}
+
+// toolMiddleware returns new middleware for the tools, so that agents which
+// should be independent, such as tasks in a batch, don't share their state.
+func toolMiddleware() []agent.ToolMiddleware {
+	return []agent.ToolMiddleware{
+		// Log each call, after the results below are guarded and redacted.
+		agent.LogTools(slog.Default()),
+		// Files and command output may contain instructions meant to hijack
+		// the agent. Mark them as untrusted, warning when they look suspicious.
+		guard.New(guard.Policy{Action: guard.Annotate}).ToolMiddleware(),
+		// ReadFile and Shell can read secrets, such as .env files or
+		// environment variables. Mask them before they are sent to the LLM.
+		redact.Default().ToolMiddleware(),
+	}
 }
 
 //go:embed system_prompt.md
@@ -56,13 +82,17 @@ func getLanguage(path string) string {
 //   - command: The Shell command to run. It can support multiline
 //     statements, if you need to run more than one at a time.
 func Shell(command string) (string, error) {
-	log.Printf("Shell Command:\n```bash\n%s\n```", command)
-	output, err := exec.Command("sh", "-c", command).CombinedOutput()
+	return shell("", command)
+}
+
+// shell is Shell, run in dir, or the working directory when empty.
+func shell(dir, command string) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
 	if err != nil {
-		log.Printf("Command failed: %s", err)
 		return "", fmt.Errorf("command failed: %w", err)
 	}
-	log.Printf("Command succeeded:\n%s", string(output))
 	return string(output), nil
 }
 
@@ -71,9 +101,12 @@ func Shell(command string) (string, error) {
 // Parameters:
 //   - path: The path to the file, in the format "path/to/file.txt"
 func ReadFile(path string) (string, error) {
-	log.Printf("Reading file: %s\n", path)
+	return readFile("", path)
+}
 
-	expandedPath, err := filepath.Abs(path)
+// readFile is ReadFile, with a relative path in dir.
+func readFile(dir, path string) (string, error) {
+	expandedPath, err := filepath.Abs(inDir(dir, path))
 	if err != nil {
 		return "", fmt.Errorf("failed to expand path: %w", err)
 	}
@@ -84,10 +117,7 @@ func ReadFile(path string) (string, error) {
 	}
 
 	language := getLanguage(path)
-	md := fmt.Sprintf("```%s\n%s\n```", language, string(content))
-	log.Printf("Successfully read file:\n%s\n", md)
-
-	return md, nil
+	return fmt.Sprintf("```%s\n%s\n```", language, string(content)), nil
 }
 
 // WriteFile writes a file at the specified path with the provided content.
@@ -98,23 +128,19 @@ func ReadFile(path string) (string, error) {
 //   - path: The destination file path, in the format "path/to/file.txt"
 //   - content: The raw file content.
 func WriteFile(path string, content string) (string, error) {
-	log.Printf("Writing file: %s\n", path)
-
-	// Get the programming language for syntax highlighting in logs
-	language := getLanguage(path)
-	md := fmt.Sprintf("```%s\n%s\n```", language, content)
-
-	// Log the content that will be written to the file
-	log.Println(md)
+	return writeFile("", path, content)
+}
 
+// writeFile is WriteFile, with a relative path in dir.
+func writeFile(dir, path, content string) (string, error) {
 	// Prepare the path and create any necessary parent directories
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
+	fullPath := inDir(dir, path)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
 		return "", fmt.Errorf("failed to create directory: %w", err)
 	}
 
 	// Write the content to the file
-	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+	if err := os.WriteFile(fullPath, []byte(content), 0o644); err != nil {
 		return "", fmt.Errorf("failed to write file: %w", err)
 	}
 
@@ -132,9 +158,12 @@ func WriteFile(path string, content string) (string, error) {
 //   - before: The content that will be replaced
 //   - after: The content it will be replaced with
 func PatchFile(path, before, after string) (string, error) {
-	log.Printf("Patching file: %s\n", path)
+	return patchFile("", path, before, after)
+}
 
-	expandedPath, err := filepath.Abs(path)
+// patchFile is PatchFile, with a relative path in dir.
+func patchFile(dir, path, before, after string) (string, error) {
+	expandedPath, err := filepath.Abs(inDir(dir, path))
 	if err != nil {
 		return "", fmt.Errorf("failed to expand path: %w", err)
 	}
@@ -158,9 +187,5 @@ func PatchFile(path, before, after string) (string, error) {
 		return "", fmt.Errorf("failed to write file: %w", err)
 	}
 
-	language := getLanguage(path)
-	md := fmt.Sprintf("```%s\n%s\n```\n->\n```%s\n%s\n```", language, before, language, after)
-	log.Println(md)
-
 	return "Successfully replaced before with after.", nil
 }
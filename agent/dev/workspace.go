@@ -0,0 +1,81 @@
+package dev
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/codefromthecrypt/practical-genai-go/guard"
+)
+
+// ConfigIn returns a copy of AgentConfig whose tools run in dir, instead of
+// the working directory of the process. This allows agents to work in
+// different directories at the same time. Absolute paths, or those with "..",
+// can still reach outside dir.
+//
+// When tools are named, such as "read_file", only those are allowed, and the
+// system prompt only mentions them. Each call has its own tool middleware, so
+// that agents in different directories don't share a guard or redactor.
+func ConfigIn(dir string, tools ...string) (*agent.Config, error) {
+	all := map[string]reflect.Value{
+		"shell": reflect.ValueOf(func(command string) (string, error) {
+			return shell(dir, command)
+		}),
+		"read_file": reflect.ValueOf(func(path string) (string, error) {
+			return readFile(dir, path)
+		}),
+		"write_file": reflect.ValueOf(func(path string, content string) (string, error) {
+			return writeFile(dir, path, content)
+		}),
+		"patch_file": reflect.ValueOf(func(path, before, after string) (string, error) {
+			return patchFile(dir, path, before, after)
+		}),
+	}
+
+	config := *AgentConfig
+	config.Tools = all
+	config.ToolMiddleware = toolMiddleware()
+	if len(tools) > 0 {
+		config.Tools = map[string]reflect.Value{}
+		for _, name := range tools {
+			fn, ok := all[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown tool: %s", name)
+			}
+			config.Tools[name] = fn
+		}
+		if len(config.Tools) < len(all) {
+			config.SystemPrompt = restrictedPrompt(slices.Sorted(maps.Keys(config.Tools))) + guard.SystemPrompt
+		}
+	}
+	return &config, nil
+}
+
+// restrictedPrompt is the system prompt of an agent which can only use the
+// tools named. The default one tells the LLM to use the shell and file tools,
+// which would have it call tools it doesn't have.
+func restrictedPrompt(tools []string) string {
+	return fmt.Sprintf(`Your role is a developer agent. You build software and solve problems using
+only these tools: %s. No other tools are available.
+
+If a tool edits a file, read its existing content first.
+
+# Instructions
+
+Analyze the request and immediately start using your tools as needed. Do not await
+confirmation from the user. If the request can't be done with your tools, say so.
+`, strings.Join(tools, ", "))
+}
+
+// inDir returns path joined to dir, unless either is empty or path is
+// absolute.
+func inDir(dir, path string) string {
+	if dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
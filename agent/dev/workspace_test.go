@@ -0,0 +1,88 @@
+package dev
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigIn(t *testing.T) {
+	dir := t.TempDir()
+	config, err := ConfigIn(dir)
+	require.NoError(t, err)
+	tools, err := agent.NewToolbox(config)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = tools.CallTool(ctx, "write_file", map[string]any{"path": "docs/README.md", "content": "Hello, World!"})
+	require.NoError(t, err)
+	b, err := os.ReadFile(filepath.Join(dir, "docs", "README.md"))
+	require.NoError(t, err)
+	require.Equal(t, "Hello, World!", string(b))
+
+	_, err = tools.CallTool(ctx, "patch_file", map[string]any{"path": "docs/README.md", "before": "World", "after": "Gopher"})
+	require.NoError(t, err)
+	out, err := tools.CallTool(ctx, "read_file", map[string]any{"path": "docs/README.md"})
+	require.NoError(t, err)
+	require.Contains(t, out, "Hello, Gopher!")
+
+	out, err = tools.CallTool(ctx, "shell", map[string]any{"command": "ls docs"})
+	require.NoError(t, err)
+	require.Contains(t, out, "README.md")
+
+	// The shared config still uses the working directory.
+	require.Len(t, AgentConfig.Tools, 4)
+	_, err = os.Stat("docs")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestConfigIn_tools(t *testing.T) {
+	config, err := ConfigIn(t.TempDir(), "read_file", "shell")
+	require.NoError(t, err)
+	tools, err := agent.NewToolbox(config)
+	require.NoError(t, err)
+
+	list, err := tools.ListTools(context.Background())
+	require.NoError(t, err)
+	var names []string
+	for _, tool := range list {
+		names = append(names, tool.Function.Name)
+	}
+	require.ElementsMatch(t, []string{"read_file", "shell"}, names)
+
+	// The prompt only mentions the tools allowed, unlike the default one.
+	require.Contains(t, config.SystemPrompt, "only these tools: read_file, shell.")
+	require.NotContains(t, config.SystemPrompt, "write_file")
+	require.Contains(t, config.SystemPrompt, "<untrusted-content>")
+
+	// Naming all tools is the same as naming none.
+	config, err = ConfigIn(t.TempDir(), "shell", "read_file", "write_file", "patch_file")
+	require.NoError(t, err)
+	require.Equal(t, AgentConfig.SystemPrompt, config.SystemPrompt)
+
+	_, err = ConfigIn(t.TempDir(), "delete_file")
+	require.EqualError(t, err, "unknown tool: delete_file")
+}
+
+func TestConfigIn_middleware(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("Hello"), 0o644))
+
+	// Each config has its own guard, so their delimiters differ.
+	var results []string
+	for range 2 {
+		config, err := ConfigIn(dir)
+		require.NoError(t, err)
+		tools, err := agent.NewToolbox(config)
+		require.NoError(t, err)
+		out, err := tools.CallTool(context.Background(), "read_file", map[string]any{"path": "README.md"})
+		require.NoError(t, err)
+		require.Contains(t, out, "<untrusted-content id=")
+		results = append(results, out)
+	}
+	require.NotEqual(t, results[0], results[1])
+}
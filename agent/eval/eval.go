@@ -0,0 +1,190 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/codefromthecrypt/practical-genai-go/usage"
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// Runner runs scenarios against a model.
+//
+// Tools such as dev.Shell use the working directory of the process, so
+// Runner changes it to the workspace of each run. This means runs are one at
+// a time, and nothing else in the process should depend on the working
+// directory while they are.
+type Runner struct {
+	// URL is the Ollama endpoint and Model the model to evaluate.
+	URL, Model string
+	// Config is the agent to evaluate, such as dev.AgentConfig.
+	Config *agent.Config
+	// Runs is how many times each scenario is run. It defaults to one.
+	Runs int
+	// Budget stops runs which go on too long, such as a model stuck calling
+	// tools. A run which exceeds it fails.
+	Budget *agent.Budget
+}
+
+// Run runs each scenario Runs times. Failed assertions and agent errors fail
+// the run, but only problems running the harness, such as an unreadable
+// workspace, return an error.
+func (r *Runner) Run(ctx context.Context, scenarios []*Scenario) (*Report, error) {
+	runs := max(r.Runs, 1)
+	report := &Report{Model: r.Model, Runs: runs}
+	for _, s := range scenarios {
+		result := ScenarioResult{Name: s.Name, Description: s.Description}
+		for range runs {
+			run, err := r.run(ctx, s)
+			if err != nil {
+				return nil, fmt.Errorf("failed to run scenario %s: %w", s.Name, err)
+			}
+			result.add(run)
+		}
+		report.add(result)
+	}
+	return report, nil
+}
+
+// run runs the scenario once, in a new copy of its workspace.
+func (r *Runner) run(ctx context.Context, s *Scenario) (run RunResult, err error) {
+	dir, err := os.MkdirTemp("", "eval-"+s.Name+"-")
+	if err != nil {
+		return run, err
+	}
+	defer os.RemoveAll(dir)
+	if s.Workspace != "" {
+		if err = os.CopyFS(dir, os.DirFS(s.Workspace)); err != nil {
+			return run, fmt.Errorf("failed to copy workspace: %w", err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return run, err
+	}
+	if err = os.Chdir(dir); err != nil {
+		return run, err
+	}
+	defer func() {
+		if chdirErr := os.Chdir(wd); chdirErr != nil && err == nil {
+			err = chdirErr
+		}
+	}()
+
+	// Record the tools called, outermost so that calls rejected by other
+	// middleware are included.
+	var mu sync.Mutex
+	config := *r.Config
+	config.ToolMiddleware = append([]agent.ToolMiddleware{func(next agent.ToolHandler) agent.ToolHandler {
+		return func(ctx context.Context, toolCall llm.FunctionTool) (string, error) {
+			mu.Lock()
+			run.ToolCalls = append(run.ToolCalls, toolCall.Name)
+			mu.Unlock()
+			return next(ctx, toolCall)
+		}
+	}}, config.ToolMiddleware...)
+
+	a, err := agent.New(r.URL, r.Model, &config)
+	if err != nil {
+		return run, err
+	}
+	result, doErr := a.Do(ctx, s.Request, &agent.RequestOptions{Budget: r.Budget})
+	// Stop all scenarios when the caller gives up, rather than failing each.
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return run, ctxErr
+	}
+	if result != nil {
+		run.Answer = result.Content
+	}
+	run.Usage = a.Usage()
+
+	if doErr != nil {
+		var budgetErr *agent.BudgetExceededError
+		if !errors.As(doErr, &budgetErr) {
+			run.Failures = append(run.Failures, "request failed: "+doErr.Error())
+			return run, nil
+		}
+		// Check the outcome anyway, to show how far the agent got.
+		run.Failures = append(run.Failures, doErr.Error())
+	}
+	run.Failures = append(run.Failures, s.Expect.check(dir, run.Answer, run.ToolCalls)...)
+	run.Passed = len(run.Failures) == 0
+	return run, nil
+}
+
+// Report is the outcome of running scenarios against a model.
+type Report struct {
+	Model string `json:"model"`
+	// Runs is how many times each scenario was run.
+	Runs      int              `json:"runs"`
+	Scenarios []ScenarioResult `json:"scenarios"`
+	// Passed is the count of runs that passed, across all scenarios.
+	Passed   int     `json:"passed"`
+	PassRate float64 `json:"pass_rate"`
+	// ToolErrorRate is the ratio of tool calls which failed.
+	ToolErrorRate float64 `json:"tool_error_rate"`
+	// Usage is the total of all runs.
+	Usage usage.Usage `json:"usage"`
+}
+
+// ScenarioResult is the outcome of each run of a scenario.
+type ScenarioResult struct {
+	Name          string      `json:"name"`
+	Description   string      `json:"description,omitempty"`
+	Runs          []RunResult `json:"runs"`
+	Passed        int         `json:"passed"`
+	PassRate      float64     `json:"pass_rate"`
+	ToolErrorRate float64     `json:"tool_error_rate"`
+	// Usage is the total of all runs.
+	Usage usage.Usage `json:"usage"`
+}
+
+// RunResult is the outcome of running a scenario once.
+type RunResult struct {
+	Passed bool `json:"passed"`
+	// Failures describe each failed assertion, or why the request failed.
+	Failures []string `json:"failures,omitempty"`
+	// ToolCalls are the names of tools called, in order.
+	ToolCalls []string    `json:"tool_calls"`
+	Answer    string      `json:"answer"`
+	Usage     usage.Usage `json:"usage"`
+}
+
+func (s *ScenarioResult) add(run RunResult) {
+	if run.ToolCalls == nil {
+		run.ToolCalls = []string{} // so JSON shows none were called
+	}
+	s.Runs = append(s.Runs, run)
+	if run.Passed {
+		s.Passed++
+	}
+	s.Usage.Add(run.Usage)
+	s.PassRate = rate(s.Passed, len(s.Runs))
+	s.ToolErrorRate = rate(s.Usage.ToolErrors, s.Usage.ToolCalls)
+}
+
+func (r *Report) add(s ScenarioResult) {
+	r.Scenarios = append(r.Scenarios, s)
+	r.Passed += s.Passed
+	r.Usage.Add(s.Usage)
+	r.PassRate = rate(r.Passed, r.total())
+	r.ToolErrorRate = rate(r.Usage.ToolErrors, r.Usage.ToolCalls)
+}
+
+// total is the count of runs across all scenarios.
+func (r *Report) total() int {
+	return len(r.Scenarios) * r.Runs
+}
+
+// rate returns n/total, or zero when total is.
+func rate(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
@@ -0,0 +1,227 @@
+package eval
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/codefromthecrypt/practical-genai-go/agent/dev"
+	"github.com/codefromthecrypt/practical-genai-go/llmtest"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	log.SetOutput(io.Discard) // the tools log each call
+}
+
+func TestLoadScenarios(t *testing.T) {
+	scenarios, err := LoadScenarios("scenarios")
+	require.NoError(t, err)
+
+	var names []string
+	for _, s := range scenarios {
+		names = append(names, s.Name)
+		require.NotEmpty(t, s.Request)
+		require.DirExists(t, s.Workspace)
+	}
+	require.Equal(t, []string{"answer-question", "describe-directories", "fix-typo"}, names)
+}
+
+func TestLoadScenarios_invalid(t *testing.T) {
+	tests := []struct {
+		name, scenario, expectedErr string
+	}{
+		{
+			name:        "no request",
+			scenario:    `{"request": " "}`,
+			expectedErr: "scenario bad has no request",
+		},
+		{
+			name:        "file outside workspace",
+			scenario:    `{"request": "hi", "expect": {"files": {"../go.mod": {}}}}`,
+			expectedErr: "scenario bad expects a file outside the workspace: ../go.mod",
+		},
+		{
+			name:        "not JSON",
+			scenario:    `request: hi`,
+			expectedErr: "failed to parse scenario bad: invalid character 'r' looking for beginning of value",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.Mkdir(filepath.Join(dir, "bad"), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "bad", "scenario.json"), []byte(tc.scenario), 0o644))
+
+			_, err := LoadScenarios(dir)
+			require.EqualError(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestRunner_Run(t *testing.T) {
+	scenario, err := LoadScenario(filepath.Join("scenarios", "fix-typo"))
+	require.NoError(t, err)
+
+	ollama := llmtest.NewServer(t,
+		// The first run patches the title.
+		llmtest.Reply{ToolCalls: llmtest.ToolCall("patch_file", map[string]any{
+			"path": "README.md", "before": "# Helo", "after": "# Hello",
+		}).ToolCalls, PromptTokens: 100, CompletionTokens: 20},
+		llmtest.Reply{Content: "Fixed the title.", PromptTokens: 150, CompletionTokens: 5},
+		// The second run fails to patch, then overwrites the whole file.
+		llmtest.ToolCall("patch_file", map[string]any{
+			"path": "README.md", "before": "Hello", "after": "Hello",
+		}),
+		llmtest.ToolCall("write_file", map[string]any{
+			"path": "README.md", "content": "# Hello, world\n",
+		}),
+		llmtest.Text("Fixed the title."),
+	)
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	runner := &Runner{URL: ollama.URL, Model: "test-model", Config: dev.AgentConfig, Runs: 2}
+	report, err := runner.Run(context.Background(), []*Scenario{scenario})
+	require.NoError(t, err)
+	require.Zero(t, ollama.Remaining())
+
+	// The working directory is restored, and the fixture wasn't changed.
+	after, err := os.Getwd()
+	require.NoError(t, err)
+	require.Equal(t, wd, after)
+	b, err := os.ReadFile(filepath.Join("scenarios", "fix-typo", "workspace", "README.md"))
+	require.NoError(t, err)
+	require.Contains(t, string(b), "Helo")
+
+	require.Len(t, report.Scenarios, 1)
+	result := report.Scenarios[0]
+	require.Len(t, result.Runs, 2)
+
+	first := result.Runs[0]
+	require.True(t, first.Passed)
+	require.Empty(t, first.Failures)
+	require.Equal(t, []string{"patch_file"}, first.ToolCalls)
+	require.Equal(t, "Fixed the title.", first.Answer)
+	require.Equal(t, 275, first.Usage.TotalTokens())
+
+	second := result.Runs[1]
+	require.False(t, second.Passed)
+	require.Equal(t, []string{`README.md: missing "This line must not change."`}, second.Failures)
+	require.Equal(t, []string{"patch_file", "write_file"}, second.ToolCalls)
+
+	require.Equal(t, 1, report.Passed)
+	require.Equal(t, 0.5, report.PassRate)
+	require.Equal(t, 3, report.Usage.ToolCalls)
+	require.Equal(t, 1, report.Usage.ToolErrors)
+	require.InDelta(t, 1.0/3, report.ToolErrorRate, 0.001)
+
+	var markdown strings.Builder
+	require.NoError(t, report.WriteMarkdown(&markdown))
+	require.Contains(t, markdown.String(), "# Evaluation of test-model\n\n2 runs of each scenario.\n")
+	require.Contains(t, markdown.String(), "| fix-typo | 1/2 (50%) | 3 | 1 (33%) | 137 |")
+	require.Contains(t, markdown.String(), "## fix-typo run 2 failed\n\n- README.md: missing \"This line must not change.\"\n")
+	require.NotContains(t, markdown.String(), "run 1 failed")
+}
+
+func TestRunner_Run_budget(t *testing.T) {
+	ollama := llmtest.NewServer(t,
+		llmtest.ToolCall("shell", map[string]any{"command": "echo hello"}),
+		llmtest.ToolCall("shell", map[string]any{"command": "echo again"}),
+	)
+	scenario := &Scenario{Name: "loop", Request: "say hello", Expect: Expect{AnswerContains: []string{"hello"}}}
+
+	runner := &Runner{
+		URL:    ollama.URL,
+		Model:  "test-model",
+		Config: dev.AgentConfig,
+		Budget: &agent.Budget{MaxToolCalls: 1},
+	}
+	report, err := runner.Run(context.Background(), []*Scenario{scenario})
+	require.NoError(t, err)
+
+	// The budget stopped the run, and the outcome was still checked.
+	run := report.Scenarios[0].Runs[0]
+	require.False(t, run.Passed)
+	require.Len(t, run.Failures, 2)
+	require.True(t, strings.HasPrefix(run.Failures[0], "tool calls budget exceeded: "), run.Failures[0])
+	require.Equal(t, `answer: missing "hello"`, run.Failures[1])
+	require.Equal(t, []string{"shell"}, run.ToolCalls)
+}
+
+func TestRunner_Run_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	runner := &Runner{URL: "http://127.0.0.1:1", Model: "test-model", Config: dev.AgentConfig}
+	_, err := runner.Run(ctx, []*Scenario{{Name: "hello", Request: "hello"}})
+	require.EqualError(t, err, "failed to run scenario hello: context canceled")
+}
+
+func TestExpect_check(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o644))
+	content := "package main\n"
+	wrong := "package lib\n"
+
+	tests := []struct {
+		name      string
+		expect    Expect
+		answer    string
+		toolCalls []string
+		expected  []string
+	}{
+		{
+			name: "pass",
+			expect: Expect{
+				Files:          map[string]FileExpect{"main.go": {Equals: &content, Contains: []string{"main"}}, "old.go": {Absent: true}},
+				ToolCalls:      []string{"read_file", "write_file"},
+				MaxToolCalls:   3,
+				AnswerContains: []string{"done"},
+			},
+			answer:    "Done!",
+			toolCalls: []string{"read_file", "shell", "write_file"},
+		},
+		{
+			name: "files",
+			expect: Expect{Files: map[string]FileExpect{
+				"main.go": {Equals: &wrong, Contains: []string{"lib"}, NotContains: []string{"main"}},
+				"go.mod":  {},
+				"dir":     {Absent: true},
+			}},
+			expected: []string{
+				`go.mod: doesn't exist`,
+				`main.go: expected "package lib\n", was "package main\n"`,
+				`main.go: missing "lib"`,
+				`main.go: unexpected "main"`,
+			},
+		},
+		{
+			name:      "tool calls out of order",
+			expect:    Expect{ToolCalls: []string{"read_file", "write_file"}, MaxToolCalls: 1},
+			toolCalls: []string{"write_file", "read_file"},
+			expected: []string{
+				"tool calls [write_file read_file]: expected write_file in order [read_file write_file]",
+				"tool calls: 2 is more than 1",
+			},
+		},
+		{
+			name:     "answer",
+			expect:   Expect{AnswerContains: []string{"1.23"}},
+			answer:   "Go 1.22",
+			expected: []string{`answer: missing "1.23"`},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, tc.expect.check(dir, tc.answer, tc.toolCalls))
+		})
+	}
+}
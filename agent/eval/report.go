@@ -0,0 +1,54 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/codefromthecrypt/practical-genai-go/usage"
+)
+
+// WriteMarkdown writes the report as a table of scenarios, followed by why
+// each failed run failed. For example, to add to a pull request.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Evaluation of %s\n\n", r.Model)
+	fmt.Fprintf(&b, "%s of each scenario.\n\n", plural(r.Runs, "run"))
+	b.WriteString("| Scenario | Passed | Tool calls | Tool errors | Tokens per run | Time per run |\n")
+	b.WriteString("|----------|--------|------------|-------------|----------------|--------------|\n")
+	for _, s := range r.Scenarios {
+		writeRow(&b, s.Name, s.Passed, len(s.Runs), s.Usage)
+	}
+	writeRow(&b, "**Total**", r.Passed, r.total(), r.Usage)
+
+	for _, s := range r.Scenarios {
+		for i, run := range s.Runs {
+			if run.Passed {
+				continue
+			}
+			fmt.Fprintf(&b, "\n## %s run %d failed\n\n", s.Name, i+1)
+			for _, f := range run.Failures {
+				fmt.Fprintf(&b, "- %s\n", f)
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeRow writes the results of runs, whose total usage is u.
+func writeRow(b *strings.Builder, name string, passed, runs int, u usage.Usage) {
+	runs = max(runs, 1)
+	fmt.Fprintf(b, "| %s | %d/%d (%.0f%%) | %d | %d (%.0f%%) | %d | %s |\n",
+		name, passed, runs, 100*rate(passed, runs),
+		u.ToolCalls, u.ToolErrors, 100*rate(u.ToolErrors, u.ToolCalls),
+		u.TotalTokens()/runs, (u.Duration / time.Duration(runs)).Round(100*time.Millisecond))
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,198 @@
+// Package eval measures how well an agent performs tasks, so that changes to
+// the system prompt, tools or model can be compared. Each Scenario starts the
+// agent in a copy of a workspace fixture, makes a request, then checks the
+// files it left, the tools it called and its answer.
+//
+// LLMs don't give the same answer every time, so run each scenario several
+// times and compare pass rates, rather than a single pass or fail.
+package eval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Scenario is a task for the agent and what a correct outcome looks like.
+//
+// Scenarios are loaded from a directory containing scenario.json, and an
+// optional workspace directory, which is the agent's working directory.
+type Scenario struct {
+	// Name is the name of the scenario directory.
+	Name string `json:"-"`
+	// Description explains what the scenario tests.
+	Description string `json:"description,omitempty"`
+	// Workspace is the directory copied for each run. Empty starts each run
+	// in an empty directory.
+	Workspace string `json:"-"`
+	// Request is what the user asks the agent to do.
+	Request string `json:"request"`
+	// Expect are the assertions on the outcome.
+	Expect Expect `json:"expect"`
+}
+
+// Expect are the assertions on the outcome of a run. All must pass.
+type Expect struct {
+	// Files are assertions on files, by path relative to the workspace.
+	Files map[string]FileExpect `json:"files,omitempty"`
+	// ToolCalls are names of tools which must be called in this order.
+	// Other calls may happen between them, as models often explore first.
+	ToolCalls []string `json:"tool_calls,omitempty"`
+	// MaxToolCalls fails runs which call more tools than this. Zero is
+	// unlimited.
+	MaxToolCalls int `json:"max_tool_calls,omitempty"`
+	// AnswerContains are texts the final answer must include, ignoring case.
+	AnswerContains []string `json:"answer_contains,omitempty"`
+}
+
+// FileExpect are the assertions on a file after a run.
+type FileExpect struct {
+	// Absent is true when the file must not exist, such as when it should
+	// have been deleted. Other assertions are ignored.
+	Absent bool `json:"absent,omitempty"`
+	// Equals is the exact content of the file, when not nil.
+	Equals *string `json:"equals,omitempty"`
+	// Contains are texts the file must include.
+	Contains []string `json:"contains,omitempty"`
+	// NotContains are texts the file must not include.
+	NotContains []string `json:"not_contains,omitempty"`
+}
+
+// LoadScenarios loads each directory in dir which contains a scenario.json,
+// sorted by name.
+func LoadScenarios(dir string) ([]*Scenario, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenarios: %w", err)
+	}
+	var scenarios []*Scenario
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if _, err = os.Stat(filepath.Join(path, "scenario.json")); os.IsNotExist(err) {
+			continue
+		}
+		s, err := LoadScenario(path)
+		if err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, s)
+	}
+	if len(scenarios) == 0 {
+		return nil, fmt.Errorf("no scenarios in %s", dir)
+	}
+	sort.Slice(scenarios, func(i, j int) bool { return scenarios[i].Name < scenarios[j].Name })
+	return scenarios, nil
+}
+
+// LoadScenario loads the scenario in dir.
+func LoadScenario(dir string) (*Scenario, error) {
+	b, err := os.ReadFile(filepath.Join(dir, "scenario.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %w", err)
+	}
+	s := &Scenario{Name: filepath.Base(dir)}
+	if err = json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario %s: %w", s.Name, err)
+	}
+	if strings.TrimSpace(s.Request) == "" {
+		return nil, fmt.Errorf("scenario %s has no request", s.Name)
+	}
+	for path := range s.Expect.Files {
+		if !filepath.IsLocal(path) {
+			return nil, fmt.Errorf("scenario %s expects a file outside the workspace: %s", s.Name, path)
+		}
+	}
+	if workspace := filepath.Join(dir, "workspace"); isDir(workspace) {
+		s.Workspace = workspace
+	}
+	return s, nil
+}
+
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// check returns a description of each failed assertion, given the final
+// answer and the tools called, in a run whose workspace is dir.
+func (e *Expect) check(dir, answer string, toolCalls []string) []string {
+	var failures []string
+
+	// Sort files, so that failures are listed in a consistent order.
+	paths := make([]string, 0, len(e.Files))
+	for path := range e.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		failures = append(failures, e.Files[path].check(dir, path)...)
+	}
+
+	if missing := missingInOrder(e.ToolCalls, toolCalls); missing != "" {
+		failures = append(failures, fmt.Sprintf("tool calls %v: expected %s in order %v", toolCalls, missing, e.ToolCalls))
+	}
+	if e.MaxToolCalls > 0 && len(toolCalls) > e.MaxToolCalls {
+		failures = append(failures, fmt.Sprintf("tool calls: %d is more than %d", len(toolCalls), e.MaxToolCalls))
+	}
+	for _, text := range e.AnswerContains {
+		if !strings.Contains(strings.ToLower(answer), strings.ToLower(text)) {
+			failures = append(failures, fmt.Sprintf("answer: missing %q", text))
+		}
+	}
+	return failures
+}
+
+func (f FileExpect) check(dir, path string) []string {
+	b, err := os.ReadFile(filepath.Join(dir, path))
+	if f.Absent {
+		if err == nil {
+			return []string{path + ": exists"}
+		}
+		return nil
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{path + ": doesn't exist"}
+	} else if err != nil {
+		return []string{fmt.Sprintf("%s: %v", path, err)}
+	}
+
+	var failures []string
+	content := string(b)
+	if f.Equals != nil && content != *f.Equals {
+		failures = append(failures, fmt.Sprintf("%s: expected %q, was %q", path, *f.Equals, content))
+	}
+	for _, text := range f.Contains {
+		if !strings.Contains(content, text) {
+			failures = append(failures, fmt.Sprintf("%s: missing %q", path, text))
+		}
+	}
+	for _, text := range f.NotContains {
+		if strings.Contains(content, text) {
+			failures = append(failures, fmt.Sprintf("%s: unexpected %q", path, text))
+		}
+	}
+	return failures
+}
+
+// missingInOrder returns the first expected name which isn't in actual after
+// the previous one, or empty if all are.
+func missingInOrder(expected, actual []string) string {
+	i := 0
+	for _, name := range actual {
+		if i < len(expected) && name == expected[i] {
+			i++
+		}
+	}
+	if i < len(expected) {
+		return expected[i]
+	}
+	return ""
+}
@@ -0,0 +1,2 @@
+// Serves a REST API for the todo list.
+require('http').createServer((req, res) => res.end('[]')).listen(8080);
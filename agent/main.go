@@ -1,54 +1,22 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"os"
+	"os/signal"
 
-	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
-	"github.com/codefromthecrypt/practical-genai-go/agent/dev"
+	"github.com/codefromthecrypt/practical-genai-go/cli"
 )
 
-// main shows an agent can perform tasks for you, including figuring out which
-// tools to use. Notably, an agent isn't just retrieving information, it is
-// performing operations so you don't have to.
+// main has the dev agent write a new file, READMUAH.md, for you. It is the
+// same as `genai agent`, so it takes the same flags. For example, to give it
+// another task:
 //
-// This agent was written to be easy to explain in a conference, so it doesn't
-// do anything fancy. Real agents are more than just an LLM, a good system
-// prompt and a few tools.
-//
-// For example, https://github.com/block/goose includes a plugin system,
-// context summarization, robust LLM handling, and work in progress towards
-// Model Context Protocol (MCP), which decouples tool, prompt and resource
-// definitions from the agents that use them.
+//	go run ./agent -prompt "Add a LICENSE file."
 func main() {
-	url := "http://localhost:11434"
-	model := "qwen2.5:14b"
-
-	// Initialize the agent and give it access to certain functions.
-	a, err := agent.New(url, model, dev.AgentConfig)
-	if err != nil {
-		log.Panicln("😡:", err)
-	}
-
-	// Ask the agent to do something that requires poking around the machine.
-	// This could be solved multiple ways given the functions we've allowed.
-	reply, err := a.Request(
-		"Analyze each top-level directory in the current working directory." +
-			"Make a new file named READMUAH.md which describes each under the " +
-			"heading 'Parakeet examples'.")
-	if err != nil {
-		log.Fatal("😡:", err)
-	}
-	fmt.Println(reply)
-	fmt.Println()
-
-	// Since the agent is stateful, it will remember the last thing it did. It
-	// can revise or do something related to it without restating context.
-	reply, err = a.Request("Add a thank you to GopherCon Singapore to the " +
-		"bottom of that file as a new section. Write it in Singlish.")
-	if err != nil {
-		log.Fatal("😡:", err)
-	}
-	fmt.Println(reply)
-	fmt.Println()
+	// Interrupting stops the command, so that it can clean up.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := cli.Run(ctx, append([]string{"agent"}, os.Args[1:]...), os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
 }
@@ -0,0 +1,281 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// Client is a connection to an MCP server process. It implements
+// agent.Toolbox, so its tools can be used by an agent like Go functions.
+type Client struct {
+	name string
+	// cmd is the server process, or nil when not started by this client.
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	// writeMu serializes writes to stdin.
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[string]chan message
+	// err is set when the server exits or its output can't be read.
+	err  error
+	done chan struct{}
+}
+
+// Start launches the server and completes the MCP initialization handshake.
+// Call Close when done, to stop the server.
+func Start(ctx context.Context, config ServerConfig) (*Client, error) {
+	cmd := exec.Command(config.Command, config.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range config.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	// Servers log to stderr, which we pass through to ours.
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start MCP server %s: %w", config.Name, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start MCP server %s: %w", config.Name, err)
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start MCP server %s: %w", config.Name, err)
+	}
+
+	c := newClient(config.Name, stdout, stdin)
+	c.cmd = cmd
+	if err = c.initialize(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// newClient reads responses from r and writes requests to w. This doesn't
+// initialize the connection.
+func newClient(name string, r io.Reader, w io.WriteCloser) *Client {
+	c := &Client{
+		name:    name,
+		stdin:   w,
+		pending: map[string]chan message{},
+		done:    make(chan struct{}),
+	}
+	go c.readLoop(r)
+	return c
+}
+
+// StartAll starts each server. If any fail, those already started are
+// closed.
+func StartAll(ctx context.Context, configs []ServerConfig) ([]*Client, error) {
+	var clients []*Client
+	for _, config := range configs {
+		c, err := Start(ctx, config)
+		if err != nil {
+			for _, started := range clients {
+				started.Close()
+			}
+			return nil, err
+		}
+		clients = append(clients, c)
+	}
+	return clients, nil
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	var result initializeResult
+	if err := c.call(ctx, "initialize", initializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      implementation{Name: "practical-genai-go", Version: "0.1.0"},
+	}, &result); err != nil {
+		return fmt.Errorf("failed to initialize MCP server %s: %w", c.name, err)
+	}
+	log.Printf("Initialized MCP server %s: %s %s (protocol %s)", c.name,
+		result.ServerInfo.Name, result.ServerInfo.Version, result.ProtocolVersion)
+	return c.write(request{JSONRPC: "2.0", Method: "notifications/initialized"})
+}
+
+// ListTools implements agent.Toolbox by converting the JSON schema of each
+// tool into the parameters format the LLM uses.
+func (c *Client) ListTools(ctx context.Context) ([]llm.Tool, error) {
+	var tools []llm.Tool
+	params := listToolsParams{}
+	for {
+		var result listToolsResult
+		if err := c.call(ctx, "tools/list", params, &result); err != nil {
+			return nil, fmt.Errorf("failed to list tools of MCP server %s: %w", c.name, err)
+		}
+		for _, t := range result.Tools {
+			tools = append(tools, t.llmTool())
+		}
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		params.Cursor = result.NextCursor
+	}
+}
+
+func (t tool) llmTool() llm.Tool {
+	params := llm.Parameters{
+		Type:       "object",
+		Properties: make(map[string]llm.Property, len(t.InputSchema.Properties)),
+		Required:   t.InputSchema.Required,
+	}
+	if params.Required == nil {
+		params.Required = []string{}
+	}
+	for name, p := range t.InputSchema.Properties {
+		description := p.Description
+		if len(p.Enum) > 0 {
+			description = strings.TrimSpace(description + " One of: " + strings.Join(p.Enum, ", ") + ".")
+		}
+		params.Properties[name] = llm.Property{Type: string(p.Type), Description: description}
+	}
+	return llm.Tool{
+		Type:     "function",
+		Function: llm.Function{Name: t.Name, Description: t.Description, Parameters: params},
+	}
+}
+
+// CallTool implements agent.Toolbox. The text content of the result is
+// joined with newlines. When the server reports a tool error, the text is
+// returned as the error, so the LLM can try to resolve it.
+func (c *Client) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (string, error) {
+	var result callToolResult
+	if err := c.call(ctx, "tools/call", callToolParams{Name: name, Arguments: arguments}, &result); err != nil {
+		return "", fmt.Errorf("failed to call %s on MCP server %s: %w", name, c.name, err)
+	}
+	var texts []string
+	for _, content := range result.Content {
+		if content.Type == "text" {
+			texts = append(texts, content.Text)
+		}
+	}
+	text := strings.Join(texts, "\n")
+	if result.IsError {
+		return "", errors.New(text)
+	}
+	return text, nil
+}
+
+// Close stops the server, first by closing its input, which is how MCP
+// servers on stdio are expected to shut down.
+func (c *Client) Close() error {
+	c.stdin.Close()
+	if c.cmd == nil {
+		return nil
+	}
+	select {
+	case <-c.done:
+	case <-time.After(5 * time.Second):
+		c.cmd.Process.Kill()
+		<-c.done
+	}
+	return c.cmd.Wait()
+}
+
+// call sends a request and waits for its response, decoding the result.
+func (c *Client) call(ctx context.Context, method string, params, result any) error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := json.RawMessage(strconv.FormatInt(c.nextID, 10))
+	ch := make(chan message, 1)
+	c.pending[string(id)] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, string(id))
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(request{JSONRPC: "2.0", ID: &id, Method: method, Params: params}); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return c.err
+	case msg := <-ch:
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if err := json.Unmarshal(msg.Result, result); err != nil {
+			return fmt.Errorf("invalid %s result: %w", method, err)
+		}
+		return nil
+	}
+}
+
+func (c *Client) write(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = c.stdin.Write(append(b, '\n'))
+	return err
+}
+
+// readLoop dispatches responses to waiting calls until the server exits.
+func (c *Client) readLoop(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			log.Printf("MCP server %s wrote invalid JSON: %v", c.name, err)
+			continue
+		}
+		switch {
+		case msg.ID == nil: // notification, such as logging
+		case msg.Method != "":
+			// We don't offer capabilities to servers, but must answer pings.
+			resp := response{JSONRPC: "2.0", ID: msg.ID, Result: map[string]any{}}
+			if msg.Method != "ping" {
+				resp.Result = nil
+				resp.Error = &rpcError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+			}
+			c.write(resp)
+		default:
+			c.mu.Lock()
+			if ch, ok := c.pending[string(*msg.ID)]; ok {
+				ch <- msg
+			}
+			c.mu.Unlock()
+		}
+	}
+
+	c.mu.Lock()
+	c.err = fmt.Errorf("MCP server %s exited", c.name)
+	if err := scanner.Err(); err != nil {
+		c.err = fmt.Errorf("failed to read from MCP server %s: %w", c.name, err)
+	}
+	c.mu.Unlock()
+	close(c.done)
+}
@@ -0,0 +1,93 @@
+package mcp
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/parakeet-nest/parakeet/llm"
+	"github.com/stretchr/testify/require"
+)
+
+var _ agent.Toolbox = (*Client)(nil)
+
+// buildEchoServer builds the MCP server in testdata, returning its path.
+func buildEchoServer(t *testing.T) string {
+	bin := filepath.Join(t.TempDir(), "echo-server")
+	out, err := exec.Command("go", "build", "-o", bin, "./testdata/echo-server").CombinedOutput()
+	require.NoError(t, err, string(out))
+	return bin
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	c, err := Start(ctx, ServerConfig{Name: "echo", Command: buildEchoServer(t)})
+	require.NoError(t, err)
+	defer c.Close()
+
+	tools, err := c.ListTools(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []llm.Tool{
+		{
+			Type: "function",
+			Function: llm.Function{
+				Name:        "echo",
+				Description: "echo returns the text it is given.",
+				Parameters: llm.Parameters{
+					Type: "object",
+					Properties: map[string]llm.Property{
+						"text": {Type: "string", Description: "The text to echo."},
+					},
+					Required: []string{"text"},
+				},
+			},
+		},
+		{
+			Type: "function",
+			Function: llm.Function{
+				Name:        "fail",
+				Description: "fail always fails.",
+				Parameters: llm.Parameters{
+					Type:       "object",
+					Properties: map[string]llm.Property{},
+					Required:   []string{},
+				},
+			},
+		},
+	}, tools)
+
+	result, err := c.CallTool(ctx, "echo", map[string]interface{}{"text": "hello"})
+	require.NoError(t, err)
+	require.Equal(t, "hello", result)
+
+	_, err = c.CallTool(ctx, "fail", nil)
+	require.EqualError(t, err, "failed on purpose")
+}
+
+func TestClose(t *testing.T) {
+	ctx := context.Background()
+	c, err := Start(ctx, ServerConfig{Name: "echo", Command: buildEchoServer(t)})
+	require.NoError(t, err)
+	require.NoError(t, c.Close())
+
+	_, err = c.ListTools(ctx)
+	require.EqualError(t, err, "failed to list tools of MCP server echo: MCP server echo exited")
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"mcpServers": {
+		"fetch": {"command": "uvx", "args": ["mcp-server-fetch"]},
+		"echo": {"command": "echo-server", "env": {"DEBUG": "1"}}
+	}}`), 0o644))
+
+	configs, err := LoadConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, []ServerConfig{
+		{Name: "echo", Command: "echo-server", Env: map[string]string{"DEBUG": "1"}},
+		{Name: "fetch", Command: "uvx", Args: []string{"mcp-server-fetch"}},
+	}, configs)
+}
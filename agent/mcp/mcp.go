@@ -0,0 +1,177 @@
+// Package mcp implements enough of the Model Context Protocol (MCP) to use
+// tools from MCP servers, which run as child processes speaking JSON-RPC
+// over stdio, and to serve tools to other agents the same way.
+//
+// See https://modelcontextprotocol.io/specification/2024-11-05
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// ProtocolVersion is the MCP revision this package implements.
+const ProtocolVersion = "2024-11-05"
+
+// ServerConfig is how to launch an MCP server.
+type ServerConfig struct {
+	// Name identifies the server in errors and logs.
+	Name string `json:"-"`
+	// Command is the executable, and Args are its arguments.
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	// Env are variables to add to the environment of the process.
+	Env map[string]string `json:"env"`
+}
+
+// LoadConfig reads servers from a file in the same format as other MCP
+// clients, such as Claude Desktop. For example:
+//
+//	{
+//	  "mcpServers": {
+//	    "fetch": {"command": "uvx", "args": ["mcp-server-fetch"]}
+//	  }
+//	}
+func LoadConfig(path string) ([]ServerConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MCP config: %w", err)
+	}
+	var file struct {
+		MCPServers map[string]ServerConfig `json:"mcpServers"`
+	}
+	if err = json.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse MCP config: %w", err)
+	}
+	configs := make([]ServerConfig, 0, len(file.MCPServers))
+	for name, c := range file.MCPServers {
+		if c.Command == "" {
+			return nil, fmt.Errorf("MCP server %s has no command", name)
+		}
+		c.Name = name
+		configs = append(configs, c)
+	}
+	// Sort so that tools are listed in a consistent order.
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Name < configs[j].Name })
+	return configs, nil
+}
+
+// request is a JSON-RPC request, or a notification when ID is nil.
+type request struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method"`
+	Params  any              `json:"params,omitempty"`
+}
+
+// message is any JSON-RPC message read from the other side.
+type message struct {
+	ID     *json.RawMessage `json:"id,omitempty"`
+	Method string           `json:"method,omitempty"`
+	Params json.RawMessage  `json:"params,omitempty"`
+	Result json.RawMessage  `json:"result,omitempty"`
+	Error  *rpcError        `json:"error,omitempty"`
+}
+
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  any              `json:"result,omitempty"`
+	Error   *rpcError        `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// JSON-RPC error codes used by MCP.
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+type implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type initializeParams struct {
+	ProtocolVersion string         `json:"protocolVersion"`
+	Capabilities    map[string]any `json:"capabilities"`
+	ClientInfo      implementation `json:"clientInfo"`
+}
+
+type initializeResult struct {
+	ProtocolVersion string         `json:"protocolVersion"`
+	Capabilities    map[string]any `json:"capabilities"`
+	ServerInfo      implementation `json:"serverInfo"`
+}
+
+// tool is an MCP tool definition. InputSchema is a JSON schema.
+type tool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	InputSchema inputSchema `json:"inputSchema"`
+}
+
+type inputSchema struct {
+	Type       string              `json:"type"`
+	Properties map[string]property `json:"properties,omitempty"`
+	Required   []string            `json:"required,omitempty"`
+}
+
+type property struct {
+	Type        schemaType `json:"type,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Enum        []string   `json:"enum,omitempty"`
+}
+
+// schemaType is a JSON schema type. When a schema allows several types, such
+// as ["string", "null"], it is the first besides "null".
+type schemaType string
+
+func (t *schemaType) UnmarshalJSON(b []byte) error {
+	var types []string
+	if err := json.Unmarshal(b, &types); err != nil {
+		return json.Unmarshal(b, (*string)(t))
+	}
+	for _, typ := range types {
+		if typ != "null" {
+			*t = schemaType(typ)
+			break
+		}
+	}
+	return nil
+}
+
+type listToolsParams struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
+type listToolsResult struct {
+	Tools      []tool `json:"tools"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+type callToolParams struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+type callToolResult struct {
+	Content []content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+type content struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+}
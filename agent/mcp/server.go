@@ -0,0 +1,142 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// Serve answers MCP requests read from r, writing responses to w, until r is
+// closed or the context is done. The server offers the tools of the toolbox,
+// for example those of an agent.Config, via agent.NewToolbox.
+//
+// A tool that returns an error results in a tool result with isError set, so
+// that the calling LLM can see it. Unknown tools or invalid arguments are
+// protocol errors instead.
+func Serve(ctx context.Context, name, version string, toolbox agent.Toolbox, r io.Reader, w io.Writer) error {
+	tools, err := toolbox.ListTools(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list tools: %w", err)
+	}
+	s := &server{
+		info:    implementation{Name: name, Version: version},
+		toolbox: toolbox,
+		tools:   make(map[string]llm.Tool, len(tools)),
+		out:     json.NewEncoder(w),
+	}
+	for _, t := range tools {
+		s.tools[t.Function.Name] = t
+		s.order = append(s.order, t.Function.Name)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Requests are handled concurrently, so a long tool call doesn't block
+	// others, such as pings.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			break
+		}
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			s.write(response{JSONRPC: "2.0", Error: &rpcError{Code: codeParseError, Message: err.Error()}})
+			continue
+		}
+		if msg.ID == nil || msg.Method == "" {
+			continue // notifications and responses need no reply
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := s.handle(ctx, msg)
+			resp := response{JSONRPC: "2.0", ID: msg.ID, Result: result}
+			if err != nil {
+				resp.Result, resp.Error = nil, err
+			}
+			s.write(resp)
+		}()
+	}
+	return scanner.Err()
+}
+
+type server struct {
+	info    implementation
+	toolbox agent.Toolbox
+	tools   map[string]llm.Tool
+	// order is the order of tools in toolbox.ListTools.
+	order []string
+
+	mu  sync.Mutex
+	out *json.Encoder
+}
+
+func (s *server) write(resp response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.out.Encode(resp)
+}
+
+func (s *server) handle(ctx context.Context, msg message) (any, *rpcError) {
+	switch msg.Method {
+	case "initialize":
+		return initializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    map[string]any{"tools": map[string]any{}},
+			ServerInfo:      s.info,
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		result := listToolsResult{Tools: make([]tool, 0, len(s.order))}
+		for _, name := range s.order {
+			result.Tools = append(result.Tools, mcpTool(s.tools[name]))
+		}
+		return result, nil
+	case "tools/call":
+		var params callToolParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		t, ok := s.tools[params.Name]
+		if !ok {
+			return nil, &rpcError{Code: codeInvalidParams, Message: "unknown tool: " + params.Name}
+		}
+		for _, required := range t.Function.Parameters.Required {
+			if _, ok = params.Arguments[required]; !ok {
+				return nil, &rpcError{Code: codeInvalidParams, Message: "missing argument: " + required}
+			}
+		}
+		text, err := s.toolbox.CallTool(ctx, params.Name, params.Arguments)
+		if err != nil {
+			return callToolResult{IsError: true, Content: []content{{Type: "text", Text: err.Error()}}}, nil
+		}
+		return callToolResult{Content: []content{{Type: "text", Text: text}}}, nil
+	default:
+		return nil, &rpcError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+}
+
+// mcpTool converts the tool definition sent to LLMs into an MCP tool.
+func mcpTool(t llm.Tool) tool {
+	schema := inputSchema{
+		Type:       "object",
+		Properties: make(map[string]property, len(t.Function.Parameters.Properties)),
+		Required:   t.Function.Parameters.Required,
+	}
+	for name, p := range t.Function.Parameters.Properties {
+		schema.Properties[name] = property{Type: schemaType(p.Type), Description: p.Description}
+	}
+	return tool{Name: t.Function.Name, Description: t.Function.Description, InputSchema: schema}
+}
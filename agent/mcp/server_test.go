@@ -0,0 +1,102 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/parakeet-nest/parakeet/llm"
+	"github.com/stretchr/testify/require"
+)
+
+// Greet says hello.
+//
+// Parameters:
+//   - name: Who to greet.
+func Greet(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("name is empty")
+	}
+	return "Hello, " + name, nil
+}
+
+const toolSource = `package tools
+
+// Greet says hello.
+//
+// Parameters:
+//   - name: Who to greet.
+func Greet(name string) (string, error)
+`
+
+// serve connects a client to a server offering Greet.
+func serve(t *testing.T) *Client {
+	toolbox, err := agent.NewToolbox(&agent.Config{
+		ToolSource: toolSource,
+		Tools:      map[string]reflect.Value{"greet": reflect.ValueOf(Greet)},
+	})
+	require.NoError(t, err)
+
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(context.Background(), "test", "1.0.0", toolbox, serverIn, serverOut)
+		serverOut.Close()
+	}()
+
+	c := newClient("test", clientIn, clientOut)
+	t.Cleanup(func() {
+		c.Close()
+		require.NoError(t, <-done)
+	})
+	require.NoError(t, c.initialize(context.Background()))
+	return c
+}
+
+func TestServe(t *testing.T) {
+	ctx := context.Background()
+	c := serve(t)
+
+	tools, err := c.ListTools(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []llm.Tool{{
+		Type: "function",
+		Function: llm.Function{
+			Name:        "greet",
+			Description: "greet says hello.\n\nParameters:\n  - name: Who to greet.\n",
+			Parameters: llm.Parameters{
+				Type:       "object",
+				Properties: map[string]llm.Property{"name": {Type: "string", Description: "name"}},
+				Required:   []string{"name"},
+			},
+		},
+	}}, tools)
+
+	result, err := c.CallTool(ctx, "greet", map[string]interface{}{"name": "Gopher"})
+	require.NoError(t, err)
+	require.Equal(t, "Hello, Gopher", result)
+
+	t.Run("tool error", func(t *testing.T) {
+		_, err := c.CallTool(ctx, "greet", map[string]interface{}{"name": ""})
+		require.EqualError(t, err, "name is empty")
+	})
+
+	t.Run("missing argument", func(t *testing.T) {
+		_, err := c.CallTool(ctx, "greet", nil)
+		require.EqualError(t, err, "failed to call greet on MCP server test: missing argument: name (code -32602)")
+	})
+
+	t.Run("unknown tool", func(t *testing.T) {
+		_, err := c.CallTool(ctx, "wave", nil)
+		require.EqualError(t, err, "failed to call wave on MCP server test: unknown tool: wave (code -32602)")
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		err := c.call(ctx, "resources/list", nil, &struct{}{})
+		require.EqualError(t, err, "method not found: resources/list (code -32601)")
+	})
+}
@@ -0,0 +1,71 @@
+// echo-server is a minimal MCP server for tests, which only depends on the
+// standard library so that it doesn't exercise the code under test.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+)
+
+func main() {
+	scanner := bufio.NewScanner(os.Stdin)
+	encoder := json.NewEncoder(os.Stdout)
+	for scanner.Scan() {
+		var req struct {
+			ID     *json.RawMessage `json:"id"`
+			Method string           `json:"method"`
+			Params struct {
+				Name      string            `json:"name"`
+				Arguments map[string]string `json:"arguments"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil || req.ID == nil {
+			continue // ignore notifications
+		}
+
+		var result any
+		switch req.Method {
+		case "initialize":
+			result = map[string]any{
+				"protocolVersion": "2024-11-05",
+				"capabilities":    map[string]any{"tools": map[string]any{}},
+				"serverInfo":      map[string]any{"name": "echo-server", "version": "1.0.0"},
+			}
+		case "tools/list":
+			result = map[string]any{"tools": []any{
+				map[string]any{
+					"name":        "echo",
+					"description": "echo returns the text it is given.",
+					"inputSchema": map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"text": map[string]any{"type": "string", "description": "The text to echo."},
+						},
+						"required": []string{"text"},
+					},
+				},
+				map[string]any{
+					"name":        "fail",
+					"description": "fail always fails.",
+					"inputSchema": map[string]any{"type": "object"},
+				},
+			}}
+		case "tools/call":
+			if req.Params.Name == "echo" {
+				result = map[string]any{"content": []any{
+					map[string]any{"type": "text", "text": req.Params.Arguments["text"]},
+				}}
+			} else {
+				result = map[string]any{"isError": true, "content": []any{
+					map[string]any{"type": "text", "text": "failed on purpose"},
+				}}
+			}
+		default:
+			encoder.Encode(map[string]any{"jsonrpc": "2.0", "id": req.ID,
+				"error": map[string]any{"code": -32601, "message": "method not found"}})
+			continue
+		}
+		encoder.Encode(map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}
+}
@@ -0,0 +1,201 @@
+// Package redact masks secrets in tool output before it reaches the LLM.
+//
+// Tools like ReadFile and Shell can read credentials, such as those in a
+// .env file or the environment. Once in the conversation, they are sent to
+// the LLM, saved in transcripts and can be repeated in answers.
+package redact
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+)
+
+// Pattern finds a kind of secret. If Regexp has a group named "secret", only
+// that part of the match is masked, otherwise the whole match is.
+type Pattern struct {
+	Kind   string
+	Regexp *regexp.Regexp
+}
+
+// DefaultPatterns find common credentials.
+var DefaultPatterns = []Pattern{
+	{"private_key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"api_key", regexp.MustCompile(`\b(?:sk|pk|rk)-[A-Za-z0-9_-]{20,}\b`)},
+	{"github_token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"aws_access_key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"slack_token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\b`)},
+	{"bearer_token", regexp.MustCompile(`(?i)\bbearer\s+(?P<secret>[A-Za-z0-9._~+/-]{16,}=*)`)},
+	{"url_password", regexp.MustCompile(`\b[a-z][a-z0-9+.-]*://[^\s:/@]+:(?P<secret>[^\s@/]+)@`)},
+	{"password", regexp.MustCompile(`(?i)\b[A-Z0-9_]*(?:password|passwd|secret|token|api_?key|access_?key|credentials?)[A-Z0-9_]*["']?\s*[=:]\s*["']?(?P<secret>[^\s"',;]+)`)},
+}
+
+// secretEnvVar matches names of environment variables likely to be secret.
+var secretEnvVar = regexp.MustCompile(`(?i)(password|passwd|secret|token|api_?key|access_?key|credential|private)`)
+
+// candidate matches words which could be secrets, if random enough.
+var candidate = regexp.MustCompile(`[A-Za-z0-9+_=-]{20,}`)
+
+// Options configure a Redactor.
+type Options struct {
+	// Patterns find known kinds of secrets.
+	Patterns []Pattern
+	// EnvVars are environment variables whose values are secret, wherever
+	// they appear. Values shorter than 4 characters are ignored, as they'd
+	// mask too much.
+	EnvVars []string
+	// MinEntropy is the Shannon entropy, in bits per character, above which
+	// a word of 20 or more letters, digits or symbols looks like a random
+	// secret. Zero disables this. Hex strings, such as git hashes, have at
+	// most 4 bits per character.
+	MinEntropy float64
+}
+
+// Redactor masks secrets consistently: the same secret always gets the same
+// mask, such as [REDACTED:password-1]. This keeps the text understandable to
+// the LLM, which can tell when two values are the same without seeing them.
+//
+// A Redactor is safe for concurrent use.
+type Redactor struct {
+	patterns   []Pattern
+	envValues  map[string]string // value to kind
+	minEntropy float64
+
+	mu     sync.Mutex
+	masks  map[string]string // secret to mask
+	counts map[string]int    // kind to count of distinct secrets
+}
+
+// New returns a Redactor with the given options.
+func New(opts Options) *Redactor {
+	r := &Redactor{
+		patterns:   opts.Patterns,
+		envValues:  map[string]string{},
+		minEntropy: opts.MinEntropy,
+		masks:      map[string]string{},
+		counts:     map[string]int{},
+	}
+	for _, name := range opts.EnvVars {
+		if v := os.Getenv(name); len(v) >= 4 {
+			r.envValues[v] = "env_" + strings.ToLower(name)
+		}
+	}
+	return r
+}
+
+// Default returns a Redactor with DefaultPatterns, the values of environment
+// variables with names like PASSWORD or API_KEY, and a minimum entropy of 4.5.
+func Default() *Redactor {
+	var envVars []string
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); secretEnvVar.MatchString(name) {
+			envVars = append(envVars, name)
+		}
+	}
+	return New(Options{Patterns: DefaultPatterns, EnvVars: envVars, MinEntropy: 4.5})
+}
+
+// Redact masks secrets in text, returning the result and how many secrets
+// were masked.
+func (r *Redactor) Redact(text string) (string, int) {
+	count := 0
+
+	// Replace known values first, as they are the most specific.
+	values := make([]string, 0, len(r.envValues))
+	for v := range r.envValues {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	for _, v := range values {
+		if n := strings.Count(text, v); n > 0 {
+			text = strings.ReplaceAll(text, v, r.mask(r.envValues[v], v))
+			count += n
+		}
+	}
+
+	for _, p := range r.patterns {
+		group := p.Regexp.SubexpIndex("secret")
+		text = p.Regexp.ReplaceAllStringFunc(text, func(match string) string {
+			if group < 0 {
+				count++
+				return r.mask(p.Kind, match)
+			}
+			// Find the group again, as ReplaceAllStringFunc only gives the match.
+			m := p.Regexp.FindStringSubmatchIndex(match)
+			start, end := m[2*group], m[2*group+1]
+			if start < 0 || strings.HasPrefix(match[start:], "[REDACTED:") {
+				return match
+			}
+			count++
+			return match[:start] + r.mask(p.Kind, match[start:end]) + match[end:]
+		})
+	}
+
+	if r.minEntropy > 0 {
+		text = candidate.ReplaceAllStringFunc(text, func(word string) string {
+			if !hasLetterAndDigit(word) || entropy(word) < r.minEntropy {
+				return word
+			}
+			count++
+			return r.mask("high_entropy", word)
+		})
+	}
+	return text, count
+}
+
+// Counts returns how many distinct secrets of each kind were masked so far.
+func (r *Redactor) Counts() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[string]int, len(r.counts))
+	for k, v := range r.counts {
+		counts[k] = v
+	}
+	return counts
+}
+
+// mask returns the mask for a secret, creating one if it is new.
+func (r *Redactor) mask(kind, secret string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m, ok := r.masks[secret]; ok {
+		return m
+	}
+	r.counts[kind]++
+	m := fmt.Sprintf("[REDACTED:%s-%d]", kind, r.counts[kind])
+	r.masks[secret] = m
+	return m
+}
+
+// ToolMiddleware redacts tool results and errors before the agent adds them
+// to the conversation, logging how many secrets were masked.
+func (r *Redactor) ToolMiddleware() agent.ToolMiddleware {
+	return agent.RedactOutput(r)
+}
+
+func hasLetterAndDigit(s string) bool {
+	return strings.ContainsAny(s, "0123456789") &&
+		strings.ContainsAny(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+}
+
+// entropy returns the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	freq := map[rune]float64{}
+	for _, c := range s {
+		freq[c]++
+	}
+	n := float64(len(s))
+	var e float64
+	for _, f := range freq {
+		p := f / n
+		e -= p * math.Log2(p)
+	}
+	return e
+}
@@ -0,0 +1,362 @@
+// Package server exposes agents over an OpenAI-compatible HTTP API, so that
+// existing OpenAI client tooling can use them.
+//
+// Unlike a plain LLM, the agent runs tools on the server. Clients only see
+// the final assistant message of each request, never the tool calls. For the
+// same reason, "stream": true is accepted, but the reply is buffered until the
+// agent finishes, then sent as one content chunk.
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/parakeet-nest/parakeet/llm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// SessionHeader pins requests to a session. When absent, the session is the
+// one which replied to the rest of the conversation the client resends, or a
+// new one. Either way, it is returned in this response header.
+const SessionHeader = "X-Session-ID"
+
+// Server serves /v1/chat/completions and /v1/models.
+type Server struct {
+	sessions *agent.SessionManager
+	// model is the name listed by /v1/models and returned in completions.
+	model         string
+	conversations conversations
+	mux           *http.ServeMux
+}
+
+// New returns a server that handles each conversation with its own agent
+// from sessions. The model is the name reported to clients.
+func New(sessions *agent.SessionManager, model string) *Server {
+	s := &Server{sessions: sessions, model: model, mux: http.NewServeMux()}
+	s.mux.HandleFunc("POST /v1/chat/completions", s.chatCompletions)
+	s.mux.HandleFunc("GET /v1/models", s.models)
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+type message struct {
+	Role string `json:"role"`
+	// Content is a string, or an array of content parts.
+	Content json.RawMessage `json:"content"`
+}
+
+// text returns the content, joining any text parts.
+func (m message) text() string {
+	var s string
+	if err := json.Unmarshal(m.Content, &s); err == nil {
+		return s
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(m.Content, &parts); err != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, p := range parts {
+		if p.Type == "text" {
+			b.WriteString(p.Text)
+		}
+	}
+	return b.String()
+}
+
+type chatCompletionRequest struct {
+	// Model is ignored, as the agent decides which model to use.
+	Model    string    `json:"model"`
+	Messages []message `json:"messages"`
+	Stream   bool      `json:"stream"`
+	// These override the agent's model options for this request.
+	Temperature *float64 `json:"temperature"`
+	TopP        *float64 `json:"top_p"`
+	Seed        *int     `json:"seed"`
+	MaxTokens   *int     `json:"max_tokens"`
+	// Stop is a string or an array of strings.
+	Stop json.RawMessage `json:"stop"`
+	// StreamOptions.IncludeUsage adds a final chunk with token usage.
+	StreamOptions struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+}
+
+// requestOptions returns the agent options changed by the request, or nil if
+// it uses the defaults.
+func (req *chatCompletionRequest) requestOptions(a *agent.Agent) (*agent.RequestOptions, error) {
+	if req.Temperature == nil && req.TopP == nil && req.Seed == nil && req.MaxTokens == nil && req.Stop == nil {
+		return nil, nil
+	}
+	options := a.Options()
+	if req.Temperature != nil {
+		options.Temperature = *req.Temperature
+	}
+	if req.TopP != nil {
+		options.TopP = *req.TopP
+	}
+	if req.Seed != nil {
+		options.Seed = *req.Seed
+	}
+	if req.MaxTokens != nil {
+		options.NumPredict = *req.MaxTokens
+	}
+	if req.Stop != nil && string(req.Stop) != "null" {
+		var stop string
+		if err := json.Unmarshal(req.Stop, &stop); err == nil {
+			options.Stop = []string{stop}
+		} else if err = json.Unmarshal(req.Stop, &options.Stop); err != nil {
+			return nil, fmt.Errorf("stop must be a string or an array of strings")
+		}
+	}
+	return &agent.RequestOptions{Options: &options}, nil
+}
+
+type responseMessage struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type choice struct {
+	Index        int              `json:"index"`
+	Message      *responseMessage `json:"message,omitempty"`
+	Delta        *responseMessage `json:"delta,omitempty"`
+	FinishReason *string          `json:"finish_reason"`
+}
+
+// completionUsage is the tokens used by all LLM calls of the request,
+// including those requesting tools.
+type completionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type chatCompletion struct {
+	ID      string           `json:"id"`
+	Object  string           `json:"object"`
+	Created int64            `json:"created"`
+	Model   string           `json:"model"`
+	Choices []choice         `json:"choices"`
+	Usage   *completionUsage `json:"usage,omitempty"`
+}
+
+func (s *Server) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req chatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid JSON: "+err.Error())
+		return
+	}
+	if len(req.Messages) == 0 || req.Messages[len(req.Messages)-1].Role != "user" {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "the last message must have the role user")
+		return
+	}
+
+	prior, last := req.Messages[:len(req.Messages)-1], req.Messages[len(req.Messages)-1]
+	id := r.Header.Get(SessionHeader)
+	if id == "" {
+		id = s.conversations.find(prior)
+	}
+	a, err := s.sessions.Get(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	w.Header().Set(SessionHeader, id)
+	// A new session, or one discarded while idle, needs the earlier turns.
+	a.Replay(llmMessages(prior)...)
+
+	opts, err := req.requestOptions(a)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	// Continue the client's trace, if it sent one, such as a traceparent.
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+	// The agent remembers the conversation, so only send the new message.
+	result, err := a.Do(ctx, last.text(), opts)
+	if err != nil {
+		log.Printf("session %s: %v", id, err)
+		writeError(w, http.StatusBadGateway, "server_error", err.Error())
+		return
+	}
+	// The client's next request resends this conversation with the reply.
+	reply := message{Role: "assistant", Content: jsonString(result.Content)}
+	s.conversations.add(id, append(req.Messages, reply), s.sessions.Has)
+
+	stop := "stop"
+	u := &completionUsage{
+		PromptTokens:     result.Usage.PromptTokens,
+		CompletionTokens: result.Usage.CompletionTokens,
+		TotalTokens:      result.Usage.TotalTokens(),
+	}
+	completion := chatCompletion{
+		ID:      newID(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   s.model,
+	}
+	if !req.Stream {
+		completion.Choices = []choice{{
+			Message:      &responseMessage{Role: "assistant", Content: result.Content},
+			FinishReason: &stop,
+		}}
+		completion.Usage = u
+		writeJSON(w, http.StatusOK, completion)
+		return
+	}
+
+	// Tools already ran, and the reply is buffered, so it is sent in one
+	// content chunk, between the role and finish chunks clients expect.
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	completion.Object = "chat.completion.chunk"
+	for _, c := range []choice{
+		{Delta: &responseMessage{Role: "assistant"}},
+		{Delta: &responseMessage{Content: result.Content}},
+		{Delta: &responseMessage{}, FinishReason: &stop},
+	} {
+		completion.Choices = []choice{c}
+		b, _ := json.Marshal(completion)
+		fmt.Fprintf(w, "data: %s\n\n", b)
+	}
+	if req.StreamOptions.IncludeUsage {
+		completion.Choices, completion.Usage = []choice{}, u
+		b, _ := json.Marshal(completion)
+		fmt.Fprintf(w, "data: %s\n\n", b)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func (s *Server) models(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"object": "list",
+		"data": []map[string]any{{
+			"id":       s.model,
+			"object":   "model",
+			"created":  0,
+			"owned_by": "agent",
+		}},
+	})
+}
+
+// conversations finds the session of a client which doesn't send
+// SessionHeader. Clients resend the whole conversation each time, so it is
+// found by the hash of all messages, up to the last reply.
+type conversations struct {
+	mu sync.Mutex
+	// sessions are session IDs by conversation hash, and hashes the latest
+	// hash of each session, so that older ones are removed.
+	sessions, hashes map[string]string
+	// pruneAt is the size at which entries of discarded sessions are removed.
+	pruneAt int
+}
+
+// find returns the session which replied to messages, or a new session ID.
+// A new conversation gets a new session, even if another client started one
+// the same way.
+func (c *conversations) find(messages []message) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id, ok := c.sessions[conversationHash(messages)]; ok {
+		return id
+	}
+	return newSessionID()
+}
+
+// add records that session id replied last to messages. exists reports if a
+// session is still open.
+func (c *conversations) add(id string, messages []message, exists func(id string) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sessions == nil {
+		c.sessions, c.hashes = map[string]string{}, map[string]string{}
+	}
+	if old, ok := c.hashes[id]; ok {
+		delete(c.sessions, old)
+	}
+	hash := conversationHash(messages)
+	if other, ok := c.sessions[hash]; ok && other != id {
+		delete(c.hashes, other)
+	}
+	c.sessions[hash], c.hashes[id] = id, hash
+
+	// Sessions are discarded when idle, so drop their entries once in a while.
+	if len(c.hashes) < c.pruneAt {
+		return
+	}
+	for id, hash := range c.hashes {
+		if !exists(id) {
+			delete(c.hashes, id)
+			delete(c.sessions, hash)
+		}
+	}
+	c.pruneAt = max(2*len(c.hashes), 64)
+}
+
+// conversationHash hashes the role and text of each message.
+func conversationHash(messages []message) string {
+	h := sha256.New()
+	for _, m := range messages {
+		fmt.Fprintf(h, "%s\x00%s\x00", m.Role, m.text())
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// llmMessages converts messages for Agent.Replay.
+func llmMessages(messages []message) []llm.Message {
+	converted := make([]llm.Message, len(messages))
+	for i, m := range messages {
+		converted[i] = llm.Message{Role: m.Role, Content: m.text()}
+	}
+	return converted
+}
+
+func jsonString(s string) json.RawMessage {
+	b, _ := json.Marshal(s)
+	return b
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "chatcmpl-" + hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error in the format OpenAI clients parse.
+func writeError(w http.ResponseWriter, status int, errorType, msg string) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{"message": msg, "type": errorType},
+	})
+}
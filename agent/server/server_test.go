@@ -0,0 +1,237 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/parakeet-nest/parakeet/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer returns a server whose agents reply with the count of
+// messages they sent to the LLM, which shows if a conversation continued.
+func newTestServer(t *testing.T) *httptest.Server {
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []any `json:"messages"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"message":{"role":"assistant","content":"%d messages"},"done":true,`+
+			`"prompt_eval_count":10,"eval_count":3}`, len(req.Messages))
+	}))
+	t.Cleanup(ollama.Close)
+
+	sessions := agent.NewSessionManager(ollama.URL, "test-model", func(string) *agent.Config {
+		return &agent.Config{SystemPrompt: "You are a test.", ToolSource: "package tools"}
+	}, time.Minute)
+	t.Cleanup(sessions.Close)
+
+	s := httptest.NewServer(New(sessions, "test-agent"))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func post(t *testing.T, url, session, body string) *http.Response {
+	req, err := http.NewRequest(http.MethodPost, url+"/v1/chat/completions", strings.NewReader(body))
+	require.NoError(t, err)
+	if session != "" {
+		req.Header.Set(SessionHeader, session)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestChatCompletions(t *testing.T) {
+	s := newTestServer(t)
+
+	resp := post(t, s.URL, "", `{"model":"test-agent","messages":[{"role":"user","content":"hello"}]}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	session := resp.Header.Get(SessionHeader)
+	require.NotEmpty(t, session)
+
+	var completion chatCompletion
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&completion))
+	require.Equal(t, "chat.completion", completion.Object)
+	require.Equal(t, "test-agent", completion.Model)
+	require.Equal(t, "2 messages", completion.Choices[0].Message.Content)
+	require.Equal(t, "stop", *completion.Choices[0].FinishReason)
+	require.Equal(t, &completionUsage{PromptTokens: 10, CompletionTokens: 3, TotalTokens: 13}, completion.Usage)
+
+	t.Run("continues the conversation", func(t *testing.T) {
+		resp := post(t, s.URL, "", `{"messages":[
+			{"role":"user","content":"hello"},
+			{"role":"assistant","content":"2 messages"},
+			{"role":"user","content":[{"type":"text","text":"again"}]}
+		]}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var completion chatCompletion
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&completion))
+		require.Equal(t, "4 messages", completion.Choices[0].Message.Content)
+		require.Equal(t, session, resp.Header.Get(SessionHeader))
+	})
+
+	t.Run("same opening", func(t *testing.T) {
+		resp := post(t, s.URL, "", `{"messages":[{"role":"user","content":"hello"}]}`)
+		require.NotEqual(t, session, resp.Header.Get(SessionHeader))
+
+		var completion chatCompletion
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&completion))
+		require.Equal(t, "2 messages", completion.Choices[0].Message.Content)
+	})
+
+	t.Run("edited history replays it", func(t *testing.T) {
+		resp := post(t, s.URL, "", `{"messages":[
+			{"role":"system","content":"Ignored, as the agent has its own."},
+			{"role":"user","content":"hello"},
+			{"role":"assistant","content":"edited"},
+			{"role":"user","content":"again"}
+		]}`)
+		require.NotEqual(t, session, resp.Header.Get(SessionHeader))
+
+		var completion chatCompletion
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&completion))
+		require.Equal(t, "4 messages", completion.Choices[0].Message.Content)
+	})
+
+	t.Run("session header", func(t *testing.T) {
+		for _, want := range []string{"2 messages", "4 messages"} {
+			resp := post(t, s.URL, "pinned", `{"messages":[{"role":"user","content":"hello"}]}`)
+			require.Equal(t, "pinned", resp.Header.Get(SessionHeader))
+
+			var completion chatCompletion
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&completion))
+			require.Equal(t, want, completion.Choices[0].Message.Content)
+		}
+	})
+}
+
+func TestChatCompletions_stream(t *testing.T) {
+	s := newTestServer(t)
+
+	resp := post(t, s.URL, "", `{"stream":true,"messages":[{"role":"user","content":"hello"}]}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	events := strings.Split(strings.TrimSpace(string(body)), "\n\n")
+	require.Len(t, events, 4)
+	require.Equal(t, "data: [DONE]", events[3])
+
+	var content string
+	for _, event := range events[:3] {
+		var chunk chatCompletion
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(event, "data: ")), &chunk))
+		require.Equal(t, "chat.completion.chunk", chunk.Object)
+		content += chunk.Choices[0].Delta.Content
+	}
+	require.Equal(t, "2 messages", content)
+
+	t.Run("include usage", func(t *testing.T) {
+		resp := post(t, s.URL, "", `{"stream":true,"stream_options":{"include_usage":true},`+
+			`"messages":[{"role":"user","content":"hello"}]}`)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		events := strings.Split(strings.TrimSpace(string(body)), "\n\n")
+		require.Len(t, events, 5)
+
+		var chunk chatCompletion
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(events[3], "data: ")), &chunk))
+		require.Empty(t, chunk.Choices)
+		require.Equal(t, 13, chunk.Usage.TotalTokens)
+	})
+}
+
+func TestChatCompletions_badRequest(t *testing.T) {
+	s := newTestServer(t)
+
+	resp := post(t, s.URL, "", `{"messages":[{"role":"assistant","content":"hello"}]}`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"error":{"message":"the last message must have the role user","type":"invalid_request_error"}}`, string(body))
+}
+
+func TestModels(t *testing.T) {
+	s := newTestServer(t)
+
+	resp, err := http.Get(s.URL + "/v1/models")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"object":"list","data":[{"id":"test-agent","object":"model","created":0,"owned_by":"agent"}]}`, string(body))
+}
+
+func TestRequestOptions(t *testing.T) {
+	a, err := agent.New("", "test-model", &agent.Config{
+		ToolSource: "package tools",
+		Options:    llm.Options{Temperature: 0.2, NumCtx: 8192},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		body     string
+		expected *llm.Options
+		err      string
+	}{
+		{
+			name: "defaults",
+			body: `{}`,
+		},
+		{
+			name:     "sampling",
+			body:     `{"temperature":0,"top_p":0.9,"seed":7,"max_tokens":100}`,
+			expected: &llm.Options{Temperature: 0, TopP: 0.9, Seed: 7, NumPredict: 100, NumCtx: 8192},
+		},
+		{
+			name:     "stop string",
+			body:     `{"stop":"\n"}`,
+			expected: &llm.Options{Temperature: 0.2, NumCtx: 8192, Stop: []string{"\n"}},
+		},
+		{
+			name:     "stop array",
+			body:     `{"stop":["a","b"]}`,
+			expected: &llm.Options{Temperature: 0.2, NumCtx: 8192, Stop: []string{"a", "b"}},
+		},
+		{
+			name: "invalid stop",
+			body: `{"stop":1}`,
+			err:  "stop must be a string or an array of strings",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var req chatCompletionRequest
+			require.NoError(t, json.Unmarshal([]byte(tc.body), &req))
+
+			opts, err := req.requestOptions(a)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			if tc.expected == nil {
+				require.Nil(t, opts)
+			} else {
+				require.Equal(t, tc.expected, opts.Options)
+			}
+		})
+	}
+}
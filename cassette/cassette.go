@@ -0,0 +1,156 @@
+// Package cassette records LLM HTTP traffic to a file, and replays it, so
+// tests and demos can run in CI without Ollama. Recording once against a real
+// model gives realistic responses, including tool calls and streaming.
+//
+// Parakeet doesn't accept an http.Client, so Install replaces
+// http.DefaultTransport, which its requests use.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// Version is the format version written by Recorder. Load refuses versions
+// it doesn't understand.
+const Version = 1
+
+// Cassette is a JSON record of HTTP requests and their responses.
+type Cassette struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded request.
+type Request struct {
+	Method string `json:"method"`
+	// URL is the original URL. Only its path and query are matched, so that
+	// replay works when the server address changes.
+	URL string `json:"url"`
+	// Body is the normalized request body: JSON with sorted keys and no
+	// whitespace, or a JSON string when the body isn't JSON. Random values,
+	// such as the nonce of guarded tool results, are replaced.
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// Response is a recorded response.
+type Response struct {
+	Status int `json:"status"`
+	// ContentType is the only header kept, as others, such as Date, change.
+	ContentType string `json:"content_type,omitempty"`
+	// Body is the response body, unless it was streamed.
+	Body string `json:"body,omitempty"`
+	// Chunks are the events of a streamed response, such as each
+	// server-sent event or line of newline-delimited JSON.
+	Chunks []string `json:"chunks,omitempty"`
+}
+
+// Load reads a cassette previously written by a Recorder.
+func Load(path string) (*Cassette, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	var c Cassette
+	if err = json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette: %w", err)
+	}
+	if c.Version != Version {
+		return nil, fmt.Errorf("unsupported cassette version %d, expected %d", c.Version, Version)
+	}
+	// Bodies are indented in the file, so normalize them again to match.
+	for i := range c.Interactions {
+		c.Interactions[i].Request.Body = Normalize(c.Interactions[i].Request.Body)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette to path, replacing it atomically.
+func (c *Cassette) Save(path string) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c); err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create cassette: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+	if _, err = tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save cassette: %w", err)
+	}
+	return nil
+}
+
+// untrustedContentID matches the id of the delimiters guard.Guard adds to
+// tool results. The id is random for each process, so an agent's requests
+// after its first tool call wouldn't match when replayed.
+var untrustedContentID = regexp.MustCompile(`(untrusted-content id=\\?")[0-9a-f]+`)
+
+// Normalize returns body in the form recorded in Request.Body, so that
+// requests match regardless of JSON key order, whitespace or random values.
+func Normalize(body []byte) json.RawMessage {
+	b := normalizeJSON(body)
+	if b == nil {
+		return nil
+	}
+	return untrustedContentID.ReplaceAll(b, []byte("${1}nonce"))
+}
+
+// normalizeJSON sorts keys and removes whitespace, or returns a JSON string
+// when body isn't JSON.
+func normalizeJSON(body []byte) json.RawMessage {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	// Numbers are kept as written, as float64 could change them.
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err == nil && !dec.More() {
+		// Keep prompts readable, instead of escaping characters like '<'.
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err == nil {
+			return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+		}
+	}
+	b, _ := json.Marshal(string(body))
+	return b
+}
+
+// matches returns true if the recorded request matches req, whose body was
+// normalized.
+func (r *Request) matches(req *http.Request, body json.RawMessage) bool {
+	if r.Method != req.Method {
+		return false
+	}
+	recorded, err := url.Parse(r.URL)
+	if err != nil || recorded.RequestURI() != req.URL.RequestURI() {
+		return false
+	}
+	return bytes.Equal(r.Body, body)
+}
@@ -0,0 +1,236 @@
+package cassette
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/codefromthecrypt/practical-genai-go/agent/dev"
+	"github.com/codefromthecrypt/practical-genai-go/guard"
+	"github.com/codefromthecrypt/practical-genai-go/llmtest"
+	"github.com/parakeet-nest/parakeet/completion"
+	"github.com/parakeet-nest/parakeet/embeddings"
+	"github.com/parakeet-nest/parakeet/llm"
+	"github.com/stretchr/testify/require"
+)
+
+// session makes the calls of a RAG request, returning what the caller saw,
+// including each streamed chunk.
+func session(t *testing.T, url string) []string {
+	var seen []string
+	embedding, err := embeddings.CreateEmbeddingWithOpenAI(url+"/v1",
+		llm.OpenAIQuery4Embedding{Model: "embed-model", Input: "What's new?"}, "question")
+	require.NoError(t, err)
+	require.NotEmpty(t, embedding.Embedding)
+
+	answer, err := completion.Chat(url, llm.Query{
+		Model:    "test-model",
+		Messages: []llm.Message{{Role: "user", Content: "List the files"}},
+	})
+	require.NoError(t, err)
+	seen = append(seen, answer.Message.ToolCalls[0].Function.Name)
+
+	_, err = completion.ChatWithOpenAIStream(url+"/v1", llm.OpenAIQuery{Model: "test-model"},
+		func(chunk llm.OpenAIAnswer) error {
+			seen = append(seen, chunk.Choices[0].Delta.Content)
+			return nil
+		})
+	require.NoError(t, err)
+	return seen
+}
+
+func install(t *testing.T, path string, mode Mode) {
+	uninstall, err := Install(path, mode)
+	require.NoError(t, err)
+	t.Cleanup(uninstall)
+}
+
+func TestRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	ollama := llmtest.NewServer(t,
+		llmtest.ToolCall("shell", map[string]any{"command": "ls"}),
+		llmtest.Text("Go 1.24 adds testing.B.Loop."),
+	)
+	t.Run("record", func(t *testing.T) {
+		install(t, path, Record)
+		require.Equal(t, []string{"shell", "", "Go ", "1.24 ", "adds ", "testing.B.Loop.", ""}, session(t, ollama.URL))
+	})
+
+	c, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, c.Interactions, 3)
+	require.Equal(t, "POST", c.Interactions[1].Request.Method)
+	require.Equal(t, ollama.URL+"/api/chat", c.Interactions[1].Request.URL)
+	require.Contains(t, string(c.Interactions[1].Request.Body), `"messages":[{"content":"List the files","role":"user"}]`)
+	stream := c.Interactions[2].Response
+	require.Equal(t, "text/event-stream", stream.ContentType)
+	require.Len(t, stream.Chunks, 7)
+	require.Equal(t, "data: [DONE]\n\n", stream.Chunks[6])
+
+	t.Run("replay", func(t *testing.T) {
+		// Use a different address, to show only the path is matched.
+		install(t, path, Replay)
+		require.Equal(t, []string{"shell", "", "Go ", "1.24 ", "adds ", "testing.B.Loop.", ""}, session(t, "http://127.0.0.1:1"))
+	})
+}
+
+// agentSession runs an agent which reads a file, returning its answer.
+func agentSession(t *testing.T, url, dir string) string {
+	config, err := dev.ConfigIn(dir, "read_file")
+	require.NoError(t, err)
+	// Each process has a new guard, whose delimiters have a different nonce.
+	config.ToolMiddleware = []agent.ToolMiddleware{guard.New(guard.Policy{}).ToolMiddleware()}
+	a, err := agent.New(url, "test-model", config)
+	require.NoError(t, err)
+	result, err := a.Do(context.Background(), "What's in the README?", nil)
+	require.NoError(t, err)
+	return result.Content
+}
+
+func TestRecordReplay_agent(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Hello"), 0o644))
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	ollama := llmtest.NewServer(t,
+		llmtest.ToolCall("read_file", map[string]any{"path": "README.md"}),
+		llmtest.Text("It says hello."),
+	)
+	t.Run("record", func(t *testing.T) {
+		install(t, path, Record)
+		require.Equal(t, "It says hello.", agentSession(t, ollama.URL, dir))
+	})
+
+	c, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, c.Interactions, 3) // show, then a chat before and after the tool call
+	require.Contains(t, string(c.Interactions[2].Request.Body), `<untrusted-content id=\"nonce\" source=\"read_file\">`)
+
+	t.Run("replay", func(t *testing.T) {
+		install(t, path, Replay)
+		require.Equal(t, "It says hello.", agentSession(t, "http://127.0.0.1:1", dir))
+	})
+}
+
+func TestReplay_chunks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	c := &Cassette{Version: Version, Interactions: []Interaction{{
+		Request: Request{Method: "POST", URL: "http://localhost:11434/api/chat", Body: Normalize([]byte(`{"model":"m"}`))},
+		Response: Response{Status: 200, ContentType: "application/x-ndjson", Chunks: []string{
+			`{"message":{"content":"Hel"}}` + "\n",
+			`{"message":{"content":"lo"},"done":true}` + "\n",
+		}},
+	}}}
+	require.NoError(t, c.Save(path))
+
+	r, err := New(path, Replay, nil)
+	require.NoError(t, err)
+	client := &http.Client{Transport: r}
+	resp, err := client.Post("http://localhost:11434/api/chat", "application/json", strings.NewReader(`{ "model": "m" }`))
+	require.NoError(t, err)
+	require.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	// Each read returns one chunk, like a server flushing each.
+	var reads []string
+	buf := make([]byte, 1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		reads = append(reads, string(buf[:n]))
+	}
+	require.Equal(t, c.Interactions[0].Response.Chunks, reads)
+}
+
+func TestReplay_matching(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	c := &Cassette{Version: Version}
+	for _, answer := range []string{"first", "second"} {
+		c.Interactions = append(c.Interactions, Interaction{
+			Request:  Request{Method: "POST", URL: "http://localhost:11434/api/chat", Body: Normalize([]byte(`{"a":1,"b":[true]}`))},
+			Response: Response{Status: 200, Body: answer},
+		})
+	}
+	require.NoError(t, c.Save(path))
+
+	r, err := New(path, Replay, nil)
+	require.NoError(t, err)
+	client := &http.Client{Transport: r}
+	post := func(body string) (string, error) {
+		resp, err := client.Post("http://localhost:8080/api/chat", "application/json", strings.NewReader(body))
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		return string(b), err
+	}
+
+	// Identical requests replay in the order recorded, regardless of JSON
+	// key order or whitespace.
+	answer, err := post(`{"b": [true], "a": 1}`)
+	require.NoError(t, err)
+	require.Equal(t, "first", answer)
+	answer, err = post(`{"a":1,"b":[true]}`)
+	require.NoError(t, err)
+	require.Equal(t, "second", answer)
+
+	_, err = post(`{"a":1,"b":[true]}`)
+	require.ErrorContains(t, err, `has no response for POST /api/chat {"a":1,"b":[true]}`)
+	_, err = post(`{"a":2}`)
+	require.ErrorContains(t, err, `has no response for POST /api/chat {"a":2}`)
+}
+
+func TestNew_auto(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	r, err := New(path, Auto, nil)
+	require.NoError(t, err)
+	require.Equal(t, Record, r.Mode())
+
+	require.NoError(t, (&Cassette{Version: Version}).Save(path))
+	r, err = New(path, Auto, nil)
+	require.NoError(t, err)
+	require.Equal(t, Replay, r.Mode())
+
+	_, err = New(path, "rewind", nil)
+	require.EqualError(t, err, "unsupported cassette mode: rewind")
+}
+
+func TestLoad_unsupportedVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"version":2}`), 0o600))
+
+	_, err := Load(path)
+	require.EqualError(t, err, "unsupported cassette version 2, expected 1")
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name, body, expected string
+	}{
+		{name: "empty"},
+		{name: "sorted keys", body: "{\n  \"b\": 1.50,\n  \"a\": \"<doc>\"\n}", expected: `{"a":"<doc>","b":1.50}`},
+		{name: "not JSON", body: "hello", expected: `"hello"`},
+		{name: "trailing data", body: `{} {}`, expected: `"{} {}"`},
+		{
+			name:     "guard nonce",
+			body:     `{"content":"<untrusted-content id=\"0a1b2c3d\" source=\"shell\">\nhi\n</untrusted-content id=\"0a1b2c3d\">"}`,
+			expected: `{"content":"<untrusted-content id=\"nonce\" source=\"shell\">\nhi\n</untrusted-content id=\"nonce\">"}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, string(Normalize([]byte(tc.body))))
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Mode is whether a Recorder records or replays.
+type Mode string
+
+const (
+	// Replay only replays recorded responses, failing requests that weren't
+	// recorded. Use this in CI.
+	Replay Mode = "replay"
+	// Record sends requests to the server, saving each response to a new
+	// cassette.
+	Record Mode = "record"
+	// Auto replays when the cassette exists, and records otherwise.
+	Auto Mode = "auto"
+)
+
+// Recorder is an http.RoundTripper which records or replays a cassette.
+type Recorder struct {
+	path string
+	mode Mode
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	cassette *Cassette
+	// used are interactions already replayed, so that identical requests
+	// replay in the order they were recorded.
+	used []bool
+}
+
+// New returns a Recorder for the cassette at path. When recording, requests
+// are sent with next, which defaults to http.DefaultTransport.
+func New(path string, mode Mode, next http.RoundTripper) (*Recorder, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	r := &Recorder{path: path, mode: mode, next: next}
+	if mode == Auto {
+		if _, err := os.Stat(path); err == nil {
+			r.mode = Replay
+		} else {
+			r.mode = Record
+		}
+	}
+	switch r.mode {
+	case Replay:
+		c, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		r.cassette, r.used = c, make([]bool, len(c.Interactions))
+	case Record:
+		r.cassette = &Cassette{Version: Version, Interactions: []Interaction{}}
+	default:
+		return nil, fmt.Errorf("unsupported cassette mode: %s", mode)
+	}
+	return r, nil
+}
+
+// Mode returns Replay or Record, resolving Auto.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	recorded := Request{Method: req.Method, URL: req.URL.String(), Body: Normalize(body)}
+	if r.mode == Replay {
+		return r.replay(req, recorded)
+	}
+
+	// Send a copy, as the body was read.
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := r.next.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+
+	response := Response{Status: resp.StatusCode, ContentType: resp.Header.Get("Content-Type")}
+	if delim := streamDelimiter(response.ContentType); delim != nil {
+		// Record chunks as the caller reads them, so streaming isn't delayed.
+		resp.Body = &recordingBody{ReadCloser: resp.Body, delim: delim, done: func(chunks []string, err error) {
+			if err != nil {
+				return // don't save a partial stream
+			}
+			response.Chunks = chunks
+			if err := r.add(Interaction{Request: recorded, Response: response}); err != nil {
+				log.Printf("Failed to record %s: %v", req.URL, err)
+			}
+		}}
+		return resp, nil
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	response.Body = string(b)
+	if err = r.add(Interaction{Request: recorded, Response: response}); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// add records an interaction, saving the cassette so that it is complete
+// even if the process exits early.
+func (r *Recorder) add(i Interaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, i)
+	return r.cassette.Save(r.path)
+}
+
+func (r *Recorder) replay(req *http.Request, recorded Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] || !interaction.Request.matches(req, recorded.Body) {
+			continue
+		}
+		r.used[i] = true
+		response := interaction.Response
+		resp := &http.Response{
+			Status:        fmt.Sprintf("%d %s", response.Status, http.StatusText(response.Status)),
+			StatusCode:    response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{},
+			ContentLength: int64(len(response.Body)),
+			Body:          io.NopCloser(bytes.NewReader([]byte(response.Body))),
+			Request:       req,
+		}
+		if response.ContentType != "" {
+			resp.Header.Set("Content-Type", response.ContentType)
+		}
+		if response.Chunks != nil {
+			resp.ContentLength = -1
+			resp.Body = &chunkReader{chunks: response.Chunks}
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("cassette %s has no response for %s %s %s", r.path, req.Method, req.URL.RequestURI(), truncate(recorded.Body))
+}
+
+// Install replaces http.DefaultTransport with a Recorder for the cassette at
+// path, until uninstall is called. Install after creating any clients that
+// need the original transport, such as Elasticsearch.
+func Install(path string, mode Mode) (uninstall func(), err error) {
+	previous := http.DefaultTransport
+	r, err := New(path, mode, previous)
+	if err != nil {
+		return nil, err
+	}
+	http.DefaultTransport = r
+	return func() { http.DefaultTransport = previous }, nil
+}
+
+// InstallFromEnv is like Install, using the cassette at $LLM_CASSETTE and the
+// mode $LLM_CASSETTE_MODE, which defaults to Auto. If LLM_CASSETTE isn't set,
+// it does nothing.
+func InstallFromEnv() (uninstall func(), err error) {
+	path := os.Getenv("LLM_CASSETTE")
+	if path == "" {
+		return func() {}, nil
+	}
+	mode := Mode(os.Getenv("LLM_CASSETTE_MODE"))
+	if mode == "" {
+		mode = Auto
+	}
+	return Install(path, mode)
+}
+
+// streamDelimiter returns the delimiter between chunks of a streamed content
+// type, or nil if it isn't streamed.
+func streamDelimiter(contentType string) []byte {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/event-stream":
+		return []byte("\n\n")
+	case "application/x-ndjson":
+		return []byte("\n")
+	}
+	return nil
+}
+
+// recordingBody splits a streamed body into chunks as it is read, calling
+// done once at EOF, on a read error or on close.
+type recordingBody struct {
+	io.ReadCloser
+	delim []byte
+	buf   bytes.Buffer
+	done  func(chunks []string, err error)
+	once  sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if errors.Is(err, io.EOF) {
+		b.finish(nil)
+	} else if err != nil {
+		b.finish(err)
+	}
+	return n, err
+}
+
+// Close records the rest of the stream, as clients may stop reading at an
+// end marker, such as "data: [DONE]", before EOF.
+func (b *recordingBody) Close() error {
+	_, err := io.Copy(&b.buf, b.ReadCloser)
+	b.finish(err)
+	return b.ReadCloser.Close()
+}
+
+func (b *recordingBody) finish(err error) {
+	b.once.Do(func() {
+		var chunks []string
+		for _, chunk := range bytes.SplitAfter(b.buf.Bytes(), b.delim) {
+			if len(chunk) > 0 {
+				chunks = append(chunks, string(chunk))
+			}
+		}
+		b.done(chunks, err)
+	})
+}
+
+// chunkReader replays chunks, returning at most one per Read, like a server
+// flushing each.
+type chunkReader struct {
+	chunks []string
+	offset int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0][r.offset:])
+	r.offset += n
+	if r.offset == len(r.chunks[0]) {
+		r.chunks, r.offset = r.chunks[1:], 0
+	}
+	return n, nil
+}
+
+func (r *chunkReader) Close() error {
+	return nil
+}
+
+func truncate(body json.RawMessage) string {
+	if len(body) > 200 {
+		return string(body[:200]) + "..."
+	}
+	return string(body)
+}
@@ -0,0 +1,242 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/codefromthecrypt/practical-genai-go/agent/definition"
+	"github.com/codefromthecrypt/practical-genai-go/agent/dev"
+	"github.com/codefromthecrypt/practical-genai-go/agent/mcp"
+	"github.com/codefromthecrypt/practical-genai-go/preflight"
+)
+
+// demoRequests are made when there is no prompt. Each request is a separate
+// turn in the same conversation.
+var demoRequests = []string{
+	// Ask the agent to do something that requires poking around the
+	// machine. This could be solved multiple ways given the functions
+	// we've allowed.
+	"Analyze each top-level directory in the current working directory." +
+		"Make a new file named READMUAH.md which describes each under the " +
+		"heading 'Parakeet examples'.",
+	// Since the agent is stateful, it will remember the last thing it did.
+	// It can revise or do something related to it without restating
+	// context.
+	"Add a thank you to GopherCon Singapore to the bottom of that file " +
+		"as a new section. Write it in Singlish.",
+}
+
+// runAgent shows an agent can perform tasks for you, including figuring out
+// which tools to use. Notably, an agent isn't just retrieving information, it
+// is performing operations so you don't have to.
+//
+// This agent was written to be easy to explain in a conference, so it doesn't
+// do anything fancy. Real agents are more than just an LLM, a good system
+// prompt and a few tools.
+//
+// For example, https://github.com/block/goose includes a plugin system,
+// context summarization, robust LLM handling, and work in progress towards
+// Model Context Protocol (MCP), which decouples tool, prompt and resource
+// definitions from the agents that use them.
+func runAgent(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	var c config
+	fs := newFlagSet("agent", stderr)
+	c.addFlags(fs)
+	prompt := fs.String("prompt", env("GENAI_PROMPT", ""), "request for the "+
+		"agent. Defaults to writing READMUAH.md, then thanking GopherCon "+
+		"Singapore in it. ($GENAI_PROMPT)")
+	interactive := fs.Bool("i", false, "make requests interactively, "+
+		"starting with -prompt if set. Type /help for commands.")
+	resume := fs.String("resume", "", "session transcript to resume, if it "+
+		"exists. The session is saved to it after each request.")
+	definitionPath := fs.String("definition", env("GENAI_AGENT_DEFINITION", ""),
+		"YAML file describing the agent to use instead of the dev agent. Its "+
+			"model and url replace -model and -url, and its budget any budget "+
+			"flags not set. ($GENAI_AGENT_DEFINITION)")
+	mcpConfig := fs.String("mcp-config", "", "JSON file of MCP servers "+
+		"whose tools the agent can use, in addition to the dev tools.")
+	deterministic := fs.Bool("deterministic", false, "use a zero "+
+		"temperature and fixed seed, so that runs are repeatable.")
+	fallbacks := fs.String("fallback-models", "", "comma-separated "+
+		"models to try in order when the model is unavailable, such as "+
+		"qwen2.5:7b.")
+	maxTokens := fs.Int("max-tokens", 0, "stop a request after it uses "+
+		"this many prompt and completion tokens. Zero is unlimited.")
+	maxDuration := fs.Duration("max-duration", 0, "stop a request after "+
+		"this long, such as 2m. Zero is unlimited.")
+	maxToolCalls := fs.Int("max-tool-calls", 0, "stop a request after it "+
+		"runs this many tools. Zero is unlimited.")
+	toolProtocol := fs.String("tool-protocol", "", "how the model calls "+
+		"tools: native or react. By default, react is used when Ollama "+
+		"reports the model doesn't support tools.")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	// The agent uses the native Ollama API, for tool calls and fallbacks.
+	if c.backend != "ollama" {
+		return usageError("the agent only supports the ollama backend")
+	}
+
+	requests := demoRequests
+	if *prompt != "" {
+		requests = []string{*prompt}
+	}
+
+	config := *dev.AgentConfig
+	budget := &agent.Budget{
+		MaxTokens:    *maxTokens,
+		MaxDuration:  *maxDuration,
+		MaxToolCalls: *maxToolCalls,
+	}
+	var servers []mcp.ServerConfig
+	if *definitionPath != "" {
+		d, err := definition.Load(*definitionPath)
+		if err != nil {
+			return err
+		}
+		defined, err := d.Config()
+		if err != nil {
+			return err
+		}
+		config, c.model, c.url, servers = *defined, d.Model, d.URL, d.Servers()
+		budget = mergeBudget(budget, d.RequestOptions().Budget)
+	}
+	if *deterministic {
+		config.Options = agent.Deterministic(config.Options)
+	}
+	if *toolProtocol != "" {
+		config.ToolProtocol = agent.ToolProtocol(*toolProtocol)
+	}
+	if *interactive {
+		// Show tools as they run, innermost so that results aren't annotated
+		// or redacted.
+		config.ToolMiddleware = append(slices.Clip(config.ToolMiddleware), showTools(stdout))
+	}
+	if *fallbacks != "" {
+		for _, m := range strings.Split(*fallbacks, ",") {
+			config.Fallbacks = append(config.Fallbacks, agent.Endpoint{Model: m})
+		}
+	}
+
+	// Check the models are ready before doing any work. Models without tool
+	// support still work with the ReAct protocol.
+	models := []preflight.Model{{
+		Name:          c.model,
+		Tools:         config.ToolProtocol == agent.ToolProtocolNative,
+		ContextLength: config.Options.NumCtx,
+	}}
+	for _, f := range config.Fallbacks {
+		m := models[0]
+		m.Name = f.Model
+		models = append(models, m)
+	}
+	stop, err := c.start(ctx, "agent", models...)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	// Add any tools from MCP servers, of the definition or -mcp-config.
+	if *mcpConfig != "" {
+		configured, err := mcp.LoadConfig(*mcpConfig)
+		if err != nil {
+			return err
+		}
+		servers = append(servers, configured...)
+	}
+	if len(servers) > 0 {
+		clients, err := mcp.StartAll(ctx, servers)
+		if err != nil {
+			return err
+		}
+		for _, client := range clients {
+			defer client.Close()
+			config.Toolboxes = append(config.Toolboxes, client)
+		}
+	}
+
+	// Initialize the agent and give it access to certain functions. If we are
+	// resuming, skip the requests the previous session already handled.
+	var a *agent.Agent
+	if transcript, loadErr := loadTranscript(*resume); loadErr != nil {
+		return loadErr
+	} else if transcript != nil {
+		a, err = agent.Resume(c.url, c.model, &config, transcript)
+		if *prompt == "" {
+			requests = requests[min(transcript.UserTurns(), len(requests)):]
+		}
+	} else {
+		a, err = agent.New(c.url, c.model, &config)
+	}
+	if err != nil {
+		return err
+	}
+
+	opts := &agent.RequestOptions{Budget: budget}
+	if *interactive {
+		r := &agentREPL{c: &c, config: &config, agent: a, opts: opts, resume: *resume,
+			transcript: *resume, stdout: stdout, stderr: stderr}
+		if r.transcript == "" {
+			r.transcript = newTranscriptPath()
+		}
+		return r.run(ctx, *prompt)
+	}
+	for _, request := range requests {
+		result, err := a.Do(ctx, request, opts)
+		// Save even on error, as the conversation may include tool calls
+		// which changed files.
+		if *resume != "" {
+			if saveErr := a.SaveTranscript(*resume); saveErr != nil {
+				fmt.Fprintln(stderr, "😡:", saveErr)
+			}
+		}
+		// Show what the agent was doing when it ran out of budget.
+		var budgetErr *agent.BudgetExceededError
+		if errors.As(err, &budgetErr) && result.Content != "" {
+			fmt.Fprintln(stdout, result.Content)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, result.Content)
+		fmt.Fprintln(stdout)
+		fmt.Fprintln(stdout, "📊", result.Usage)
+		fmt.Fprintln(stdout)
+	}
+	// When resuming, this includes requests made by previous sessions.
+	fmt.Fprintln(stdout, "📊 session:", a.Usage())
+	return nil
+}
+
+// mergeBudget returns flags, with any limits they don't set from defined.
+func mergeBudget(flags, defined *agent.Budget) *agent.Budget {
+	merged := *defined
+	if flags.MaxTokens > 0 {
+		merged.MaxTokens = flags.MaxTokens
+	}
+	if flags.MaxDuration > 0 {
+		merged.MaxDuration = flags.MaxDuration
+	}
+	if flags.MaxToolCalls > 0 {
+		merged.MaxToolCalls = flags.MaxToolCalls
+	}
+	return &merged
+}
+
+// loadTranscript returns nil when path is empty or doesn't exist yet.
+func loadTranscript(path string) (*agent.Transcript, error) {
+	if path == "" {
+		return nil, nil
+	}
+	transcript, err := agent.LoadTranscript(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return transcript, err
+}
@@ -0,0 +1,224 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/codefromthecrypt/practical-genai-go/preflight"
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// agentREPL is an interactive conversation with the agent.
+type agentREPL struct {
+	c      *config
+	config *agent.Config
+	agent  *agent.Agent
+	opts   *agent.RequestOptions
+	// resume is saved after each request, if set, and transcript on exit.
+	resume, transcript string
+	stdout, stderr     io.Writer
+}
+
+// run reads requests until input ends, starting with prompt if it isn't
+// empty, then saves the transcript.
+func (r *agentREPL) run(ctx context.Context, prompt string) error {
+	loop := &repl{
+		prompt:  "agent> ",
+		history: historyPath("agent"),
+		handle:  r.request,
+		stdout:  r.stdout,
+		commands: []replCommand{
+			{"reset", "", "start a new conversation", r.reset},
+			{"save", "[path]", "save the transcript, by default to " + r.transcript, r.save},
+			{"load", "path", "continue the conversation in a transcript", r.load},
+			{"tools", "", "list the tools the agent can use", r.tools},
+			{"model", "[name]", "show or change the model", r.model},
+			{"usage", "", "show the usage of the session", r.usage},
+			{"undo", "", "remove the last request from the conversation", r.undo},
+		},
+	}
+	err := loop.run(ctx, prompt)
+	if saveErr := r.agent.SaveTranscript(r.transcript); saveErr != nil {
+		return errors.Join(err, saveErr)
+	}
+	fmt.Fprintln(r.stdout, "📝 transcript:", r.transcript)
+	return err
+}
+
+// request sends a request to the agent, and writes its answer.
+func (r *agentREPL) request(ctx context.Context, request string) error {
+	result, err := r.agent.Do(ctx, request, r.opts)
+	// Save even on error, as the conversation may include tool calls
+	// which changed files.
+	if r.resume != "" {
+		if saveErr := r.agent.SaveTranscript(r.resume); saveErr != nil {
+			fmt.Fprintln(r.stderr, "😡:", saveErr)
+		}
+	}
+	// Show what the agent was doing when it ran out of budget.
+	var budgetErr *agent.BudgetExceededError
+	if errors.As(err, &budgetErr) && result.Content != "" {
+		fmt.Fprintln(r.stdout, result.Content)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(r.stdout, result.Content)
+	fmt.Fprintln(r.stdout, "📊", result.Usage)
+	return nil
+}
+
+// reset starts a new conversation with a fresh agent, never one resumed from
+// a transcript.
+func (r *agentREPL) reset(context.Context, string) error {
+	a, err := agent.New(r.c.url, r.c.model, r.config)
+	if err != nil {
+		return err
+	}
+	if err = r.replace(a); err != nil {
+		return err
+	}
+	fmt.Fprintln(r.stdout, "🧹 started a new conversation")
+	return nil
+}
+
+// replace continues with a, saving it to resume right away, so that resuming
+// later doesn't bring back the conversation it replaced.
+func (r *agentREPL) replace(a *agent.Agent) error {
+	if r.resume != "" {
+		if err := a.SaveTranscript(r.resume); err != nil {
+			return err
+		}
+	}
+	r.agent = a
+	return nil
+}
+
+func (r *agentREPL) save(_ context.Context, path string) error {
+	if path == "" {
+		path = r.transcript
+	}
+	if err := r.agent.SaveTranscript(path); err != nil {
+		return err
+	}
+	fmt.Fprintln(r.stdout, "📝 saved to", path)
+	return nil
+}
+
+// load continues the conversation in a transcript with the current model.
+func (r *agentREPL) load(_ context.Context, path string) error {
+	if path == "" {
+		return errors.New("/load needs the path of a transcript")
+	}
+	t, err := agent.LoadTranscript(path)
+	if err != nil {
+		return err
+	}
+	a, err := agent.Resume(r.c.url, r.c.model, r.config, t)
+	if err != nil {
+		return err
+	}
+	if err = r.replace(a); err != nil {
+		return err
+	}
+	fmt.Fprintln(r.stdout, "📂 loaded", t.UserTurns(), "requests from", path)
+	return nil
+}
+
+func (r *agentREPL) tools(ctx context.Context, _ string) error {
+	tools, err := r.agent.ListTools(ctx)
+	if err != nil {
+		return err
+	}
+	for _, t := range tools {
+		description, _, _ := strings.Cut(t.Function.Description, "\n")
+		fmt.Fprintf(r.stdout, "  %-12s %s\n", t.Function.Name, description)
+	}
+	return nil
+}
+
+// model continues the conversation with another model, once it is ready.
+func (r *agentREPL) model(ctx context.Context, name string) error {
+	if name == "" {
+		fmt.Fprintln(r.stdout, r.c.model)
+		return nil
+	}
+	err := preflight.Check(ctx, r.c.url, preflight.Model{
+		Name:          name,
+		Tools:         r.config.ToolProtocol == agent.ToolProtocolNative,
+		ContextLength: r.config.Options.NumCtx,
+	})
+	if err != nil {
+		return err
+	}
+	a, err := agent.Resume(r.c.url, name, r.config, r.agent.Transcript())
+	if err != nil {
+		return err
+	}
+	if err = r.replace(a); err != nil {
+		return err
+	}
+	r.c.model = name
+	fmt.Fprintln(r.stdout, "🔀 switched to", name)
+	return nil
+}
+
+func (r *agentREPL) usage(context.Context, string) error {
+	fmt.Fprintln(r.stdout, "📊 session:", r.agent.Usage())
+	return nil
+}
+
+func (r *agentREPL) undo(context.Context, string) error {
+	request, ok := r.agent.Undo()
+	if !ok {
+		return errors.New("there is no request to undo")
+	}
+	fmt.Fprintf(r.stdout, "↩️  removed %q, though files it changed stay changed\n", request)
+	return nil
+}
+
+// newTranscriptPath returns a new file to save the transcript of a REPL
+// session to, when not resuming one.
+func newTranscriptPath() string {
+	name := "genai-agent-" + time.Now().Format("20060102-150405") + ".json"
+	return filepath.Join(os.TempDir(), name)
+}
+
+// showTools is a ToolMiddleware which writes each tool call and its result
+// to w as it happens.
+func showTools(w io.Writer) agent.ToolMiddleware {
+	return func(next agent.ToolHandler) agent.ToolHandler {
+		return func(ctx context.Context, toolCall llm.FunctionTool) (string, error) {
+			arguments, _ := json.Marshal(toolCall.Arguments)
+			fmt.Fprintf(w, "🔧 %s %s\n", toolCall.Name, arguments)
+			result, err := next(ctx, toolCall)
+			if err != nil {
+				fmt.Fprintln(w, "❌", err)
+			} else {
+				fmt.Fprintln(w, "✅", preview(result))
+			}
+			return result, err
+		}
+	}
+}
+
+// preview returns the first line of s, shortened to fit on a terminal line.
+func preview(s string) string {
+	s = strings.TrimSpace(s)
+	line, _, more := strings.Cut(s, "\n")
+	if runes := []rune(line); len(runes) > 100 {
+		line, more = string(runes[:100]), true
+	}
+	if more {
+		line += fmt.Sprintf(" … (%d bytes)", len(s))
+	}
+	return line
+}
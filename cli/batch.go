@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/codefromthecrypt/practical-genai-go/agent/batch"
+	"github.com/codefromthecrypt/practical-genai-go/agent/dev"
+	"github.com/codefromthecrypt/practical-genai-go/preflight"
+)
+
+// tasksFailedError is when the batch ran, but not all tasks succeeded.
+type tasksFailedError struct {
+	failed, total int
+}
+
+func (e tasksFailedError) Error() string {
+	return fmt.Sprintf("%d of %d tasks didn't succeed", e.failed, e.total)
+}
+
+// runAgentBatch runs the dev agent over each task in a JSONL file, such as in
+// CI, writing a result for each as JSONL.
+func runAgentBatch(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	var c config
+	fs := newFlagSet("agent batch", stderr)
+	c.addFlags(fs)
+	tasksPath := fs.String("tasks", "", "JSONL file of tasks, each with a "+
+		"prompt, and optionally an id, dir, tools and budget. - reads stdin.")
+	out := fs.String("out", "-", "file to write a JSONL result for each "+
+		"task to. - writes stdout.")
+	concurrency := fs.Int("concurrency", 1, "how many tasks run at the "+
+		"same time. Ollama handles up to OLLAMA_NUM_PARALLEL at once.")
+	deterministic := fs.Bool("deterministic", false, "use a zero "+
+		"temperature and fixed seed, so that runs are repeatable.")
+	maxTokens := fs.Int("max-tokens", 0, "stop a task after it uses "+
+		"this many prompt and completion tokens, unless it sets its own. "+
+		"Zero is unlimited.")
+	maxDuration := fs.Duration("max-duration", 0, "stop a task after "+
+		"this long, such as 2m, unless it sets its own. Zero is unlimited.")
+	maxToolCalls := fs.Int("max-tool-calls", 0, "stop a task after it "+
+		"runs this many tools, unless it sets its own. Zero is unlimited.")
+	toolProtocol := fs.String("tool-protocol", "", "how the model calls "+
+		"tools: native or react. By default, react is used when Ollama "+
+		"reports the model doesn't support tools.")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if c.backend != "ollama" {
+		return usageError("the agent only supports the ollama backend")
+	}
+	if *tasksPath == "" {
+		return usageError("-tasks is required")
+	}
+	if *concurrency < 1 {
+		return usageError("-concurrency must be at least 1")
+	}
+
+	// Read the tasks first, so that mistakes in them fail fast.
+	tasks, err := loadTasks(*tasksPath)
+	if err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		return fmt.Errorf("%s has no tasks", *tasksPath)
+	}
+
+	newConfig := func(dir string, tools ...string) (*agent.Config, error) {
+		config, err := dev.ConfigIn(dir, tools...)
+		if err != nil {
+			return nil, err
+		}
+		if *deterministic {
+			config.Options = agent.Deterministic(config.Options)
+		}
+		config.ToolProtocol = agent.ToolProtocol(*toolProtocol)
+		return config, nil
+	}
+	stop, err := c.start(ctx, "agent-batch", preflight.Model{
+		Name:          c.model,
+		Tools:         agent.ToolProtocol(*toolProtocol) == agent.ToolProtocolNative,
+		ContextLength: dev.AgentConfig.Options.NumCtx,
+	})
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	w := stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	runner := &batch.Runner{
+		URL:         c.url,
+		Model:       c.model,
+		Config:      newConfig,
+		Concurrency: *concurrency,
+		Budget: &agent.Budget{
+			MaxTokens:    *maxTokens,
+			MaxDuration:  *maxDuration,
+			MaxToolCalls: *maxToolCalls,
+		},
+	}
+	results, err := runner.Run(ctx, tasks, w)
+	if err != nil {
+		return err
+	}
+
+	// Summarize on stderr, so that stdout is only results.
+	counts := map[batch.Status]int{}
+	for _, r := range results {
+		counts[r.Status]++
+	}
+	var summary []string
+	for _, s := range []batch.Status{batch.StatusSucceeded, batch.StatusFailed, batch.StatusBudgetExceeded, batch.StatusCanceled} {
+		if counts[s] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[s], strings.ReplaceAll(string(s), "_", " ")))
+		}
+	}
+	fmt.Fprintf(stderr, "📊 %d tasks: %s\n", len(tasks), strings.Join(summary, ", "))
+	if failed := len(tasks) - counts[batch.StatusSucceeded]; failed > 0 {
+		return tasksFailedError{failed, len(tasks)}
+	}
+	return nil
+}
+
+// loadTasks reads tasks from path, or stdin if it is "-".
+func loadTasks(path string) ([]batch.Task, error) {
+	if path == "-" {
+		return batch.LoadTasks(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tasks, err := batch.LoadTasks(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return tasks, nil
+}
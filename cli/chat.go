@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/codefromthecrypt/practical-genai-go/preflight"
+	"github.com/codefromthecrypt/practical-genai-go/telemetry"
+	"github.com/codefromthecrypt/practical-genai-go/usage"
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// runChat completes a chat, then a follow-up message, or chats interactively.
+func runChat(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	var c config
+	fs := newFlagSet("chat", stderr)
+	c.addFlags(fs)
+	question := fs.String("prompt", env("GENAI_PROMPT", "Answer in up to 3 words: Which ocean contains Bouvet Island?"),
+		"first question. ($GENAI_PROMPT)")
+	secondQuestion := fs.String("follow-up", "What’s the capital?",
+		"question which follows the answer to the first. Empty skips it.")
+	system := fs.String("system", env("GENAI_SYSTEM", ""), "system prompt. ($GENAI_SYSTEM)")
+	systemFile := fs.String("system-file", "", "file to read the system prompt from, instead of -system.")
+	interactive := fs.Bool("i", false, "chat interactively, starting with "+
+		"-prompt if set. Type /help for commands.")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if *systemFile != "" {
+		b, err := os.ReadFile(*systemFile)
+		if err != nil {
+			return err
+		}
+		*system = string(b)
+	}
+
+	stop, err := c.start(ctx, "chat", preflight.Model{Name: c.model})
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	if *interactive {
+		// Only start with the prompt when it isn't the default question.
+		var first string
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name == "prompt" {
+				first = *question
+			}
+		})
+		if os.Getenv("GENAI_PROMPT") != "" {
+			first = *question
+		}
+		r := &chatREPL{c: &c, system: *system, stdout: stdout}
+		return r.run(ctx, first)
+	}
+
+	// Trace both questions together, as they are the same conversation.
+	ctx, span := telemetry.Tracer().Start(ctx, "chat")
+	defer span.End()
+
+	q := llm.OpenAIQuery{
+		Model:    c.model,
+		Messages: []llm.Message{{Role: "user", Content: *question}},
+	}
+	if *system != "" {
+		q.Messages = append([]llm.Message{{Role: "system", Content: *system}}, q.Messages...)
+	}
+
+	var u usage.Usage
+	start := time.Now()
+	answer, err := telemetry.ChatWithOpenAI(ctx, c.openAIURL(), q)
+	if err != nil {
+		return err
+	}
+	u.AddOpenAIAnswer(answer, time.Since(start))
+	response := answer.Choices[0].Message
+	fmt.Fprintln(stdout, "Question:", *question)
+	fmt.Fprintln(stdout, "Answer:", response.Content)
+
+	fmt.Fprintln(stdout)
+
+	if *secondQuestion != "" {
+		q.Messages = append(q.Messages,
+			llm.Message{Role: response.Role, Content: response.Content},
+			llm.Message{Role: "user", Content: *secondQuestion},
+		)
+		start = time.Now()
+		answer, err = telemetry.ChatWithOpenAI(ctx, c.openAIURL(), q)
+		if err != nil {
+			return err
+		}
+		u.AddOpenAIAnswer(answer, time.Since(start))
+		response = answer.Choices[0].Message
+		fmt.Fprintln(stdout, "Follow-up Question:", *secondQuestion)
+		fmt.Fprintln(stdout, "Answer:", response.Content)
+
+		fmt.Fprintln(stdout)
+	}
+	// The second question costs more tokens, as it resends the first.
+	fmt.Fprintln(stdout, "📊", u)
+	return nil
+}
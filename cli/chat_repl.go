@@ -0,0 +1,204 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/codefromthecrypt/practical-genai-go/preflight"
+	"github.com/codefromthecrypt/practical-genai-go/telemetry"
+	"github.com/codefromthecrypt/practical-genai-go/usage"
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// chatREPL is an interactive chat, which streams each answer.
+type chatREPL struct {
+	c      *config
+	system string
+	// messages are the conversation, excluding the system prompt.
+	messages []llm.Message
+	usage    usage.Usage
+	stdout   io.Writer
+}
+
+// run reads messages until input ends, starting with prompt if it isn't
+// empty.
+func (r *chatREPL) run(ctx context.Context, prompt string) error {
+	loop := &repl{
+		prompt:  "chat> ",
+		history: historyPath("chat"),
+		handle:  r.send,
+		stdout:  r.stdout,
+		commands: []replCommand{
+			{"model", "[name]", "show or change the model", r.model},
+			{"backend", "[name]", "show or change the backend: ollama or llama-server", r.backend},
+			{"clear", "", "clear the conversation, except the system prompt", r.clear},
+			{"regenerate", "", "replace the last answer with a new one", r.regenerate},
+			{"save", "path", "save the conversation as JSON if path ends in .json, otherwise markdown", r.save},
+			{"usage", "", "show the usage of the session", r.showUsage},
+		},
+	}
+	return loop.run(ctx, prompt)
+}
+
+// send adds the user's message to the conversation, and streams the answer.
+func (r *chatREPL) send(ctx context.Context, message string) error {
+	r.messages = append(r.messages, llm.Message{Role: "user", Content: message})
+	if err := r.answer(ctx); err != nil {
+		// Drop the message, so that it can be sent again.
+		r.messages = r.messages[:len(r.messages)-1]
+		return err
+	}
+	return nil
+}
+
+// answer streams the answer to the conversation, and adds it.
+func (r *chatREPL) answer(ctx context.Context) error {
+	q := llm.OpenAIQuery{Model: r.c.model, Messages: r.messages}
+	if r.system != "" {
+		q.Messages = append([]llm.Message{{Role: "system", Content: r.system}}, r.messages...)
+	}
+
+	var content strings.Builder
+	start := time.Now()
+	answer, err := telemetry.ChatWithOpenAIStream(ctx, r.c.openAIURL(), q,
+		func(answer llm.OpenAIAnswer) error {
+			// Parakeet doesn't accept a context, so stop reading on Ctrl-C.
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			// A final chunk can have only usage, and no choices.
+			if len(answer.Choices) == 0 {
+				return nil
+			}
+			fmt.Fprint(r.stdout, answer.Choices[0].Delta.Content)
+			content.WriteString(answer.Choices[0].Delta.Content)
+			return nil
+		})
+	fmt.Fprintln(r.stdout)
+	if err != nil {
+		return err
+	}
+	r.usage.AddOpenAIAnswer(answer, time.Since(start))
+	r.messages = append(r.messages, llm.Message{Role: "assistant", Content: content.String()})
+	return nil
+}
+
+// model continues the conversation with another model, once it is ready.
+func (r *chatREPL) model(ctx context.Context, name string) error {
+	if name == "" {
+		fmt.Fprintln(r.stdout, r.c.model)
+		return nil
+	}
+	if err := r.check(ctx, r.c.backend, r.c.url, name); err != nil {
+		return err
+	}
+	r.c.model = name
+	fmt.Fprintln(r.stdout, "🔀 switched to", name)
+	return nil
+}
+
+// backend continues the conversation on another backend, at its default URL
+// and with its default model.
+func (r *chatREPL) backend(ctx context.Context, name string) error {
+	if name == "" {
+		fmt.Fprintln(r.stdout, r.c.backend, r.c.url)
+		return nil
+	}
+	b, ok := backends[name]
+	if !ok {
+		return fmt.Errorf("unsupported backend: %s", name)
+	}
+	if err := r.check(ctx, name, b.url, b.model); err != nil {
+		return err
+	}
+	r.c.backend, r.c.url, r.c.model = name, b.url, b.model
+	fmt.Fprintln(r.stdout, "🔀 switched to", name, b.url, "with", b.model)
+	return nil
+}
+
+// check checks the model is ready, if the backend can tell.
+func (r *chatREPL) check(ctx context.Context, backend, url, model string) error {
+	if backend != "ollama" {
+		return nil
+	}
+	return preflight.Check(ctx, url, preflight.Model{Name: model})
+}
+
+func (r *chatREPL) clear(context.Context, string) error {
+	r.messages = nil
+	fmt.Fprintln(r.stdout, "🧹 cleared the conversation")
+	return nil
+}
+
+func (r *chatREPL) regenerate(ctx context.Context, _ string) error {
+	n := len(r.messages)
+	if n == 0 || r.messages[n-1].Role != "assistant" {
+		return errors.New("there is no answer to regenerate")
+	}
+	last := r.messages[n-1]
+	r.messages = r.messages[:n-1]
+	if err := r.answer(ctx); err != nil {
+		// Keep the last answer, so that the conversation still has one.
+		r.messages = append(r.messages, last)
+		return err
+	}
+	return nil
+}
+
+func (r *chatREPL) save(_ context.Context, path string) error {
+	if path == "" {
+		return errors.New("/save needs a path, such as chat.md or chat.json")
+	}
+	var b []byte
+	if filepath.Ext(path) == ".json" {
+		t := chatTranscript{Backend: r.c.backend, Model: r.c.model, System: r.system, Messages: r.messages}
+		var err error
+		if b, err = json.MarshalIndent(t, "", "  "); err != nil {
+			return err
+		}
+	} else {
+		b = []byte(r.markdown())
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintln(r.stdout, "📝 saved to", path)
+	return nil
+}
+
+func (r *chatREPL) showUsage(context.Context, string) error {
+	fmt.Fprintln(r.stdout, "📊 session:", r.usage)
+	return nil
+}
+
+// chatTranscript is a conversation saved as JSON.
+type chatTranscript struct {
+	Backend  string        `json:"backend"`
+	Model    string        `json:"model"`
+	System   string        `json:"system,omitempty"`
+	Messages []llm.Message `json:"messages"`
+}
+
+// markdown returns the conversation with a heading for each message.
+func (r *chatREPL) markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Chat with %s\n", r.c.model)
+	if r.system != "" {
+		fmt.Fprintf(&b, "\n## System\n\n%s\n", strings.TrimSpace(r.system))
+	}
+	for _, m := range r.messages {
+		role := "User"
+		if m.Role == "assistant" {
+			role = "Assistant"
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n", role, strings.TrimSpace(m.Content))
+	}
+	return b.String()
+}
@@ -0,0 +1,150 @@
+// Package cli is the genai command, which runs each demo as a subcommand:
+//
+//	genai chat
+//	genai context
+//	genai rag index
+//	genai rag ask
+//	genai agent
+//	genai agent batch
+//
+// All commands share flags for the backend, URL and model, which default to
+// environment variables, also read from a .env file in the current directory.
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/codefromthecrypt/practical-genai-go/preflight"
+	"github.com/joho/godotenv"
+)
+
+// Exit codes returned by Run.
+const (
+	// ExitOK is when the command succeeded, or help was requested.
+	ExitOK = 0
+	// ExitError is when the command failed, such as an LLM error.
+	ExitError = 1
+	// ExitUsage is when the command line is invalid, such as an unknown flag.
+	ExitUsage = 2
+	// ExitUnavailable is when the backend or its models aren't ready.
+	ExitUnavailable = 3
+	// ExitTasksFailed is when "agent batch" wrote results, but not all tasks
+	// succeeded.
+	ExitTasksFailed = 4
+)
+
+// command is a subcommand, such as "rag ask".
+type command struct {
+	name, summary string
+	run           func(ctx context.Context, args []string, stdout, stderr io.Writer) error
+}
+
+// commands are matched in order, so "agent batch" is before "agent".
+var commands = []command{
+	{"chat", "complete a chat, then a follow-up message", runChat},
+	{"context", "answer a question about markdown added to the system context", runContext},
+	{"rag index", "store embeddings of markdown sections in Elasticsearch", runRAGIndex},
+	{"rag ask", "answer a question using the sections most similar to it", runRAGAsk},
+	{"agent batch", "perform each task in a JSONL file, writing JSONL results", runAgentBatch},
+	{"agent", "perform tasks in the current directory with the dev agent", runAgent},
+}
+
+// errInvalidFlags is returned when flags don't parse. The flag package
+// reports why, along with the usage of the command.
+var errInvalidFlags = errors.New("invalid flags")
+
+// usageError is a problem with the command line, as opposed to running it.
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+// Run runs the command in args, which excludes the program name, and returns
+// its exit code.
+func Run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		printUsage(stderr)
+		if len(args) == 0 {
+			return ExitUsage
+		}
+		return ExitOK
+	}
+
+	cmd, args, ok := lookup(args)
+	if !ok {
+		fmt.Fprintln(stderr, "😡: unknown command:", strings.Join(args, " "))
+		printUsage(stderr)
+		return ExitUsage
+	}
+
+	err := godotenv.Load()
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil // .env is optional
+	}
+	if err == nil {
+		err = cmd.run(ctx, args, stdout, stderr)
+	}
+	return exitCode(stderr, err)
+}
+
+// lookup returns the command at the start of args, and the args after it.
+func lookup(args []string) (command, []string, bool) {
+	for _, cmd := range commands {
+		name := strings.Fields(cmd.name)
+		if len(args) >= len(name) && strings.Join(args[:len(name)], " ") == cmd.name {
+			return cmd, args[len(name):], true
+		}
+	}
+	return command{}, args, false
+}
+
+// exitCode reports err, if any, and returns the exit code for it.
+func exitCode(stderr io.Writer, err error) int {
+	var usageErr usageError
+	var preflightErr *preflight.Error
+	var tasksErr tasksFailedError
+	switch {
+	case err == nil || errors.Is(err, flag.ErrHelp):
+		return ExitOK
+	case errors.Is(err, errInvalidFlags):
+		return ExitUsage // the flag package already reported it
+	case errors.As(err, &usageErr):
+		fmt.Fprintln(stderr, "😡:", err)
+		return ExitUsage
+	case errors.As(err, &preflightErr):
+		fmt.Fprintln(stderr, "😡:", err)
+		return ExitUnavailable
+	case errors.As(err, &tasksErr):
+		fmt.Fprintln(stderr, "😡:", err)
+		return ExitTasksFailed
+	default:
+		fmt.Fprintln(stderr, "😡:", err)
+		return ExitError
+	}
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: genai <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "genai <command> -h" for the flags of a command.`)
+}
+
+// newFlagSet returns a flag set for the command name, which reports errors
+// to stderr.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("genai "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
@@ -0,0 +1,270 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codefromthecrypt/practical-genai-go/llmtest"
+	"github.com/parakeet-nest/parakeet/llm"
+	"github.com/stretchr/testify/require"
+)
+
+// run runs args with Run, returning the exit code, stdout and stderr.
+func run(args ...string) (int, string, string) {
+	var stdout, stderr strings.Builder
+	code := Run(context.Background(), args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func newOllama(t *testing.T, replies ...llmtest.Reply) *llmtest.Server {
+	ollama := llmtest.NewServer(t, replies...)
+	ollama.Models = []llmtest.Model{{Name: "qwen2.5:14b", Capabilities: []string{"completion", "tools"}, ContextLength: 32768}}
+	t.Setenv("GENAI_URL", ollama.URL)
+	return ollama
+}
+
+func TestRun_usage(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		expectedCode   int
+		expectedStderr string
+	}{
+		{
+			name:           "no command",
+			expectedCode:   ExitUsage,
+			expectedStderr: "Usage: genai <command> [flags]",
+		},
+		{
+			name:           "help",
+			args:           []string{"-h"},
+			expectedCode:   ExitOK,
+			expectedStderr: "  rag ask      answer a question",
+		},
+		{
+			name:           "command help",
+			args:           []string{"rag", "ask", "-h"},
+			expectedCode:   ExitOK,
+			expectedStderr: "Usage of genai rag ask:",
+		},
+		{
+			name:           "unknown command",
+			args:           []string{"rag", "query"},
+			expectedCode:   ExitUsage,
+			expectedStderr: "😡: unknown command: rag query",
+		},
+		{
+			name:           "unknown flag",
+			args:           []string{"chat", "-temperature", "0"},
+			expectedCode:   ExitUsage,
+			expectedStderr: "flag provided but not defined: -temperature",
+		},
+		{
+			name:           "arguments",
+			args:           []string{"chat", "hello"},
+			expectedCode:   ExitUsage,
+			expectedStderr: "😡: unexpected arguments: hello",
+		},
+		{
+			name:           "unsupported backend",
+			args:           []string{"context", "-backend", "vllm"},
+			expectedCode:   ExitUsage,
+			expectedStderr: "😡: unsupported backend: vllm",
+		},
+		{
+			name:           "agent on llama-server",
+			args:           []string{"agent", "-backend", "llama-server"},
+			expectedCode:   ExitUsage,
+			expectedStderr: "😡: the agent only supports the ollama backend",
+		},
+		{
+			name:           "agent batch without tasks",
+			args:           []string{"agent", "batch"},
+			expectedCode:   ExitUsage,
+			expectedStderr: "😡: -tasks is required",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			code, stdout, stderr := run(tc.args...)
+			require.Equal(t, tc.expectedCode, code)
+			require.Empty(t, stdout)
+			require.Contains(t, stderr, tc.expectedStderr)
+		})
+	}
+}
+
+func TestRun_chat(t *testing.T) {
+	ollama := newOllama(t, llmtest.Text("Southern Ocean"), llmtest.Text("It has none."))
+
+	code, stdout, stderr := run("chat")
+	require.Equal(t, ExitOK, code, stderr)
+	require.Contains(t, stdout, "Question: Answer in up to 3 words: Which ocean contains Bouvet Island?\nAnswer: Southern Ocean\n")
+	require.Contains(t, stdout, "Follow-up Question: What’s the capital?\nAnswer: It has none.\n")
+
+	requests := ollama.Requests()
+	require.Len(t, requests, 2)
+	require.Equal(t, "/v1/chat/completions", requests[0].Path)
+	require.Equal(t, "qwen2.5:14b", requests[0].Model)
+	require.Len(t, requests[1].Messages, 3)
+}
+
+func TestRun_config(t *testing.T) {
+	ollama := newOllama(t)
+	ollama.Models = append(ollama.Models, llmtest.Model{Name: "gemma2:2b"}, llmtest.Model{Name: "qwen2.5:7b"})
+
+	tests := []struct {
+		name          string
+		env           map[string]string
+		args          []string
+		expectedModel string
+	}{
+		{
+			name:          "default",
+			expectedModel: "qwen2.5:14b",
+		},
+		{
+			name:          "env",
+			env:           map[string]string{"GENAI_MODEL": "qwen2.5:7b", "GENAI_PROMPT": "Hi"},
+			expectedModel: "qwen2.5:7b",
+		},
+		{
+			name:          "flag overrides env",
+			env:           map[string]string{"GENAI_MODEL": "qwen2.5:7b"},
+			args:          []string{"-model", "gemma2:2b", "-prompt", "Hi"},
+			expectedModel: "gemma2:2b",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			ollama.Script(llmtest.Text("Hello"))
+
+			code, _, stderr := run(append([]string{"chat", "-follow-up", ""}, tc.args...)...)
+			require.Equal(t, ExitOK, code, stderr)
+
+			requests := ollama.Requests()
+			last := requests[len(requests)-1]
+			require.Equal(t, tc.expectedModel, last.Model)
+			if tc.env["GENAI_PROMPT"] != "" || tc.args != nil {
+				require.Equal(t, []llm.Message{{Role: "user", Content: "Hi"}}, last.Messages)
+			}
+		})
+	}
+}
+
+func TestRun_errors(t *testing.T) {
+	t.Run("model missing", func(t *testing.T) {
+		newOllama(t)
+		code, _, stderr := run("context", "-model", "llama3.2:1b")
+		require.Equal(t, ExitUnavailable, code)
+		require.Contains(t, stderr, "llama3.2:1b isn't pulled")
+	})
+
+	t.Run("backend down", func(t *testing.T) {
+		code, _, stderr := run("chat", "-url", "http://127.0.0.1:1")
+		require.Equal(t, ExitUnavailable, code)
+		require.Contains(t, stderr, "Ollama isn't available")
+	})
+
+	t.Run("LLM error", func(t *testing.T) {
+		newOllama(t, llmtest.Error(500))
+		code, _, stderr := run("chat")
+		require.Equal(t, ExitError, code)
+		require.Contains(t, stderr, "😡: status code: 500")
+	})
+
+	t.Run("file missing", func(t *testing.T) {
+		code, _, stderr := run("context", "-file", filepath.Join(t.TempDir(), "missing.md"))
+		require.Equal(t, ExitError, code)
+		require.Contains(t, stderr, "no such file or directory")
+	})
+}
+
+func TestRun_context(t *testing.T) {
+	// llama-server has no model APIs, so there is no preflight check.
+	ollama := llmtest.NewServer(t, llmtest.Text("Maps use Swiss tables."))
+	file := filepath.Join(t.TempDir(), "maps.md")
+	require.NoError(t, os.WriteFile(file, []byte("## Maps\n\nMaps are now implemented with Swiss tables."), 0o644))
+
+	code, stdout, stderr := run("context", "-backend", "llama-server", "-url", ollama.URL,
+		"-file", file, "-prompt", "What's new with maps?")
+	require.Equal(t, ExitOK, code, stderr)
+	require.Equal(t, "Maps use Swiss tables.\n", stdout)
+
+	requests := ollama.Requests()
+	require.Len(t, requests, 1)
+	require.Equal(t, "ignored", requests[0].Model)
+	require.Contains(t, requests[0].Messages[1].Content, "<doc>\n## Maps\n\nMaps are now implemented with Swiss tables.")
+	require.Equal(t, llm.Message{Role: "user", Content: "What's new with maps?"}, requests[0].Messages[2])
+}
+
+func TestRun_agent(t *testing.T) {
+	ollama := newOllama(t, llmtest.Text("There are no files."))
+
+	code, stdout, stderr := run("agent", "-prompt", "List the files.")
+	require.Equal(t, ExitOK, code, stderr)
+	require.True(t, strings.HasPrefix(stdout, "There are no files.\n"), stdout)
+	require.Contains(t, stdout, "📊 session:")
+
+	requests := ollama.Requests()
+	require.Len(t, requests, 1)
+	require.Equal(t, "/api/chat", requests[0].Path)
+	last := requests[0].Messages[len(requests[0].Messages)-1]
+	require.Equal(t, llm.Message{Role: "user", Content: "List the files."}, last)
+}
+
+func TestRun_agent_definition(t *testing.T) {
+	ollama := newOllama(t, llmtest.Text("There are no problems."))
+	path := filepath.Join(t.TempDir(), "reviewer.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`name: reviewer
+model: qwen2.5:14b
+url: `+ollama.URL+`
+system_prompt: You review Go code.
+tools:
+  read_file:
+`), 0o644))
+	t.Setenv("GENAI_URL", "http://127.0.0.1:1") // replaced by the definition
+
+	code, stdout, stderr := run("agent", "-definition", path, "-prompt", "Review main.go.")
+	require.Equal(t, ExitOK, code, stderr)
+	require.True(t, strings.HasPrefix(stdout, "There are no problems.\n"), stdout)
+
+	requests := ollama.Requests()
+	require.Len(t, requests, 1)
+	require.Equal(t, []string{"read_file"}, requests[0].Tools)
+	require.True(t, strings.HasPrefix(requests[0].Messages[0].Content, "You review Go code.\n"), requests[0].Messages[0].Content)
+}
+
+func TestRun_agentBatch(t *testing.T) {
+	dir := t.TempDir()
+	ollama := newOllama(t,
+		llmtest.ToolCall("write_file", map[string]any{"path": "hello.txt", "content": "hello"}),
+		llmtest.Text("Wrote hello.txt."),
+		llmtest.ToolCall("shell", map[string]any{"command": "ls"}),
+		llmtest.ToolCall("shell", map[string]any{"command": "ls -a"}),
+	)
+	tasks := filepath.Join(dir, "tasks.jsonl")
+	require.NoError(t, os.WriteFile(tasks, []byte(
+		`{"id": "write", "prompt": "Write hello.txt", "dir": "`+dir+`", "tools": ["write_file"]}
+{"id": "loop", "prompt": "List the files", "dir": "`+dir+`", "budget": {"max_tool_calls": 1}}
+`), 0o644))
+
+	code, stdout, stderr := run("agent", "batch", "-tasks", tasks)
+	require.Equal(t, ExitTasksFailed, code, stderr)
+	require.Contains(t, stderr, "📊 2 tasks: 1 succeeded, 1 budget exceeded\n")
+	require.Contains(t, stderr, "😡: 1 of 2 tasks didn't succeed\n")
+	require.Zero(t, ollama.Remaining())
+
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[0], `"id":"write","status":"succeeded","answer":"Wrote hello.txt.","changed_files":["hello.txt"]`)
+	require.Contains(t, lines[1], `"id":"loop","status":"budget_exceeded"`)
+}
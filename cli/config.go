@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/codefromthecrypt/practical-genai-go/cassette"
+	"github.com/codefromthecrypt/practical-genai-go/metrics"
+	"github.com/codefromthecrypt/practical-genai-go/preflight"
+	"github.com/codefromthecrypt/practical-genai-go/telemetry"
+)
+
+// backend is a server which runs the models.
+type backend struct {
+	url, model string
+}
+
+var backends = map[string]backend{
+	// ollama serve; ollama pull qwen2.5:14b
+	"ollama": {"http://localhost:11434", "qwen2.5:14b"},
+	// llama-server --log-disable --hf-repo Qwen/Qwen2.5-7B-Instruct-GGUF --hf-file qwen2.5-7b-instruct-q4_k_m.gguf
+	"llama-server": {"http://localhost:8080", "ignored"},
+}
+
+// config is shared by the commands. Each field is set by a flag, which
+// defaults to an environment variable, so it can also be set in a .env file.
+type config struct {
+	backend, url, model string
+	metricsAddr         string
+	pull                bool
+
+	// embeddingModel, embeddingLength and index are only used by RAG.
+	embeddingModel  string
+	embeddingLength int
+	index           string
+}
+
+// addFlags adds the flags of the backend and models.
+func (c *config) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.backend, "backend", env("GENAI_BACKEND", "ollama"),
+		"server which runs the models: ollama or llama-server. ($GENAI_BACKEND)")
+	fs.StringVar(&c.url, "url", env("GENAI_URL", ""),
+		"base URL of the backend. Defaults to its local address. ($GENAI_URL)")
+	fs.StringVar(&c.model, "model", env("GENAI_MODEL", ""),
+		"chat model. Defaults to qwen2.5:14b on Ollama. ($GENAI_MODEL)")
+	fs.StringVar(&c.metricsAddr, "metrics-addr", env("METRICS_ADDR", ""),
+		"serve Prometheus metrics on this address while running, such as "+
+			"localhost:9464. ($METRICS_ADDR)")
+	fs.BoolVar(&c.pull, "pull", env("PULL_MODELS", "") == "true",
+		"pull missing Ollama models. ($PULL_MODELS)")
+}
+
+// addRAGFlags adds the flags of the embedding model and the index.
+func (c *config) addRAGFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.embeddingModel, "embedding-model", env("GENAI_EMBEDDING_MODEL", "mxbai-embed-large"),
+		"model which creates embeddings. ($GENAI_EMBEDDING_MODEL)")
+	fs.IntVar(&c.embeddingLength, "embedding-length", envInt("GENAI_EMBEDDING_LENGTH", 1024),
+		"dimension of embeddings in the index. ($GENAI_EMBEDDING_LENGTH)")
+	fs.StringVar(&c.index, "index", env("GENAI_INDEX", "mxbai-golang-index"),
+		"Elasticsearch index of the embeddings. ($GENAI_INDEX)")
+}
+
+// parse parses args, then defaults the URL and model to those of the
+// backend. No arguments are allowed after the flags.
+func (c *config) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return err
+	} else if err != nil {
+		return errInvalidFlags
+	}
+	if fs.NArg() > 0 {
+		return usageError(fmt.Sprintf("unexpected arguments: %s", strings.Join(fs.Args(), " ")))
+	}
+	b, ok := backends[c.backend]
+	if !ok {
+		return usageError(fmt.Sprintf("unsupported backend: %s", c.backend))
+	}
+	if c.url == "" {
+		c.url = b.url
+	}
+	c.url = strings.TrimSuffix(c.url, "/")
+	if c.model == "" {
+		c.model = b.model
+	}
+	return nil
+}
+
+// openAIURL is the base URL of the OpenAI-compatible API of the backend.
+func (c *config) openAIURL() string {
+	return c.url + "/v1"
+}
+
+// start sets up telemetry, metrics and any cassette for the command named
+// service, then checks the models are ready. Call stop when the command ends.
+func (c *config) start(ctx context.Context, service string, models ...preflight.Model) (stop func(), err error) {
+	var stops []func()
+	stopAll := func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+	}
+	defer func() {
+		if err != nil {
+			stopAll()
+		}
+	}()
+
+	shutdown, err := telemetry.Setup(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	stops = append(stops, func() { shutdown(context.Background()) })
+
+	stopMetrics, err := metrics.Serve(c.metricsAddr)
+	if err != nil {
+		return nil, err
+	}
+	stops = append(stops, func() { stopMetrics(context.Background()) })
+
+	// Record or replay LLM traffic when LLM_CASSETTE is set.
+	uninstall, err := cassette.InstallFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	stops = append(stops, uninstall)
+
+	// Only Ollama lists and pulls models, llama-server has the one it started
+	// with.
+	if c.backend != "ollama" {
+		return stopAll, nil
+	}
+	if c.pull {
+		if err = preflight.PullMissing(ctx, c.url, models...); err != nil {
+			return nil, err
+		}
+	}
+	if err = preflight.Check(ctx, c.url, models...); err != nil {
+		return nil, err
+	}
+	return stopAll, nil
+}
+
+// env returns the environment variable named key, or def if it is empty.
+func env(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envInt is like env, but for integers. Invalid values are ignored.
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
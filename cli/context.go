@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/codefromthecrypt/practical-genai-go/preflight"
+	"github.com/codefromthecrypt/practical-genai-go/telemetry"
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// benchmarkNotes is the default context: the part of the Go 1.24 release
+// notes about benchmarks.
+const benchmarkNotes = `
+### New benchmark function
+
+Benchmarks may now use the faster and less error-prone [testing.B.Loop](/pkg/testing#B.Loop) method to perform benchmark iterations like for b.Loop() { ... } in place of the typical loop structures involving b.N like for range b.N. This offers two significant advantages:
+- The benchmark function will execute exactly once per -count, so expensive setup and cleanup steps execute only once.
+- Function call parameters and results are kept alive, preventing the compiler from fully optimizing away the loop body.
+
+#### [testing](/pkg/testing/)
+
+The new [T.Context](/pkg/testing#T.Context) and [B.Context](/pkg/testing#B.Context) methods return a context that's canceled
+after the test completes and before test cleanup functions run.
+
+<!-- testing.B.Loop mentioned in 6-stdlib/6-testing-bloop.md. -->
+
+The new [T.Chdir](/pkg/testing#T.Chdir) and [B.Chdir](/pkg/testing#B.Chdir) methods can be used to change the working
+directory for the duration of a test or benchmark.
+`
+
+// defaultQuestion is about the release notes, for the context and RAG
+// commands.
+const defaultQuestion = "Summarize what's new with benchmarks in 3 bullet points. Be succinct"
+
+// runContext adds markdown into the system context, so that the LLM considers
+// new information when answering.
+func runContext(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	var c config
+	fs := newFlagSet("context", stderr)
+	c.addFlags(fs)
+	userContent := fs.String("prompt", env("GENAI_PROMPT", defaultQuestion),
+		"question about the markdown. ($GENAI_PROMPT)")
+	file := fs.String("file", "", "markdown file to add to the context. "+
+		"Defaults to the Go 1.24 release notes about benchmarks.")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+
+	doc := benchmarkNotes
+	if *file != "" {
+		b, err := os.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		doc = string(b)
+	}
+
+	stop, err := c.start(ctx, "markdown-context", preflight.Model{Name: c.model})
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	systemContent := `You are a Golang expert.
+	Using only the below provided context, answer the user's question
+	to the best of your ability using only the resources provided.
+	`
+
+	contextContent := "<context>\n\t\t<doc>\n" + doc + "\n\t\t</doc>\n\t</context>"
+
+	query := llm.OpenAIQuery{
+		Model: c.model,
+		Messages: []llm.Message{
+			{Role: "system", Content: systemContent},
+			{Role: "system", Content: contextContent},
+			{Role: "user", Content: *userContent},
+		},
+	}
+
+	// Answer the question
+	_, err = telemetry.ChatWithOpenAIStream(ctx, c.openAIURL(), query,
+		func(answer llm.OpenAIAnswer) error {
+			// A final chunk can have only usage, and no choices.
+			if len(answer.Choices) == 0 {
+				return nil
+			}
+			fmt.Fprint(stdout, answer.Choices[0].Delta.Content)
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout)
+	return nil
+}
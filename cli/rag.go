@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/codefromthecrypt/practical-genai-go/markdown-rag/rag"
+	"github.com/codefromthecrypt/practical-genai-go/preflight"
+	"github.com/codefromthecrypt/practical-genai-go/telemetry"
+	"github.com/parakeet-nest/parakeet/content"
+	"github.com/parakeet-nest/parakeet/embeddings"
+)
+
+// runRAGIndex stores an embedding of each section of markdown in
+// Elasticsearch.
+func runRAGIndex(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	var c config
+	fs := newFlagSet("rag index", stderr)
+	c.addFlags(fs)
+	c.addRAGFlags(fs)
+	file := fs.String("file", "", "markdown file to index. Defaults to the "+
+		"Go 1.24 release notes.")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+
+	doc := rag.GoReleaseNotes
+	if *file != "" {
+		b, err := os.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		doc = string(b)
+	}
+
+	elasticStore, err := newElasticStore(c.index)
+	if err != nil {
+		return err
+	}
+
+	stop, err := c.start(ctx, "create-embeddings", preflight.Model{
+		Name: c.embeddingModel, Embedding: true, EmbeddingLength: c.embeddingLength,
+	})
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	ctx, span := telemetry.Tracer().Start(ctx, "create-embeddings")
+	defer span.End()
+
+	chunks := content.ParseMarkdown(doc)
+	return rag.CreateEmbeddings(ctx, c.openAIURL(), c.embeddingModel, chunks, elasticStore, stdout)
+}
+
+// runRAGAsk answers a question using the sections in Elasticsearch most
+// similar to it.
+func runRAGAsk(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	var c config
+	fs := newFlagSet("rag ask", stderr)
+	c.addFlags(fs)
+	c.addRAGFlags(fs)
+	userContent := fs.String("prompt", env("GENAI_PROMPT", defaultQuestion),
+		"question about the indexed markdown. ($GENAI_PROMPT)")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+
+	elasticStore, err := newElasticStore(c.index)
+	if err != nil {
+		return err
+	}
+
+	stop, err := c.start(ctx, "use-embeddings",
+		preflight.Model{Name: c.embeddingModel, Embedding: true, EmbeddingLength: c.embeddingLength},
+		preflight.Model{Name: c.model},
+	)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	// Trace the search and answer together, as one RAG request.
+	ctx, span := telemetry.Tracer().Start(ctx, "use-embeddings")
+	defer span.End()
+
+	r := rag.RAG{URL: c.openAIURL(), EmbeddingsModel: c.embeddingModel, Model: c.model, Index: c.index, Store: elasticStore}
+	u, err := r.Answer(ctx, *userContent, stdout)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "📊", u)
+	return nil
+}
+
+// newElasticStore connects to the index in Elasticsearch at ELASTICSEARCH_URL.
+// Call this before c.start, so that Elasticsearch keeps the real transport
+// when a cassette is installed.
+func newElasticStore(index string) (*embeddings.ElasticsearchStore, error) {
+	elasticStore := embeddings.ElasticsearchStore{}
+	err := elasticStore.Initialize(
+		[]string{
+			os.Getenv("ELASTICSEARCH_URL"),
+		},
+		os.Getenv("ELASTICSEARCH_USER"),
+		os.Getenv("ELASTICSEARCH_PASSWORD"),
+		nil,
+		index,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &elasticStore, nil
+}
@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/peterh/liner"
+)
+
+// lineReader reads lines typed at a prompt. Prompt returns io.EOF when input
+// ends, such as on Ctrl-D, and liner.ErrPromptAborted on Ctrl-C.
+type lineReader interface {
+	Prompt(prompt string) (string, error)
+	AppendHistory(line string)
+	Close() error
+}
+
+// newLineReader returns a lineReader of the terminal, with line editing and
+// the history in historyPath, which is saved on Close. Tests replace this, as
+// liner always reads os.Stdin.
+var newLineReader = func(historyPath string) lineReader {
+	state := liner.NewLiner()
+	state.SetCtrlCAborts(true)
+	if f, err := os.Open(historyPath); err == nil {
+		state.ReadHistory(f)
+		f.Close()
+	}
+	return &terminal{State: state, historyPath: historyPath}
+}
+
+// terminal is a liner.State which saves its history when closed.
+type terminal struct {
+	*liner.State
+	historyPath string
+}
+
+func (t *terminal) Close() error {
+	if f, err := os.Create(t.historyPath); err == nil {
+		t.WriteHistory(f)
+		f.Close()
+	}
+	return t.State.Close()
+}
+
+// historyPath returns the file in the home directory which keeps the history
+// of the REPL named name, such as "agent".
+func historyPath(name string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = os.TempDir()
+	}
+	return filepath.Join(home, ".genai_"+name+"_history")
+}
+
+// replCommand is a slash command, such as "/usage".
+type replCommand struct {
+	name, args, summary string
+	run                 func(ctx context.Context, arg string) error
+}
+
+// repl reads lines until input ends or /exit. Lines starting with a slash run
+// a command, and others are passed to handle.
+//
+// Ctrl-C cancels the context of the line being handled, rather than quitting,
+// so that a slow request can be stopped. At the prompt, it clears the line.
+type repl struct {
+	prompt   string
+	history  string
+	commands []replCommand
+	handle   func(ctx context.Context, line string) error
+	stdout   io.Writer
+}
+
+// run runs the REPL, starting with first if it isn't empty.
+func (r *repl) run(ctx context.Context, first string) error {
+	// Ctrl-C is for the current line, so the parent being canceled by it
+	// doesn't end the REPL.
+	ctx = context.WithoutCancel(ctx)
+
+	lines := newLineReader(r.history)
+	defer lines.Close()
+
+	fmt.Fprintln(r.stdout, "Type /help for commands, or Ctrl-D to exit.")
+	line := first
+	for {
+		if line == "" {
+			var err error
+			line, err = lines.Prompt(r.prompt)
+			if errors.Is(err, liner.ErrPromptAborted) {
+				continue
+			} else if errors.Is(err, io.EOF) {
+				fmt.Fprintln(r.stdout)
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			lines.AppendHistory(line)
+		}
+
+		if line == "/exit" || line == "/quit" {
+			return nil
+		}
+		lineCtx, stop := signal.NotifyContext(ctx, os.Interrupt)
+		err := r.runLine(lineCtx, line)
+		canceled := lineCtx.Err() != nil
+		stop()
+		if canceled {
+			fmt.Fprintln(r.stdout, "🛑 canceled")
+		} else if err != nil {
+			fmt.Fprintln(r.stdout, "😡:", err)
+		}
+		line = ""
+	}
+}
+
+// runLine runs a slash command, or handles the line otherwise.
+func (r *repl) runLine(ctx context.Context, line string) error {
+	if !strings.HasPrefix(line, "/") {
+		return r.handle(ctx, line)
+	}
+	name, arg, _ := strings.Cut(line[1:], " ")
+	if name == "help" {
+		r.help()
+		return nil
+	}
+	for _, c := range r.commands {
+		if c.name == name {
+			return c.run(ctx, strings.TrimSpace(arg))
+		}
+	}
+	return fmt.Errorf("unknown command /%s, type /help for commands", name)
+}
+
+func (r *repl) help() {
+	for _, c := range r.commands {
+		fmt.Fprintf(r.stdout, "  %-16s %s\n", strings.TrimSpace("/"+c.name+" "+c.args), c.summary)
+	}
+	fmt.Fprintf(r.stdout, "  %-16s %s\n", "/exit", "exit, also Ctrl-D")
+}
@@ -0,0 +1,257 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codefromthecrypt/practical-genai-go/agent/agent"
+	"github.com/codefromthecrypt/practical-genai-go/llmtest"
+	"github.com/parakeet-nest/parakeet/llm"
+	"github.com/peterh/liner"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedLines is a lineReader which returns lines in order, then io.EOF.
+// A nil line is Ctrl-C.
+type scriptedLines struct {
+	lines   []*string
+	history []string
+}
+
+func (s *scriptedLines) Prompt(string) (string, error) {
+	if len(s.lines) == 0 {
+		return "", io.EOF
+	}
+	line := s.lines[0]
+	s.lines = s.lines[1:]
+	if line == nil {
+		return "", liner.ErrPromptAborted
+	}
+	return *line, nil
+}
+
+func (s *scriptedLines) AppendHistory(line string) {
+	s.history = append(s.history, line)
+}
+
+func (s *scriptedLines) Close() error {
+	return nil
+}
+
+// typeLines replaces the terminal with lines until the test ends.
+func typeLines(t *testing.T, lines ...*string) *scriptedLines {
+	s := &scriptedLines{lines: lines}
+	old := newLineReader
+	newLineReader = func(string) lineReader { return s }
+	t.Cleanup(func() { newLineReader = old })
+	return s
+}
+
+func line(s string) *string {
+	return &s
+}
+
+func TestRun_agentREPL(t *testing.T) {
+	ollama := newOllama(t,
+		llmtest.ToolCall("shell", map[string]any{"command": "echo hello"}),
+		llmtest.Text("It printed hello."),
+		llmtest.Text("Hello!"),
+	)
+	ollama.Models = append(ollama.Models, llmtest.Model{Name: "qwen2.5:7b", Capabilities: []string{"completion", "tools"}, ContextLength: 32768})
+	dir := t.TempDir()
+	session, saved := filepath.Join(dir, "session.json"), filepath.Join(dir, "saved.json")
+
+	lines := typeLines(t,
+		line("/tools"),
+		line("Run echo hello"),
+		nil, // Ctrl-C at the prompt clears the line
+		line("/usage"),
+		line("/undo"),
+		line("/undo"),
+		line("/model qwen2.5:7b"),
+		line("  Hi  "),
+		line("/save "+saved),
+		line("/reset"),
+		line("/load "+saved),
+		line("/bogus"),
+		line(""),
+	)
+
+	code, stdout, stderr := run("agent", "-i", "-resume", session)
+	require.Equal(t, ExitOK, code, stderr)
+	for _, expected := range []string{
+		"Type /help for commands, or Ctrl-D to exit.\n  shell ",
+		"🔧 shell {\"command\":\"echo hello\"}\n✅ hello\nIt printed hello.\n📊",
+		"📊 session: ",
+		"↩️  removed \"Run echo hello\", though files it changed stay changed\n",
+		"😡: there is no request to undo\n",
+		"🔀 switched to qwen2.5:7b\nHello!\n",
+		"📝 saved to " + saved + "\n",
+		"🧹 started a new conversation\n",
+		"📂 loaded 1 requests from " + saved + "\n",
+		"😡: unknown command /bogus, type /help for commands\n",
+		"📝 transcript: " + session + "\n",
+	} {
+		require.Contains(t, stdout, expected)
+	}
+	require.Equal(t, []string{"/tools", "Run echo hello", "/usage", "/undo", "/undo", "/model qwen2.5:7b", "Hi",
+		"/save " + saved, "/reset", "/load " + saved, "/bogus"}, lines.history)
+
+	// The request which was undone isn't sent again.
+	requests := ollama.Requests()
+	require.Len(t, requests, 3)
+	require.Equal(t, "qwen2.5:7b", requests[2].Model)
+	require.Len(t, requests[2].Messages, 2)
+
+	// The transcript is of the loaded conversation.
+	transcript, err := agent.LoadTranscript(session)
+	require.NoError(t, err)
+	require.Equal(t, "qwen2.5:7b", transcript.Model)
+	require.Equal(t, 1, transcript.UserTurns())
+}
+
+// checkedLines calls check before each prompt, such as to inspect files
+// between commands.
+type checkedLines struct {
+	*scriptedLines
+	check func()
+}
+
+func (c checkedLines) Prompt(p string) (string, error) {
+	c.check()
+	return c.scriptedLines.Prompt(p)
+}
+
+func TestRun_agentREPL_resetAfterResume(t *testing.T) {
+	newOllama(t, llmtest.Text("Hello!"))
+	session := filepath.Join(t.TempDir(), "session.json")
+	code, _, stderr := run("agent", "-prompt", "Hi", "-resume", session)
+	require.Equal(t, ExitOK, code, stderr)
+
+	// Record the requests in the session file before each prompt.
+	var turns []int
+	lines := checkedLines{&scriptedLines{lines: []*string{line("/reset")}}, func() {
+		transcript, err := agent.LoadTranscript(session)
+		require.NoError(t, err)
+		turns = append(turns, transcript.UserTurns())
+	}}
+	old := newLineReader
+	newLineReader = func(string) lineReader { return lines }
+	t.Cleanup(func() { newLineReader = old })
+
+	code, stdout, stderr := run("agent", "-i", "-resume", session)
+	require.Equal(t, ExitOK, code, stderr)
+	require.Contains(t, stdout, "🧹 started a new conversation\n")
+	// The reset was saved right away, so resuming after a crash doesn't
+	// bring back the old conversation.
+	require.Equal(t, []int{1, 0}, turns)
+}
+
+func TestRun_chatREPL(t *testing.T) {
+	ollama := newOllama(t, llmtest.Text("Hello!"), llmtest.Text("Hey!"), llmtest.Text("Good."))
+	ollama.Models = append(ollama.Models, llmtest.Model{Name: "qwen2.5:7b"})
+	dir := t.TempDir()
+	system := filepath.Join(dir, "system.md")
+	require.NoError(t, os.WriteFile(system, []byte("Be brief.\n"), 0o644))
+	md, js := filepath.Join(dir, "chat.md"), filepath.Join(dir, "chat.json")
+
+	typeLines(t,
+		line("/regenerate"),
+		line("Hi"),
+		line("/regenerate"),
+		line("/model qwen2.5:7b"),
+		line("How are you?"),
+		line("/save "+md),
+		line("/save "+js),
+		line("/backend"),
+		line("/backend vllm"),
+		line("/clear"),
+		line("/usage"),
+	)
+
+	code, stdout, stderr := run("chat", "-i", "-system-file", system)
+	require.Equal(t, ExitOK, code, stderr)
+	for _, expected := range []string{
+		"😡: there is no answer to regenerate\n",
+		"Hello!\nHey!\n🔀 switched to qwen2.5:7b\nGood.\n",
+		"📝 saved to " + md + "\n",
+		"ollama " + ollama.URL + "\n",
+		"😡: unsupported backend: vllm\n",
+		"🧹 cleared the conversation\n",
+		"📊 session: ",
+	} {
+		require.Contains(t, stdout, expected)
+	}
+
+	// Regenerating replaces the last answer, rather than adding to it.
+	requests := ollama.Requests()
+	require.Len(t, requests, 3)
+	require.True(t, requests[0].Stream)
+	require.Equal(t, requests[0].Messages, requests[1].Messages)
+	require.Equal(t, "qwen2.5:7b", requests[2].Model)
+	require.Equal(t, []llm.Message{
+		{Role: "system", Content: "Be brief.\n"},
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Hey!"},
+		{Role: "user", Content: "How are you?"},
+	}, requests[2].Messages)
+
+	b, err := os.ReadFile(md)
+	require.NoError(t, err)
+	require.Equal(t, `# Chat with qwen2.5:7b
+
+## System
+
+Be brief.
+
+## User
+
+Hi
+
+## Assistant
+
+Hey!
+
+## User
+
+How are you?
+
+## Assistant
+
+Good.
+`, string(b))
+
+	b, err = os.ReadFile(js)
+	require.NoError(t, err)
+	var transcript chatTranscript
+	require.NoError(t, json.Unmarshal(b, &transcript))
+	require.Equal(t, "ollama", transcript.Backend)
+	require.Equal(t, "Be brief.\n", transcript.System)
+	require.Len(t, transcript.Messages, 4)
+}
+
+func TestChatREPL_usageChunk(t *testing.T) {
+	// Some servers end the stream with a chunk that only has usage.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"choices":[{"index":0,"delta":{"role":"assistant","content":"Hello!"}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	var stdout strings.Builder
+	r := &chatREPL{c: &config{backend: "ollama", url: server.URL, model: "test-model"}, stdout: &stdout}
+	require.NoError(t, r.send(context.Background(), "Hi"))
+	require.Equal(t, "Hello!\n", stdout.String())
+	require.Equal(t, llm.Message{Role: "assistant", Content: "Hello!"}, r.messages[1])
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/codefromthecrypt/practical-genai-go/cli"
+)
+
+// main runs the demos as subcommands, configured by flags or environment
+// variables. For example, to ask a question with a smaller model:
+//
+//	go run ./cmd/genai chat -model qwen2.5:7b -prompt "Where is Bouvet Island?"
+//
+// Run it without arguments to list the commands.
+func main() {
+	// Interrupting stops the command, so that it can clean up.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := cli.Run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
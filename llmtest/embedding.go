@@ -0,0 +1,39 @@
+package llmtest
+
+import (
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Dimensions is the length of embeddings returned by Embedding.
+const Dimensions = 256
+
+// Embedding returns a normalized bag of words vector of text. Texts sharing
+// words have a higher cosine similarity, which is enough to test retrieval
+// without an embedding model.
+func Embedding(text string) []float64 {
+	v := make([]float64, Dimensions)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		h := fnv.New32a()
+		h.Write([]byte(word))
+		v[h.Sum32()%Dimensions]++
+	}
+
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm == 0 {
+		return v
+	}
+	norm = math.Sqrt(norm)
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
@@ -0,0 +1,204 @@
+// Package llmtest is a fake Ollama and OpenAI-compatible server, so code that
+// calls an LLM can be tested offline. Chat replies, including tool calls, are
+// scripted in order, and embeddings are computed from the words of the input.
+//
+// For example, to test a tool loop:
+//
+//	s := llmtest.NewServer(t,
+//		llmtest.ToolCall("shell", map[string]any{"command": "ls"}),
+//		llmtest.Text("There are two files."),
+//	)
+//	a, err := agent.New(s.URL, "test-model", config)
+package llmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// Reply is a scripted chat response.
+type Reply struct {
+	// Content is the text of the assistant message.
+	Content string
+	// ToolCalls are the tools the assistant asks to call.
+	ToolCalls []llm.ToolCall
+	// PromptTokens and CompletionTokens are the usage to report.
+	PromptTokens, CompletionTokens int
+	// Status, when not zero, fails the request with this HTTP status, such as
+	// 503.
+	Status int
+}
+
+// Text is a Reply with the given content.
+func Text(content string) Reply {
+	return Reply{Content: content}
+}
+
+// ToolCall is a Reply asking to call the named tool.
+func ToolCall(name string, arguments map[string]any) Reply {
+	return Reply{ToolCalls: []llm.ToolCall{{Function: llm.FunctionTool{Name: name, Arguments: arguments}}}}
+}
+
+// Error is a Reply that fails with the HTTP status.
+func Error(status int) Reply {
+	return Reply{Status: status}
+}
+
+// Model describes a model for Ollama's /api/tags and /api/show.
+type Model struct {
+	// Name includes the tag, such as "qwen2.5:14b" or
+	// "mxbai-embed-large:latest".
+	Name string
+	// Capabilities are what the model supports, such as "tools" or
+	// "embedding".
+	Capabilities []string
+	// ContextLength and EmbeddingLength are reported unless zero.
+	ContextLength, EmbeddingLength int
+}
+
+// Request is a request received by the Server.
+type Request struct {
+	// Path is the URL path, such as "/api/chat" or "/v1/embeddings".
+	Path string
+	// Model is the model requested.
+	Model string
+	// Messages are the messages of a chat request.
+	Messages []llm.Message
+	// Tools are the names of tools offered in a chat request.
+	Tools []string
+	// Stream is true when the response was streamed.
+	Stream bool
+	// Input is the text of an embeddings request.
+	Input []string
+}
+
+// Server is a fake LLM server, serving Ollama's /api/chat, /api/embeddings
+// and model APIs, and the OpenAI /v1/chat/completions and /v1/embeddings.
+type Server struct {
+	// URL is the base URL of the Ollama API, such as http://127.0.0.1:1234.
+	// Append "/v1" for the OpenAI API.
+	URL string
+	// Embed returns the embedding of text. Defaults to Embedding.
+	Embed func(text string) []float64
+	// Capabilities are what /api/show reports models support, unless they
+	// are in Models. Defaults to "completion" and "tools".
+	Capabilities []string
+	// Models are listed by /api/tags and described by /api/show, which
+	// reports other models are missing. When empty, /api/show describes any
+	// model with Capabilities. /api/pull adds to them.
+	Models []Model
+
+	t      testing.TB
+	server *httptest.Server
+
+	mu       sync.Mutex
+	replies  []Reply
+	requests []Request
+	ids      int
+}
+
+// NewServer starts a Server which answers chats with replies, in order. It
+// closes when the test ends.
+func NewServer(t testing.TB, replies ...Reply) *Server {
+	s := &Server{t: t, Embed: Embedding, Capabilities: []string{"completion", "tools"}, replies: replies}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/chat", s.ollamaChat)
+	mux.HandleFunc("POST /api/embeddings", s.ollamaEmbeddings)
+	mux.HandleFunc("GET /api/tags", s.ollamaTags)
+	mux.HandleFunc("POST /api/show", s.ollamaShow)
+	mux.HandleFunc("POST /api/pull", s.ollamaPull)
+	mux.HandleFunc("POST /v1/chat/completions", s.openAIChat)
+	mux.HandleFunc("POST /v1/embeddings", s.openAIEmbeddings)
+	s.server = httptest.NewServer(mux)
+	s.URL = s.server.URL
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// Script adds replies to answer after any already scripted.
+func (s *Server) Script(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = append(s.replies, replies...)
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Remaining returns the count of scripted replies not yet used, which is
+// usually zero at the end of a test.
+func (s *Server) Remaining() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.replies)
+}
+
+// record adds the request, and for chats returns the next reply. ok is false
+// when there is no reply, and the response was already written.
+func (s *Server) record(w http.ResponseWriter, r Request) (reply Reply, id string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r)
+	s.ids++
+	id = fmt.Sprintf("chatcmpl-%d", s.ids)
+	if r.Input != nil {
+		return Reply{}, id, true
+	}
+	if len(s.replies) == 0 {
+		s.t.Errorf("llmtest: no reply scripted for chat request %d", len(s.requests))
+		writeError(w, http.StatusInternalServerError, "no reply scripted")
+		return Reply{}, id, false
+	}
+	reply, s.replies = s.replies[0], s.replies[1:]
+	if reply.Status != 0 {
+		writeError(w, reply.Status, http.StatusText(reply.Status))
+		return reply, id, false
+	}
+	return reply, id, true
+}
+
+func (r Reply) finishReason() string {
+	if len(r.ToolCalls) > 0 {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error in the format of both Ollama and OpenAI, which
+// differ in whether "error" is a string or an object.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// decode reads the request body into v, or writes an error.
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func toolNames(tools []llm.Tool) []string {
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool.Function.Name)
+	}
+	return names
+}
@@ -0,0 +1,295 @@
+package llmtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/parakeet-nest/parakeet/completion"
+	"github.com/parakeet-nest/parakeet/embeddings"
+	"github.com/parakeet-nest/parakeet/llm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOllamaChat(t *testing.T) {
+	s := NewServer(t,
+		ToolCall("shell", map[string]any{"command": "ls"}),
+		Reply{Content: "There are two files.", PromptTokens: 42, CompletionTokens: 5},
+	)
+
+	q := llm.Query{
+		Model:    "test-model",
+		Messages: []llm.Message{{Role: "user", Content: "List the files"}},
+		Tools:    []llm.Tool{{Type: "function", Function: llm.Function{Name: "shell"}}},
+	}
+	answer, err := completion.Chat(s.URL, q)
+	require.NoError(t, err)
+	require.Equal(t, []llm.ToolCall{{Function: llm.FunctionTool{
+		Name:      "shell",
+		Arguments: map[string]any{"command": "ls"},
+	}}}, answer.Message.ToolCalls)
+
+	answer, err = completion.Chat(s.URL, q)
+	require.NoError(t, err)
+	require.Equal(t, "There are two files.", answer.Message.Content)
+	require.Equal(t, 42, answer.PromptEvalCount)
+	require.Equal(t, 5, answer.EvalCount)
+
+	require.Zero(t, s.Remaining())
+	requests := s.Requests()
+	require.Len(t, requests, 2)
+	require.Equal(t, Request{
+		Path:     "/api/chat",
+		Model:    "test-model",
+		Messages: q.Messages,
+		Tools:    []string{"shell"},
+	}, requests[0])
+}
+
+func TestOllamaChat_stream(t *testing.T) {
+	s := NewServer(t, Text("Hello there, gopher."))
+
+	var chunks []string
+	answer, err := completion.ChatStream(s.URL, llm.Query{Model: "test-model"}, func(answer llm.Answer) error {
+		chunks = append(chunks, answer.Message.Content)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Hello ", "there, ", "gopher.", ""}, chunks)
+	require.Equal(t, "Hello there, gopher.", answer.Message.Content)
+	require.True(t, answer.Done)
+	require.True(t, s.Requests()[0].Stream)
+}
+
+func TestOllamaEmbeddings(t *testing.T) {
+	s := NewServer(t)
+
+	resp, err := http.Post(s.URL+"/api/embeddings", "application/json",
+		strings.NewReader(`{"model":"embed-model","prompt":"Go 1.24 benchmarks"}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var body struct {
+		Embedding []float64 `json:"embedding"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, Embedding("Go 1.24 benchmarks"), body.Embedding)
+	require.Equal(t, []Request{{Path: "/api/embeddings", Model: "embed-model", Input: []string{"Go 1.24 benchmarks"}}}, s.Requests())
+}
+
+func TestOpenAIChat(t *testing.T) {
+	s := NewServer(t, Reply{Content: "There are two files.", PromptTokens: 42, CompletionTokens: 5})
+
+	q := llm.OpenAIQuery{Model: "test-model", Messages: []llm.Message{{Role: "user", Content: "List the files"}}}
+	answer, err := completion.ChatWithOpenAI(s.URL+"/v1", q)
+	require.NoError(t, err)
+	require.Equal(t, "chatcmpl-1", answer.ID)
+	require.Equal(t, "test-model", answer.Model)
+	require.Equal(t, "There are two files.", answer.Choices[0].Message.Content)
+	require.Equal(t, "stop", answer.Choices[0].FinishReason)
+	require.Equal(t, 47, answer.Usage.TotalTokens)
+
+	// Parakeet decodes tool call arguments as an object, so use plain HTTP to
+	// check they are a JSON string, like OpenAI.
+	t.Run("tool call arguments are JSON", func(t *testing.T) {
+		s.Script(ToolCall("shell", map[string]any{"command": "ls"}))
+		resp, err := http.Post(s.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{
+			"messages": [
+				{"role":"assistant","tool_calls":[{"id":"call_0","type":"function","function":{"name":"shell","arguments":"{\"command\":\"pwd\"}"}}]},
+				{"role":"user","content":[{"type":"text","text":"again"}]}
+			]
+		}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Contains(t, string(body), `"arguments":"{\"command\":\"ls\"}"`)
+		require.Contains(t, string(body), `"finish_reason":"tool_calls"`)
+
+		requests := s.Requests()
+		require.Equal(t, []llm.Message{
+			{Role: "assistant", ToolCalls: []llm.ToolCall{{Function: llm.FunctionTool{
+				Name:      "shell",
+				Arguments: map[string]any{"command": "pwd"},
+			}}}},
+			{Role: "user", Content: "again"},
+		}, requests[len(requests)-1].Messages)
+	})
+}
+
+func TestOpenAIChat_stream(t *testing.T) {
+	s := NewServer(t, Reply{Content: "Hello there, gopher.", PromptTokens: 42, CompletionTokens: 5})
+
+	var content string
+	answer, err := completion.ChatWithOpenAIStream(s.URL+"/v1", llm.OpenAIQuery{Model: "test-model"},
+		func(answer llm.OpenAIAnswer) error {
+			content += answer.Choices[0].Delta.Content
+			return nil
+		})
+	require.NoError(t, err)
+	require.Equal(t, "Hello there, gopher.", content)
+	require.Equal(t, "stop", answer.Choices[0].FinishReason)
+
+	t.Run("include usage", func(t *testing.T) {
+		s.Script(Reply{Content: "Hi", PromptTokens: 42, CompletionTokens: 1})
+		resp, err := http.Post(s.URL+"/v1/chat/completions", "application/json",
+			strings.NewReader(`{"stream":true,"stream_options":{"include_usage":true}}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		events := strings.Split(strings.TrimSpace(string(body)), "\n\n")
+		require.Len(t, events, 5)
+		require.Equal(t, "data: [DONE]", events[4])
+
+		var chunk llm.OpenAIAnswer
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(events[3], "data: ")), &chunk))
+		require.Empty(t, chunk.Choices)
+		require.Equal(t, 43, chunk.Usage.TotalTokens)
+	})
+}
+
+func TestOpenAIEmbeddings(t *testing.T) {
+	s := NewServer(t)
+
+	record, err := embeddings.CreateEmbeddingWithOpenAI(s.URL+"/v1",
+		llm.OpenAIQuery4Embedding{Model: "embed-model", Input: "Go 1.24 benchmarks"}, "question")
+	require.NoError(t, err)
+	require.Equal(t, "question", record.Id)
+	require.Equal(t, Embedding("Go 1.24 benchmarks"), record.Embedding)
+
+	t.Run("array input", func(t *testing.T) {
+		resp, err := http.Post(s.URL+"/v1/embeddings", "application/json",
+			bytes.NewReader([]byte(`{"model":"embed-model","input":["a","b"]}`)))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var body struct {
+			Data []struct {
+				Index     int       `json:"index"`
+				Embedding []float64 `json:"embedding"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		require.Len(t, body.Data, 2)
+		require.Equal(t, 1, body.Data[1].Index)
+		require.Equal(t, Embedding("b"), body.Data[1].Embedding)
+	})
+}
+
+func TestOllamaModels(t *testing.T) {
+	s := NewServer(t)
+	post := func(path, body string) string {
+		resp, err := http.Post(s.URL+path, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return strings.TrimSpace(string(b))
+	}
+
+	// Without models, any model is described with the default capabilities.
+	require.Equal(t, `{"capabilities":["completion","tools"],"model_info":{"general.architecture":"llmtest"}}`,
+		post("/api/show", `{"model":"qwen2.5:14b"}`))
+
+	s.Models = []Model{{Name: "mxbai-embed-large:latest", Capabilities: []string{"embedding"}, EmbeddingLength: 1024}}
+	require.Equal(t, `{"capabilities":["embedding"],"model_info":{"general.architecture":"llmtest","llmtest.embedding_length":1024}}`,
+		post("/api/show", `{"model":"mxbai-embed-large"}`))
+	require.Equal(t, `{"error":"model 'qwen2.5:14b' not found"}`, post("/api/show", `{"model":"qwen2.5:14b"}`))
+
+	require.Equal(t, `{"status":"success"}`, post("/api/pull", `{"model":"qwen2.5:14b","stream":false}`))
+	resp, err := http.Get(s.URL + "/api/tags")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"models":[
+		{"name":"mxbai-embed-large:latest","model":"mxbai-embed-large:latest"},
+		{"name":"qwen2.5:14b","model":"qwen2.5:14b"}
+	]}`, string(b))
+
+	// Describing models isn't recorded, as they aren't chats or embeddings.
+	require.Empty(t, s.Requests())
+}
+
+func TestError(t *testing.T) {
+	s := NewServer(t, Error(http.StatusServiceUnavailable), Text("recovered"))
+
+	_, err := completion.Chat(s.URL, llm.Query{Model: "test-model"})
+	require.EqualError(t, err, "status code: 503")
+
+	answer, err := completion.Chat(s.URL, llm.Query{Model: "test-model"})
+	require.NoError(t, err)
+	require.Equal(t, "recovered", answer.Message.Content)
+}
+
+// errorRecorder records errors instead of failing the test.
+type errorRecorder struct {
+	testing.TB
+	mu     sync.Mutex
+	errors []string
+}
+
+func (r *errorRecorder) Errorf(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestNoReplyScripted(t *testing.T) {
+	recorder := &errorRecorder{TB: t}
+	s := NewServer(recorder)
+
+	_, err := completion.Chat(s.URL, llm.Query{Model: "test-model"})
+	require.EqualError(t, err, "status code: 500")
+	require.Equal(t, []string{"llmtest: no reply scripted for chat request 1"}, recorder.errors)
+}
+
+func TestEmbedding(t *testing.T) {
+	similarity := func(a, b string) float64 {
+		var dot float64
+		for i, x := range Embedding(a) {
+			dot += x * Embedding(b)[i]
+		}
+		return dot
+	}
+
+	require.Len(t, Embedding("anything"), Dimensions)
+	require.InDelta(t, 1.0, similarity("Go benchmarks", "go BENCHMARKS!"), 1e-9)
+	require.Greater(t, similarity("new benchmark loops in Go", "What's new with benchmarks in Go?"),
+		similarity("new benchmark loops in Go", "Swiss tables for maps"))
+	require.Equal(t, make([]float64, Dimensions), Embedding(""))
+}
+
+func TestVectorStore(t *testing.T) {
+	var store VectorStore
+	for id, text := range map[string]string{
+		"loops":  "Benchmarks can use the new testing.B.Loop method.",
+		"maps":   "Maps are now implemented with Swiss tables.",
+		"crypto": "New crypto packages are available.",
+	} {
+		_, err := store.Save(llm.VectorRecord{Id: id, Prompt: text, Embedding: Embedding(text)})
+		require.NoError(t, err)
+	}
+	_, err := store.Save(llm.VectorRecord{Id: "maps", Prompt: "replaced", Embedding: Embedding("maps")})
+	require.NoError(t, err)
+	require.Len(t, store.Records(), 3)
+
+	similarities, err := store.SearchTopNSimilarities(llm.VectorRecord{Embedding: Embedding("How do benchmarks use the Loop method?")}, 2)
+	require.NoError(t, err)
+	require.Len(t, similarities, 2)
+	require.Equal(t, "loops", similarities[0].Id)
+	require.Greater(t, similarities[0].Score, similarities[1].Score)
+
+	similarities, err = store.SearchTopNSimilarities(llm.VectorRecord{}, 5)
+	require.NoError(t, err)
+	require.Len(t, similarities, 3)
+	require.Zero(t, similarities[0].Score)
+}
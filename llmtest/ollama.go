@@ -0,0 +1,157 @@
+package llmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+type ollamaChatRequest struct {
+	Model    string        `json:"model"`
+	Messages []llm.Message `json:"messages"`
+	Tools    []llm.Tool    `json:"tools"`
+	// Stream defaults to true in Ollama.
+	Stream *bool `json:"stream"`
+}
+
+// ollamaChat serves /api/chat, streaming newline-delimited JSON unless the
+// request sets "stream" to false.
+func (s *Server) ollamaChat(w http.ResponseWriter, r *http.Request) {
+	var req ollamaChatRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	stream := req.Stream == nil || *req.Stream
+	reply, _, ok := s.record(w, Request{
+		Path:     r.URL.Path,
+		Model:    req.Model,
+		Messages: req.Messages,
+		Tools:    toolNames(req.Tools),
+		Stream:   stream,
+	})
+	if !ok {
+		return
+	}
+
+	done := llm.Answer{
+		Model:           req.Model,
+		Message:         llm.Message{Role: "assistant", Content: reply.Content, ToolCalls: reply.ToolCalls},
+		Done:            true,
+		PromptEvalCount: reply.PromptTokens,
+		EvalCount:       reply.CompletionTokens,
+	}
+	if !stream {
+		writeJSON(w, http.StatusOK, done)
+		return
+	}
+
+	// Stream a word at a time, then a last chunk with any tool calls.
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	for _, word := range words(reply.Content) {
+		enc.Encode(llm.Answer{Model: req.Model, Message: llm.Message{Role: "assistant", Content: word}})
+		flush(w)
+	}
+	done.Message.Content = ""
+	enc.Encode(done)
+}
+
+type ollamaEmbeddingsRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+// ollamaEmbeddings serves /api/embeddings.
+func (s *Server) ollamaEmbeddings(w http.ResponseWriter, r *http.Request) {
+	var req ollamaEmbeddingsRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	s.record(w, Request{Path: r.URL.Path, Model: req.Model, Input: []string{req.Prompt}})
+	writeJSON(w, http.StatusOK, map[string][]float64{"embedding": s.Embed(req.Prompt)})
+}
+
+// ollamaTags serves /api/tags, listing Models.
+func (s *Server) ollamaTags(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	models := []map[string]string{}
+	for _, m := range s.Models {
+		models = append(models, map[string]string{"name": m.Name, "model": m.Name})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"models": models})
+}
+
+// ollamaShow serves /api/show, with only the capabilities of the model and
+// its lengths. It isn't recorded, as it describes the model rather than
+// using it.
+func (s *Server) ollamaShow(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model string `json:"model"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := Model{Name: req.Model, Capabilities: s.Capabilities}
+	if len(s.Models) > 0 {
+		i := slices.IndexFunc(s.Models, func(m Model) bool { return m.Name == withTag(req.Model) })
+		if i < 0 {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("model '%s' not found", req.Model))
+			return
+		}
+		m = s.Models[i]
+	}
+
+	// Ollama prefixes these with the model's architecture.
+	info := map[string]any{"general.architecture": "llmtest"}
+	if m.ContextLength > 0 {
+		info["llmtest.context_length"] = m.ContextLength
+	}
+	if m.EmbeddingLength > 0 {
+		info["llmtest.embedding_length"] = m.EmbeddingLength
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"capabilities": m.Capabilities, "model_info": info})
+}
+
+// ollamaPull serves /api/pull, adding the model to Models with
+// Capabilities. Only "stream": false is supported.
+func (s *Server) ollamaPull(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model string `json:"model"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Models = append(s.Models, Model{Name: withTag(req.Model), Capabilities: s.Capabilities})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// withTag adds the default tag, as Ollama does.
+func withTag(name string) string {
+	if !strings.Contains(name, ":") {
+		return name + ":latest"
+	}
+	return name
+}
+
+// words splits content into streaming chunks, keeping the spaces.
+func words(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.SplitAfter(content, " ")
+}
+
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,207 @@
+package llmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+type openAIChatRequest struct {
+	Model         string          `json:"model"`
+	Messages      []openAIMessage `json:"messages"`
+	Tools         []llm.Tool      `json:"tools"`
+	Stream        bool            `json:"stream"`
+	StreamOptions struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+}
+
+// openAIMessage is a message in a request or response. Unlike Ollama, tool
+// call arguments are a JSON string.
+type openAIMessage struct {
+	Role string `json:"role,omitempty"`
+	// Content is a string or an array of parts in requests.
+	Content   json.RawMessage  `json:"content,omitempty"`
+	ToolCalls []openAIToolCall `json:"tool_calls,omitempty"`
+}
+
+type openAIToolCall struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAIChoice struct {
+	Index        int            `json:"index"`
+	Message      *openAIMessage `json:"message,omitempty"`
+	Delta        *openAIMessage `json:"delta,omitempty"`
+	FinishReason *string        `json:"finish_reason"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type openAICompletion struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+	Usage   *openAIUsage   `json:"usage,omitempty"`
+}
+
+// openAIChat serves /v1/chat/completions, streaming server-sent events when
+// the request sets "stream".
+func (s *Server) openAIChat(w http.ResponseWriter, r *http.Request) {
+	var req openAIChatRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	messages := make([]llm.Message, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		messages = append(messages, m.toLLM())
+	}
+	reply, id, ok := s.record(w, Request{
+		Path:     r.URL.Path,
+		Model:    req.Model,
+		Messages: messages,
+		Tools:    toolNames(req.Tools),
+		Stream:   req.Stream,
+	})
+	if !ok {
+		return
+	}
+
+	finishReason := reply.finishReason()
+	usage := &openAIUsage{
+		PromptTokens:     reply.PromptTokens,
+		CompletionTokens: reply.CompletionTokens,
+		TotalTokens:      reply.PromptTokens + reply.CompletionTokens,
+	}
+	completion := openAICompletion{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+	}
+	if !req.Stream {
+		completion.Choices = []openAIChoice{{
+			Message:      newOpenAIMessage("assistant", reply.Content, reply.ToolCalls),
+			FinishReason: &finishReason,
+		}}
+		completion.Usage = usage
+		writeJSON(w, http.StatusOK, completion)
+		return
+	}
+
+	// Stream the role, then a word at a time, then any tool calls with the
+	// finish reason, like OpenAI.
+	w.Header().Set("Content-Type", "text/event-stream")
+	completion.Object = "chat.completion.chunk"
+	send := func(choices []openAIChoice, usage *openAIUsage) {
+		completion.Choices, completion.Usage = choices, usage
+		b, _ := json.Marshal(completion)
+		fmt.Fprintf(w, "data: %s\n\n", b)
+		flush(w)
+	}
+	send([]openAIChoice{{Delta: newOpenAIMessage("assistant", "", nil)}}, nil)
+	for _, word := range words(reply.Content) {
+		send([]openAIChoice{{Delta: newOpenAIMessage("", word, nil)}}, nil)
+	}
+	send([]openAIChoice{{Delta: newOpenAIMessage("", "", reply.ToolCalls), FinishReason: &finishReason}}, nil)
+	if req.StreamOptions.IncludeUsage {
+		send([]openAIChoice{}, usage)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func newOpenAIMessage(role, content string, toolCalls []llm.ToolCall) *openAIMessage {
+	m := &openAIMessage{Role: role}
+	if content != "" {
+		m.Content, _ = json.Marshal(content)
+	}
+	for i, call := range toolCalls {
+		tc := openAIToolCall{Index: i, ID: fmt.Sprintf("call_%d", i), Type: "function"}
+		tc.Function.Name = call.Function.Name
+		arguments, _ := json.Marshal(call.Function.Arguments)
+		tc.Function.Arguments = string(arguments)
+		m.ToolCalls = append(m.ToolCalls, tc)
+	}
+	return m
+}
+
+// toLLM converts the message, joining the text of any content parts.
+func (m openAIMessage) toLLM() llm.Message {
+	message := llm.Message{Role: m.Role}
+	if err := json.Unmarshal(m.Content, &message.Content); err != nil {
+		var parts []struct {
+			Text string `json:"text"`
+		}
+		json.Unmarshal(m.Content, &parts)
+		var text []string
+		for _, part := range parts {
+			text = append(text, part.Text)
+		}
+		message.Content = strings.Join(text, "\n")
+	}
+	for _, tc := range m.ToolCalls {
+		call := llm.ToolCall{Function: llm.FunctionTool{Name: tc.Function.Name}}
+		json.Unmarshal([]byte(tc.Function.Arguments), &call.Function.Arguments)
+		message.ToolCalls = append(message.ToolCalls, call)
+	}
+	return message
+}
+
+type openAIEmbeddingsRequest struct {
+	Model string `json:"model"`
+	// Input is a string or an array of strings.
+	Input json.RawMessage `json:"input"`
+}
+
+type openAIEmbedding struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"`
+	Embedding []float64 `json:"embedding"`
+}
+
+// openAIEmbeddings serves /v1/embeddings.
+func (s *Server) openAIEmbeddings(w http.ResponseWriter, r *http.Request) {
+	var req openAIEmbeddingsRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	var input []string
+	if err := json.Unmarshal(req.Input, &input); err != nil {
+		var one string
+		if err := json.Unmarshal(req.Input, &one); err != nil {
+			writeError(w, http.StatusBadRequest, "input must be a string or an array of strings")
+			return
+		}
+		input = []string{one}
+	}
+	s.record(w, Request{Path: r.URL.Path, Model: req.Model, Input: input})
+
+	data := make([]openAIEmbedding, len(input))
+	tokens := 0
+	for i, text := range input {
+		data[i] = openAIEmbedding{Object: "embedding", Index: i, Embedding: s.Embed(text)}
+		tokens += len(strings.Fields(text))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"object": "list",
+		"data":   data,
+		"model":  req.Model,
+		"usage":  map[string]int{"prompt_tokens": tokens, "total_tokens": tokens},
+	})
+}
@@ -0,0 +1,68 @@
+package llmtest
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// VectorStore is an in-memory vector store, with the methods of
+// embeddings.ElasticsearchStore used to save and search embeddings. The zero
+// value is ready to use.
+type VectorStore struct {
+	mu      sync.Mutex
+	records []llm.VectorRecord
+}
+
+// Save adds the record, replacing any with the same ID.
+func (s *VectorStore) Save(record llm.VectorRecord) (llm.VectorRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, r := range s.records {
+		if r.Id == record.Id {
+			s.records[i] = record
+			return record, nil
+		}
+	}
+	s.records = append(s.records, record)
+	return record, nil
+}
+
+// Records returns the records saved, in order.
+func (s *VectorStore) Records() []llm.VectorRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]llm.VectorRecord(nil), s.records...)
+}
+
+// SearchTopNSimilarities returns up to max records, most similar first. Score
+// and CosineDistance are the cosine similarity to embedding.
+func (s *VectorStore) SearchTopNSimilarities(embedding llm.VectorRecord, max int) ([]llm.VectorRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	similarities := make([]llm.VectorRecord, len(s.records))
+	for i, r := range s.records {
+		r.CosineDistance = cosineSimilarity(embedding.Embedding, r.Embedding)
+		r.Score = r.CosineDistance
+		similarities[i] = r
+	}
+	sort.SliceStable(similarities, func(i, j int) bool {
+		return similarities[i].Score > similarities[j].Score
+	})
+	return similarities[:min(max, len(similarities))], nil
+}
+
+func cosineSimilarity(a, b []float64) float64 {
+	var dot, normA, normB float64
+	for i := range min(len(a), len(b)) {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -1,65 +1,19 @@
 package main
 
 import (
-	_ "embed"
-	"fmt"
-	"log"
+	"context"
 	"os"
-	"strconv"
+	"os/signal"
 
-	"github.com/joho/godotenv"
-	"github.com/parakeet-nest/parakeet/content"
-	"github.com/parakeet-nest/parakeet/embeddings"
-	"github.com/parakeet-nest/parakeet/llm"
+	"github.com/codefromthecrypt/practical-genai-go/cli"
 )
 
-//go:embed go1.24.md
-var goReleaseNotes string
-
+// main stores embeddings of markdown sections in Elasticsearch. It is the
+// same as `genai rag index`, so it takes the same flags.
 func main() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatalln("😡:", err)
-	}
-
-	url := "http://localhost:11434/v1"
-	embeddingsModel := "mxbai-embed-large"
-
-	elasticStore := embeddings.ElasticsearchStore{}
-	err = elasticStore.Initialize(
-		[]string{
-			os.Getenv("ELASTICSEARCH_URL"),
-		},
-		os.Getenv("ELASTICSEARCH_USER"),
-		os.Getenv("ELASTICSEARCH_PASSWORD"),
-		nil,
-		"mxbai-golang-index",
-	)
-	if err != nil {
-		log.Fatalln("😡:", err)
-	}
-
-	chunks := content.ParseMarkdown(goReleaseNotes)
-
-	// Create embeddings from documents and save them in the store
-	for idx, doc := range chunks {
-		fmt.Println("📝 Creating embedding from document ", idx)
-		embedding, err := embeddings.CreateEmbeddingWithOpenAI(
-			url,
-			llm.OpenAIQuery4Embedding{
-				Model: embeddingsModel,
-				Input: fmt.Sprintf("## %s\n\n%s\n\n", doc.Header, doc.Content),
-			},
-			strconv.Itoa(idx),
-		)
-		if err != nil {
-			log.Fatalln("😡:", err)
-		}
-
-		_, err = elasticStore.Save(embedding)
-		if _, err = elasticStore.Save(embedding); err != nil {
-			log.Fatalln("😡:", err)
-		}
-		fmt.Println("Document", embedding.Id, "indexed successfully")
-	}
+	// Interrupting stops the command, so that it can clean up.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := cli.Run(ctx, append([]string{"rag", "index"}, os.Args[1:]...), os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
 }
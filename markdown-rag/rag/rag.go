@@ -0,0 +1,153 @@
+// Package rag holds the steps of the markdown RAG demo: storing embeddings of
+// markdown sections, and answering a question with those most similar to it.
+// Both programs under markdown-rag use it, as does "genai rag".
+package rag
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codefromthecrypt/practical-genai-go/guard"
+	"github.com/codefromthecrypt/practical-genai-go/telemetry"
+	"github.com/codefromthecrypt/practical-genai-go/usage"
+	"github.com/parakeet-nest/parakeet/content"
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// GoReleaseNotes are the Go 1.24 release notes, the markdown indexed by
+// default.
+//
+//go:embed go1.24.md
+var GoReleaseNotes string
+
+// VectorStore is the part of embeddings.ElasticsearchStore used by
+// CreateEmbeddings, so tests can use another store.
+type VectorStore interface {
+	Save(llm.VectorRecord) (llm.VectorRecord, error)
+}
+
+// CreateEmbeddings creates an embedding from each chunk, and saves it in the
+// store, writing progress to out.
+func CreateEmbeddings(ctx context.Context, url, model string, chunks []content.Chunk, store VectorStore, out io.Writer) error {
+	for idx, doc := range chunks {
+		fmt.Fprintln(out, "📝 Creating embedding from document ", idx)
+		embedding, err := telemetry.CreateEmbeddingWithOpenAI(
+			ctx,
+			url,
+			llm.OpenAIQuery4Embedding{
+				Model: model,
+				Input: fmt.Sprintf("## %s\n\n%s\n\n", doc.Header, doc.Content),
+			},
+			strconv.Itoa(idx),
+		)
+		if err != nil {
+			return err
+		}
+
+		if _, err = store.Save(embedding); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "Document", embedding.Id, "indexed successfully")
+	}
+	return nil
+}
+
+// RAG answers questions using documents similar to them in the store.
+type RAG struct {
+	// URL is the OpenAI API of the LLM, such as http://localhost:11434/v1.
+	URL                           string
+	EmbeddingsModel, Model, Index string
+	Store                         telemetry.VectorStore
+}
+
+// Answer writes the answer to userContent to out, with progress, returning
+// what it used.
+func (r RAG) Answer(ctx context.Context, userContent string, out io.Writer) (usage.Usage, error) {
+	var u usage.Usage
+	requestStart := time.Now()
+
+	// Create an embedding from the question
+	start := time.Now()
+	embeddingFromQuestion, err := telemetry.CreateEmbeddingWithOpenAI(
+		ctx,
+		r.URL,
+		llm.OpenAIQuery4Embedding{
+			Model: r.EmbeddingsModel,
+			Input: userContent,
+		},
+		"question",
+	)
+	if err != nil {
+		return u, err
+	}
+	u.AddEmbedding(time.Since(start))
+	fmt.Fprintln(out, "🔎 searching for similarity...")
+
+	similarities, err := telemetry.SearchTopNSimilarities(ctx, "elasticsearch", r.Index, r.Store, embeddingFromQuestion, 5)
+
+	for _, similarity := range similarities {
+		fmt.Fprintln(out, "📝 doc:", similarity.Id, "score:", similarity.Score)
+	}
+
+	if err != nil {
+		return u, err
+	}
+
+	// Retrieved documents are untrusted: one could contain instructions to
+	// change the answer. Withhold any that look like a prompt injection.
+	docGuard := guard.New(guard.Policy{Action: guard.Quarantine})
+	var documentsContent strings.Builder
+	for _, similarity := range similarities {
+		doc, verdict, err := docGuard.Apply(ctx, "doc "+similarity.Id, similarity.Prompt)
+		if err != nil {
+			return u, err
+		}
+		if verdict.Suspicious {
+			fmt.Fprintln(out, "🚨 quarantined doc:", similarity.Id, "score:", verdict.Score)
+		}
+		documentsContent.WriteString(doc + "\n")
+	}
+	fmt.Fprintln(out, "Context is now: ", documentsContent.String())
+
+	systemContent := `You are a Golang expert.
+	Using only the below provided context, answer the user's question
+	to the best of your ability using only the resources provided.
+	` + guard.SystemPrompt
+
+	queryChat := llm.OpenAIQuery{
+		Model: r.Model,
+		Messages: []llm.Message{
+			{Role: "system", Content: systemContent},
+			{Role: "system", Content: documentsContent.String()},
+			{Role: "user", Content: userContent},
+		},
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "🤖 answer:")
+
+	// Answer the question
+	start = time.Now()
+	answer, err := telemetry.ChatWithOpenAIStream(ctx, r.URL, queryChat,
+		func(answer llm.OpenAIAnswer) error {
+			// A final chunk can have only usage, and no choices.
+			if len(answer.Choices) == 0 {
+				return nil
+			}
+			fmt.Fprint(out, answer.Choices[0].Delta.Content)
+			return nil
+		})
+	if err != nil {
+		return u, err
+	}
+	u.AddOpenAIAnswer(answer, time.Since(start))
+	u.Duration = time.Since(requestStart)
+
+	fmt.Fprintln(out)
+	return u, nil
+}
@@ -0,0 +1,161 @@
+// Package metrics records LLM, tool, embedding and vector search calls as
+// Prometheus metrics, served in the text format on /metrics. Unlike traces,
+// nothing is sent anywhere: Prometheus, or curl, scrapes the process.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// buckets are latency buckets in seconds. LLM calls take from milliseconds
+// for a cached prompt to minutes for a large one on a laptop.
+var buckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+var (
+	// Registry holds the metrics below, and Go runtime and process metrics.
+	Registry = prometheus.NewRegistry()
+
+	llmRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "genai_llm_requests_total",
+		Help: "LLM chat requests, by model, endpoint and status (ok or error).",
+	}, []string{"model", "endpoint", "status"})
+	llmDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "genai_llm_request_duration_seconds",
+		Help:    "Latency of LLM chat requests, by model and endpoint.",
+		Buckets: buckets,
+	}, []string{"model", "endpoint"})
+	llmTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "genai_llm_tokens_total",
+		Help: "Tokens used by LLM chat requests, by model and type (prompt or completion).",
+	}, []string{"model", "type"})
+
+	toolCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "genai_tool_calls_total",
+		Help: "Tool calls, by tool name.",
+	}, []string{"tool"})
+	toolErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "genai_tool_errors_total",
+		Help: "Tool calls that failed, by tool name.",
+	}, []string{"tool"})
+	toolDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "genai_tool_duration_seconds",
+		Help:    "Latency of tool calls, by tool name.",
+		Buckets: buckets,
+	}, []string{"tool"})
+
+	embeddings = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "genai_embeddings_total",
+		Help: "Embeddings created, by model and status (ok or error).",
+	}, []string{"model", "status"})
+	embeddingDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "genai_embedding_duration_seconds",
+		Help:    "Latency of creating an embedding, by model.",
+		Buckets: buckets,
+	}, []string{"model"})
+
+	searchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "genai_vector_search_duration_seconds",
+		Help:    "Latency of vector similarity searches, by store and collection.",
+		Buckets: buckets,
+	}, []string{"db_system", "collection"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		llmRequests, llmDuration, llmTokens,
+		toolCalls, toolErrors, toolDuration,
+		embeddings, embeddingDuration,
+		searchDuration,
+	)
+}
+
+// ObserveChat records an LLM chat request to baseURL, which took d. Tokens
+// are zero when the API didn't report them.
+func ObserveChat(baseURL, model string, d time.Duration, promptTokens, completionTokens int, err error) {
+	endpoint := endpoint(baseURL)
+	llmRequests.WithLabelValues(model, endpoint, status(err)).Inc()
+	llmDuration.WithLabelValues(model, endpoint).Observe(d.Seconds())
+	llmTokens.WithLabelValues(model, "prompt").Add(float64(promptTokens))
+	llmTokens.WithLabelValues(model, "completion").Add(float64(completionTokens))
+}
+
+// ObserveTool records a tool call, which took d and failed if err is not nil.
+// The error rate is genai_tool_errors_total over genai_tool_calls_total.
+func ObserveTool(name string, d time.Duration, err error) {
+	toolCalls.WithLabelValues(name).Inc()
+	if err != nil {
+		toolErrors.WithLabelValues(name).Inc()
+	} else {
+		// Initialize the series, so rates are zero instead of missing.
+		toolErrors.WithLabelValues(name).Add(0)
+	}
+	toolDuration.WithLabelValues(name).Observe(d.Seconds())
+}
+
+// ObserveEmbedding records creating an embedding, which took d. Throughput is
+// the rate of genai_embeddings_total.
+func ObserveEmbedding(model string, d time.Duration, err error) {
+	embeddings.WithLabelValues(model, status(err)).Inc()
+	embeddingDuration.WithLabelValues(model).Observe(d.Seconds())
+}
+
+// ObserveSearch records a vector similarity search, which took d. dbSystem is
+// the kind of store, such as "elasticsearch", and collection is the index.
+func ObserveSearch(dbSystem, collection string, d time.Duration) {
+	searchDuration.WithLabelValues(dbSystem, collection).Observe(d.Seconds())
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Serve serves Handler on addr's /metrics until shutdown. If addr is empty,
+// it does nothing, so programs can make metrics optional.
+func Serve(addr string) (shutdown func(context.Context) error, err error) {
+	if addr == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	s := &http.Server{Handler: mux}
+	go func() {
+		if err := s.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			log.Println("😡:", err)
+		}
+	}()
+	log.Printf("Serving metrics on http://%s/metrics", ln.Addr())
+	return s.Shutdown, nil
+}
+
+// endpoint is the host and port of baseURL, as paths like /v1 don't identify
+// the server.
+func endpoint(baseURL string) string {
+	if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return baseURL
+}
+
+func status(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserveChat(t *testing.T) {
+	ObserveChat("http://localhost:11434/v1", "chat-model", 2*time.Second, 100, 20, nil)
+	ObserveChat("http://localhost:11434/v1", "chat-model", time.Second, 0, 0, errors.New("status code: 503"))
+
+	require.Equal(t, 1.0, testutil.ToFloat64(llmRequests.WithLabelValues("chat-model", "localhost:11434", "ok")))
+	require.Equal(t, 1.0, testutil.ToFloat64(llmRequests.WithLabelValues("chat-model", "localhost:11434", "error")))
+	require.Equal(t, 100.0, testutil.ToFloat64(llmTokens.WithLabelValues("chat-model", "prompt")))
+	require.Equal(t, 20.0, testutil.ToFloat64(llmTokens.WithLabelValues("chat-model", "completion")))
+	require.Equal(t, 1, testutil.CollectAndCount(llmDuration.MustCurryWith(map[string]string{"model": "chat-model"})))
+}
+
+func TestObserveTool(t *testing.T) {
+	ObserveTool("test-tool", time.Millisecond, nil)
+	ObserveTool("test-tool", time.Millisecond, errors.New("exit status 1"))
+	ObserveTool("other-tool", time.Millisecond, nil)
+
+	require.Equal(t, 2.0, testutil.ToFloat64(toolCalls.WithLabelValues("test-tool")))
+	require.Equal(t, 1.0, testutil.ToFloat64(toolErrors.WithLabelValues("test-tool")))
+	// Tools that never failed have a zero error count, not a missing one.
+	require.Equal(t, 0.0, testutil.ToFloat64(toolErrors.WithLabelValues("other-tool")))
+}
+
+func TestHandler(t *testing.T) {
+	ObserveEmbedding("embed-model", 30*time.Millisecond, nil)
+	ObserveSearch("elasticsearch", "test-index", 5*time.Millisecond)
+
+	s := httptest.NewServer(Handler())
+	defer s.Close()
+
+	resp, err := http.Get(s.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Contains(t, resp.Header.Get("Content-Type"), "text/plain")
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `genai_embeddings_total{model="embed-model",status="ok"} 1`)
+	require.Contains(t, string(body), `genai_vector_search_duration_seconds_bucket{collection="test-index",db_system="elasticsearch",le="0.01"} 1`)
+	require.Contains(t, string(body), "go_goroutines")
+}
+
+func TestServe(t *testing.T) {
+	shutdown, err := Serve("")
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+
+	shutdown, err = Serve("127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+
+	_, err = Serve("not an address")
+	require.Error(t, err)
+}
+
+func TestEndpoint(t *testing.T) {
+	require.Equal(t, "localhost:11434", endpoint("http://localhost:11434"))
+	require.Equal(t, "api.openai.com", endpoint("https://api.openai.com/v1"))
+	require.Equal(t, "not a url", endpoint("not a url"))
+}
@@ -0,0 +1,232 @@
+// Package preflight checks Ollama has the models a program needs before it
+// starts work. Otherwise, a missing model or one without tool support fails
+// deep inside a request, often after other work was done.
+package preflight
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Model is a model a program needs, and what it needs it to do.
+type Model struct {
+	// Name is the model, such as "qwen2.5:14b". Without a tag, ":latest" is
+	// assumed, as in Ollama.
+	Name string
+	// Tools is true when the model must support tool calling.
+	Tools bool
+	// Embedding is true when the model must create embeddings.
+	Embedding bool
+	// ContextLength is the context length the program uses, such as
+	// llm.Options.NumCtx, which the model must support. Zero isn't checked.
+	ContextLength int
+	// EmbeddingLength is the dimension of embeddings the program expects,
+	// such as the dimension of a vector index. Zero isn't checked.
+	EmbeddingLength int
+}
+
+// ModelInfo describes a model, from Ollama's /api/show.
+type ModelInfo struct {
+	Name string
+	// Capabilities are what the model supports, such as "completion",
+	// "tools" or "embedding". Nil when Ollama doesn't report them, which is
+	// the case before version 0.6.4.
+	Capabilities []string
+	// ContextLength is the longest context the model supports, or zero if
+	// unknown.
+	ContextLength int
+	// EmbeddingLength is the dimension of the model's embeddings, or zero if
+	// unknown.
+	EmbeddingLength int
+}
+
+// Supports returns true if the model has the capability, or capabilities are
+// unknown.
+func (m *ModelInfo) Supports(capability string) bool {
+	return m.Capabilities == nil || slices.Contains(m.Capabilities, capability)
+}
+
+// Error lists the problems found, so they can all be fixed at once.
+type Error struct {
+	URL      string
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("preflight failed for %s:\n  - %s", e.URL, strings.Join(e.Problems, "\n  - "))
+}
+
+// Check returns an *Error listing any model that isn't pulled into the
+// Ollama at url, or can't do what the program needs. An OpenAI-compatible URL
+// is fine, as a trailing "/v1" is removed.
+func Check(ctx context.Context, url string, models ...Model) error {
+	url = baseURL(url)
+	pulled, err := List(ctx, url)
+	if err != nil {
+		return &Error{URL: url, Problems: []string{fmt.Sprintf("Ollama isn't available, start it with `ollama serve`: %v", err)}}
+	}
+
+	var problems []string
+	for _, m := range models {
+		name := normalize(m.Name)
+		if !slices.Contains(pulled, name) {
+			problems = append(problems, fmt.Sprintf("%s isn't pulled, run `ollama pull %s`", m.Name, m.Name))
+			continue
+		}
+		info, err := Show(ctx, url, name)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s couldn't be described: %v", m.Name, err))
+			continue
+		}
+		problems = append(problems, m.check(info)...)
+	}
+	if len(problems) > 0 {
+		return &Error{URL: url, Problems: problems}
+	}
+	return nil
+}
+
+// check returns any way the model doesn't meet the requirement.
+func (m *Model) check(info *ModelInfo) []string {
+	var problems []string
+	if m.Tools && !info.Supports("tools") {
+		problems = append(problems, fmt.Sprintf("%s doesn't support tools", m.Name))
+	}
+	if m.Embedding && !info.Supports("embedding") {
+		problems = append(problems, fmt.Sprintf("%s doesn't create embeddings", m.Name))
+	}
+	if m.ContextLength > 0 && info.ContextLength > 0 && info.ContextLength < m.ContextLength {
+		problems = append(problems, fmt.Sprintf("%s has a context length of %d, less than %d",
+			m.Name, info.ContextLength, m.ContextLength))
+	}
+	if m.EmbeddingLength > 0 && info.EmbeddingLength > 0 && info.EmbeddingLength != m.EmbeddingLength {
+		problems = append(problems, fmt.Sprintf("%s has an embedding length of %d, expected %d",
+			m.Name, info.EmbeddingLength, m.EmbeddingLength))
+	}
+	return problems
+}
+
+// List returns the names of the models pulled into the Ollama at url, such as
+// "qwen2.5:14b".
+func List(ctx context.Context, url string) ([]string, error) {
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := call(ctx, http.MethodGet, baseURL(url)+"/api/tags", nil, &tags); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		names = append(names, m.Name)
+	}
+	return names, nil
+}
+
+// Show describes the model in the Ollama at url.
+func Show(ctx context.Context, url, model string) (*ModelInfo, error) {
+	var show struct {
+		Capabilities []string       `json:"capabilities"`
+		ModelInfo    map[string]any `json:"model_info"`
+	}
+	if err := call(ctx, http.MethodPost, baseURL(url)+"/api/show", map[string]string{"model": model}, &show); err != nil {
+		return nil, err
+	}
+	info := &ModelInfo{Name: model, Capabilities: show.Capabilities}
+	// Keys are prefixed with the architecture, such as "qwen2.context_length".
+	if arch, ok := show.ModelInfo["general.architecture"].(string); ok {
+		info.ContextLength = intValue(show.ModelInfo[arch+".context_length"])
+		info.EmbeddingLength = intValue(show.ModelInfo[arch+".embedding_length"])
+	}
+	return info, nil
+}
+
+// PullMissing pulls any of the models that aren't in the Ollama at url yet.
+// This can take minutes for large models.
+func PullMissing(ctx context.Context, url string, models ...Model) error {
+	pulled, err := List(ctx, url)
+	if err != nil {
+		return err
+	}
+	for _, m := range models {
+		if slices.Contains(pulled, normalize(m.Name)) {
+			continue
+		}
+		log.Printf("Pulling %s", m.Name)
+		var status struct {
+			Status string `json:"status"`
+		}
+		err := call(ctx, http.MethodPost, baseURL(url)+"/api/pull", map[string]any{"model": m.Name, "stream": false}, &status)
+		if err != nil {
+			return fmt.Errorf("failed to pull %s: %w", m.Name, err)
+		}
+		pulled = append(pulled, normalize(m.Name))
+	}
+	return nil
+}
+
+// call sends the request body, if any, as JSON, decoding the response into
+// v.
+func call(ctx context.Context, method, url string, body, v any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// Ollama returns errors as {"error": "..."}.
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&e) == nil && e.Error != "" {
+			return fmt.Errorf("status code: %d: %s", resp.StatusCode, e.Error)
+		}
+		return fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// baseURL removes the path of the OpenAI-compatible API, if present.
+func baseURL(url string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(url, "/"), "/v1")
+}
+
+// normalize adds the default tag, so names match those listed by Ollama. Only
+// the part after any registry or namespace can have a tag, as a registry can
+// have a port, such as localhost:5000/model.
+func normalize(name string) string {
+	if !strings.Contains(name[strings.LastIndex(name, "/")+1:], ":") {
+		return name + ":latest"
+	}
+	return name
+}
+
+func intValue(v any) int {
+	if f, ok := v.(float64); ok {
+		return int(f)
+	}
+	return 0
+}
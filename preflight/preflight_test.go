@@ -0,0 +1,130 @@
+package preflight
+
+import (
+	"context"
+	"testing"
+
+	"github.com/codefromthecrypt/practical-genai-go/llmtest"
+	"github.com/stretchr/testify/require"
+)
+
+func newOllama(t *testing.T) *llmtest.Server {
+	ollama := llmtest.NewServer(t)
+	ollama.Models = []llmtest.Model{
+		{Name: "qwen2.5:14b", Capabilities: []string{"completion", "tools"}, ContextLength: 32768},
+		{Name: "gemma2:2b", Capabilities: []string{"completion"}, ContextLength: 8192},
+		{Name: "mxbai-embed-large:latest", Capabilities: []string{"embedding"}, ContextLength: 512, EmbeddingLength: 1024},
+		{Name: "old:latest"}, // Ollama before capabilities were reported
+	}
+	return ollama
+}
+
+func TestCheck(t *testing.T) {
+	ollama := newOllama(t)
+
+	tests := []struct {
+		name        string
+		url         string
+		models      []Model
+		expectedErr string
+	}{
+		{
+			name: "ok",
+			url:  ollama.URL,
+			models: []Model{
+				{Name: "qwen2.5:14b", Tools: true, ContextLength: 8192},
+				{Name: "mxbai-embed-large", Embedding: true, EmbeddingLength: 1024},
+			},
+		},
+		{
+			name:   "OpenAI URL",
+			url:    ollama.URL + "/v1",
+			models: []Model{{Name: "qwen2.5:14b"}},
+		},
+		{
+			name:   "capabilities unknown",
+			url:    ollama.URL,
+			models: []Model{{Name: "old", Tools: true, Embedding: true, ContextLength: 8192, EmbeddingLength: 1024}},
+		},
+		{
+			name: "problems",
+			url:  ollama.URL,
+			models: []Model{
+				{Name: "llama3.2:1b"},
+				{Name: "gemma2:2b", Tools: true, ContextLength: 16384},
+				{Name: "mxbai-embed-large", Embedding: true, EmbeddingLength: 768},
+				{Name: "qwen2.5:14b", Embedding: true},
+			},
+			expectedErr: "preflight failed for " + ollama.URL + `:
+  - llama3.2:1b isn't pulled, run ` + "`ollama pull llama3.2:1b`" + `
+  - gemma2:2b doesn't support tools
+  - gemma2:2b has a context length of 8192, less than 16384
+  - mxbai-embed-large has an embedding length of 1024, expected 768
+  - qwen2.5:14b doesn't create embeddings`,
+		},
+		{
+			name:        "Ollama down",
+			url:         "http://127.0.0.1:1/v1",
+			models:      []Model{{Name: "qwen2.5:14b"}},
+			expectedErr: "preflight failed for http://127.0.0.1:1:\n  - Ollama isn't available, start it with `ollama serve`: ",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Check(context.Background(), tc.url, tc.models...)
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestShow(t *testing.T) {
+	ollama := newOllama(t)
+
+	info, err := Show(context.Background(), ollama.URL, "mxbai-embed-large:latest")
+	require.NoError(t, err)
+	require.Equal(t, &ModelInfo{
+		Name:            "mxbai-embed-large:latest",
+		Capabilities:    []string{"embedding"},
+		ContextLength:   512,
+		EmbeddingLength: 1024,
+	}, info)
+	require.True(t, info.Supports("embedding"))
+	require.False(t, info.Supports("tools"))
+
+	_, err = Show(context.Background(), ollama.URL, "llama3.2:1b")
+	require.EqualError(t, err, "status code: 404: model 'llama3.2:1b' not found")
+}
+
+func TestPullMissing(t *testing.T) {
+	ollama := newOllama(t)
+	models := []Model{{Name: "qwen2.5:14b"}, {Name: "nomic-embed-text"}}
+	require.Error(t, Check(context.Background(), ollama.URL, models...))
+
+	require.NoError(t, PullMissing(context.Background(), ollama.URL, models...))
+
+	names, err := List(context.Background(), ollama.URL)
+	require.NoError(t, err)
+	require.Equal(t, []string{"qwen2.5:14b", "gemma2:2b", "mxbai-embed-large:latest", "old:latest", "nomic-embed-text:latest"}, names)
+	require.NoError(t, Check(context.Background(), ollama.URL, models...))
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct{ name, expected string }{
+		{name: "qwen2.5", expected: "qwen2.5:latest"},
+		{name: "qwen2.5:14b", expected: "qwen2.5:14b"},
+		{name: "library/qwen2.5", expected: "library/qwen2.5:latest"},
+		{name: "localhost:5000/model", expected: "localhost:5000/model:latest"},
+		{name: "localhost:5000/model:v1", expected: "localhost:5000/model:v1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, normalize(tc.name))
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package telemetry
+
+import (
+	"context"
+	"time"
+
+	"github.com/codefromthecrypt/practical-genai-go/metrics"
+	"github.com/parakeet-nest/parakeet/completion"
+	"github.com/parakeet-nest/parakeet/embeddings"
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// The functions below are the Parakeet functions of the same name, traced and
+// recorded as metrics. Parakeet doesn't accept a context, so ctx only parents
+// the span.
+
+// Chat is completion.Chat, for Ollama's API.
+func Chat(ctx context.Context, url string, query llm.Query) (llm.Answer, error) {
+	_, span := StartChat(ctx, "ollama", url, query.Model, query.Options)
+	start := time.Now()
+	answer, err := completion.Chat(url, query)
+	metrics.ObserveChat(url, query.Model, time.Since(start), answer.PromptEvalCount, answer.EvalCount, err)
+	EndChat(span, answer, err)
+	return answer, err
+}
+
+// ChatWithOpenAI is completion.ChatWithOpenAI, for OpenAI-compatible APIs.
+func ChatWithOpenAI(ctx context.Context, url string, query llm.OpenAIQuery) (llm.OpenAIAnswer, error) {
+	_, span := StartChat(ctx, "openai", url, query.Model, llm.Options{})
+	start := time.Now()
+	answer, err := completion.ChatWithOpenAI(url, query)
+	metrics.ObserveChat(url, query.Model, time.Since(start), answer.Usage.PromptTokens, answer.Usage.CompletionTokens, err)
+	EndOpenAIChat(span, answer, err)
+	return answer, err
+}
+
+// ChatWithOpenAIStream is completion.ChatWithOpenAIStream, for
+// OpenAI-compatible APIs. The span ends after the last chunk.
+func ChatWithOpenAIStream(ctx context.Context, url string, query llm.OpenAIQuery, onChunk func(llm.OpenAIAnswer) error) (llm.OpenAIAnswer, error) {
+	_, span := StartChat(ctx, "openai", url, query.Model, llm.Options{})
+	// Chunks have the response ID, finish reason and usage, but the answer
+	// returned may not, so collect them as they arrive.
+	var last llm.OpenAIAnswer
+	start := time.Now()
+	answer, err := completion.ChatWithOpenAIStream(url, query, func(chunk llm.OpenAIAnswer) error {
+		if chunk.ID != "" {
+			last.ID, last.Model = chunk.ID, chunk.Model
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].FinishReason != "" {
+			last.Choices = chunk.Choices
+		}
+		if chunk.Usage.TotalTokens > 0 {
+			last.Usage = chunk.Usage
+		}
+		return onChunk(chunk)
+	})
+	metrics.ObserveChat(url, query.Model, time.Since(start), last.Usage.PromptTokens, last.Usage.CompletionTokens, err)
+	EndOpenAIChat(span, last, err)
+	return answer, err
+}
+
+// CreateEmbeddingWithOpenAI is embeddings.CreateEmbeddingWithOpenAI.
+func CreateEmbeddingWithOpenAI(ctx context.Context, url string, query llm.OpenAIQuery4Embedding, id string) (llm.VectorRecord, error) {
+	_, span := StartEmbeddings(ctx, "openai", url, query.Model)
+	start := time.Now()
+	record, err := embeddings.CreateEmbeddingWithOpenAI(url, query, id)
+	metrics.ObserveEmbedding(query.Model, time.Since(start), err)
+	End(span, err)
+	return record, err
+}
+
+// VectorStore is a Parakeet vector store, such as
+// embeddings.ElasticsearchStore.
+type VectorStore interface {
+	SearchTopNSimilarities(embedding llm.VectorRecord, max int) ([]llm.VectorRecord, error)
+}
+
+// SearchTopNSimilarities is VectorStore.SearchTopNSimilarities, where dbSystem
+// is the kind of store, such as "elasticsearch", and collection is the index.
+func SearchTopNSimilarities(ctx context.Context, dbSystem, collection string, store VectorStore, embedding llm.VectorRecord, max int) ([]llm.VectorRecord, error) {
+	_, span := StartSearch(ctx, dbSystem, collection)
+	start := time.Now()
+	similarities, err := store.SearchTopNSimilarities(embedding, max)
+	metrics.ObserveSearch(dbSystem, collection, time.Since(start))
+	span.SetAttributes(DBResponseReturnedRows.Int(len(similarities)))
+	End(span, err)
+	return similarities, err
+}
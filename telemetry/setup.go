@@ -0,0 +1,80 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Setup makes the global TracerProvider export spans, returning a function
+// which exports any remaining spans and stops it. Call that before exiting.
+//
+// The exporter is chosen by the standard OTEL_TRACES_EXPORTER variable:
+//
+//   - "otlp": OTLP over HTTP, configured by the standard
+//     OTEL_EXPORTER_OTLP_* variables, such as OTEL_EXPORTER_OTLP_ENDPOINT.
+//   - "console": JSON to stderr, so it doesn't mix with the demo's output.
+//   - "none": nothing is exported.
+//
+// Unlike the standard, when OTEL_TRACES_EXPORTER is unset, the default is
+// "otlp" only if OTEL_EXPORTER_OTLP_ENDPOINT is set, and otherwise "none".
+// This keeps demos quiet when there's no collector.
+//
+// The service name is serviceName, unless OTEL_SERVICE_NAME is set.
+func Setup(ctx context.Context, serviceName string) (shutdown func(context.Context) error, err error) {
+	noop := func(context.Context) error { return nil }
+
+	var exporter sdktrace.SpanExporter
+	switch name := exporterName(); name {
+	case "none":
+		return noop, nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "console":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+	default:
+		return noop, fmt.Errorf("unsupported OTEL_TRACES_EXPORTER: %s", name)
+	}
+	if err != nil {
+		return noop, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	// Attributes in later options override earlier ones, so the environment
+	// overrides the service name.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", serviceName)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return noop, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	// Continue traces from callers, such as clients of the OpenAI server.
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return func(ctx context.Context) error {
+		return errors.Join(tp.ForceFlush(ctx), tp.Shutdown(ctx))
+	}, nil
+}
+
+// exporterName returns the exporter to use, according to the environment.
+func exporterName() string {
+	if name := os.Getenv("OTEL_TRACES_EXPORTER"); name != "" {
+		return name
+	}
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		return "otlp"
+	}
+	return "none"
+}
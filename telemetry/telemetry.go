@@ -0,0 +1,185 @@
+// Package telemetry traces LLM calls, embeddings, vector searches and agent
+// tool calls with OpenTelemetry. Spans follow the GenAI semantic conventions,
+// so tools which understand them can show model, token usage and tool names.
+// https://opentelemetry.io/docs/specs/semconv/gen-ai/
+//
+// Instrumentation uses the global TracerProvider, which does nothing until
+// Setup is called.
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/parakeet-nest/parakeet/llm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of spans created by this package.
+const ScopeName = "github.com/codefromthecrypt/practical-genai-go/telemetry"
+
+// Attribute keys from the GenAI, database and server semantic conventions.
+const (
+	OperationName          = attribute.Key("gen_ai.operation.name")
+	System                 = attribute.Key("gen_ai.system")
+	RequestModel           = attribute.Key("gen_ai.request.model")
+	RequestTemperature     = attribute.Key("gen_ai.request.temperature")
+	RequestTopP            = attribute.Key("gen_ai.request.top_p")
+	RequestTopK            = attribute.Key("gen_ai.request.top_k")
+	RequestSeed            = attribute.Key("gen_ai.request.seed")
+	RequestMaxTokens       = attribute.Key("gen_ai.request.max_tokens")
+	RequestStopSequences   = attribute.Key("gen_ai.request.stop_sequences")
+	ResponseID             = attribute.Key("gen_ai.response.id")
+	ResponseModel          = attribute.Key("gen_ai.response.model")
+	ResponseFinishReasons  = attribute.Key("gen_ai.response.finish_reasons")
+	UsageInputTokens       = attribute.Key("gen_ai.usage.input_tokens")
+	UsageOutputTokens      = attribute.Key("gen_ai.usage.output_tokens")
+	ToolName               = attribute.Key("gen_ai.tool.name")
+	ServerAddress          = attribute.Key("server.address")
+	ServerPort             = attribute.Key("server.port")
+	DBSystem               = attribute.Key("db.system")
+	DBOperationName        = attribute.Key("db.operation.name")
+	DBCollectionName       = attribute.Key("db.collection.name")
+	DBResponseReturnedRows = attribute.Key("db.response.returned_rows")
+)
+
+// Tracer returns the tracer of this package, for example to start a span
+// that parents all the calls of a demo.
+func Tracer() trace.Tracer {
+	return otel.Tracer(ScopeName)
+}
+
+// StartChat starts a span for a chat completion with an LLM at baseURL.
+// Finish it with EndChat or EndOpenAIChat.
+func StartChat(ctx context.Context, system, baseURL, model string, options llm.Options) (context.Context, trace.Span) {
+	attrs := append(serverAttributes(baseURL),
+		OperationName.String("chat"),
+		System.String(system),
+		RequestModel.String(model),
+		RequestTemperature.Float64(options.Temperature),
+	)
+	if options.TopP != 0 {
+		attrs = append(attrs, RequestTopP.Float64(options.TopP))
+	}
+	if options.TopK != 0 {
+		attrs = append(attrs, RequestTopK.Int(options.TopK))
+	}
+	if options.Seed != 0 {
+		attrs = append(attrs, RequestSeed.Int(options.Seed))
+	}
+	if options.NumPredict > 0 {
+		attrs = append(attrs, RequestMaxTokens.Int(options.NumPredict))
+	}
+	if len(options.Stop) > 0 {
+		attrs = append(attrs, RequestStopSequences.StringSlice(options.Stop))
+	}
+	return Tracer().Start(ctx, "chat "+model,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// EndChat records the answer of an Ollama chat, and ends the span.
+func EndChat(span trace.Span, answer llm.Answer, err error) {
+	if err == nil {
+		finishReason := "stop"
+		if len(answer.Message.ToolCalls) > 0 {
+			finishReason = "tool_calls"
+		}
+		span.SetAttributes(
+			ResponseModel.String(answer.Model),
+			ResponseFinishReasons.StringSlice([]string{finishReason}),
+			UsageInputTokens.Int(int(answer.PromptEvalCount)),
+			UsageOutputTokens.Int(int(answer.EvalCount)),
+		)
+	}
+	End(span, err)
+}
+
+// EndOpenAIChat records the answer of an OpenAI chat, and ends the span.
+func EndOpenAIChat(span trace.Span, answer llm.OpenAIAnswer, err error) {
+	if err == nil {
+		var finishReasons []string
+		for _, c := range answer.Choices {
+			if c.FinishReason != "" {
+				finishReasons = append(finishReasons, c.FinishReason)
+			}
+		}
+		span.SetAttributes(
+			ResponseID.String(answer.ID),
+			ResponseModel.String(answer.Model),
+			ResponseFinishReasons.StringSlice(finishReasons),
+		)
+		// Streams only include usage when requested, so don't record zero.
+		if answer.Usage.TotalTokens > 0 {
+			span.SetAttributes(
+				UsageInputTokens.Int(int(answer.Usage.PromptTokens)),
+				UsageOutputTokens.Int(int(answer.Usage.CompletionTokens)),
+			)
+		}
+	}
+	End(span, err)
+}
+
+// StartEmbeddings starts a span for creating an embedding. Finish it with End.
+func StartEmbeddings(ctx context.Context, system, baseURL, model string) (context.Context, trace.Span) {
+	attrs := append(serverAttributes(baseURL),
+		OperationName.String("embeddings"),
+		System.String(system),
+		RequestModel.String(model),
+	)
+	return Tracer().Start(ctx, "embeddings "+model,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// StartSearch starts a span for a similarity search in a vector database,
+// such as "elasticsearch". Finish it with End.
+func StartSearch(ctx context.Context, dbSystem, collection string) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, "search "+collection,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			DBSystem.String(dbSystem),
+			DBOperationName.String("search"),
+			DBCollectionName.String(collection),
+		))
+}
+
+// StartAgent starts a span for an agent request, which parents its chat and
+// tool spans. Finish it with End.
+func StartAgent(ctx context.Context, model string) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, "invoke_agent",
+		trace.WithAttributes(OperationName.String("invoke_agent"), RequestModel.String(model)))
+}
+
+// StartTool starts a span for a tool the LLM asked to call. Finish it with
+// End.
+func StartTool(ctx context.Context, name string) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, "execute_tool "+name,
+		trace.WithAttributes(OperationName.String("execute_tool"), ToolName.String(name)))
+}
+
+// End records any error, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(attribute.String("error.type", fmt.Sprintf("%T", err)))
+	}
+	span.End()
+}
+
+// serverAttributes returns the host and port of baseURL.
+func serverAttributes(baseURL string) []attribute.KeyValue {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+	attrs := []attribute.KeyValue{ServerAddress.String(u.Hostname())}
+	if port, err := strconv.Atoi(u.Port()); err == nil {
+		attrs = append(attrs, ServerPort.Int(port))
+	}
+	return attrs
+}
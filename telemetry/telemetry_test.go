@@ -0,0 +1,181 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/parakeet-nest/parakeet/llm"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans makes the global TracerProvider record spans until the test
+// ends.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestChat(t *testing.T) {
+	recorder := recordSpans(t)
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"model":"qwen2.5:14b","message":{"role":"assistant","content":"",` +
+			`"tool_calls":[{"function":{"name":"shell","arguments":{"command":"ls"}}}]},` +
+			`"done":true,"prompt_eval_count":42,"eval_count":7}`))
+	}))
+	defer ollama.Close()
+
+	_, err := Chat(context.Background(), ollama.URL, llm.Query{
+		Model:   "qwen2.5:14b",
+		Options: llm.Options{Temperature: 0, Seed: 42},
+	})
+	require.NoError(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, "chat qwen2.5:14b", spans[0].Name())
+	require.Equal(t, trace.SpanKindClient, spans[0].SpanKind())
+
+	attrs := attributes(spans[0])
+	require.Equal(t, "chat", attrs[OperationName].AsString())
+	require.Equal(t, "ollama", attrs[System].AsString())
+	require.Equal(t, "127.0.0.1", attrs[ServerAddress].AsString())
+	require.Contains(t, attrs, ServerPort)
+	require.Equal(t, "qwen2.5:14b", attrs[RequestModel].AsString())
+	require.Equal(t, 0.0, attrs[RequestTemperature].AsFloat64())
+	require.Equal(t, int64(42), attrs[RequestSeed].AsInt64())
+	require.Equal(t, "qwen2.5:14b", attrs[ResponseModel].AsString())
+	require.Equal(t, []string{"tool_calls"}, attrs[ResponseFinishReasons].AsStringSlice())
+	require.Equal(t, int64(42), attrs[UsageInputTokens].AsInt64())
+	require.Equal(t, int64(7), attrs[UsageOutputTokens].AsInt64())
+}
+
+func TestChat_error(t *testing.T) {
+	recorder := recordSpans(t)
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ollama.Close()
+
+	_, err := Chat(context.Background(), ollama.URL, llm.Query{Model: "qwen2.5:14b"})
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, codes.Error, spans[0].Status().Code)
+	require.Equal(t, err.Error(), spans[0].Status().Description)
+	require.NotContains(t, attributes(spans[0]), ResponseModel)
+}
+
+func TestChatWithOpenAIStream(t *testing.T) {
+	recorder := recordSpans(t)
+	openai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"id":"chatcmpl-1","model":"qwen2.5:14b","choices":[{"delta":{"role":"assistant","content":"Hel"}}]}` + "\n\n"))
+		w.Write([]byte(`data: {"id":"chatcmpl-1","model":"qwen2.5:14b","choices":[{"delta":{"content":"lo"},"finish_reason":"stop"}]}` + "\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer openai.Close()
+
+	var content string
+	_, err := ChatWithOpenAIStream(context.Background(), openai.URL, llm.OpenAIQuery{Model: "qwen2.5:14b"},
+		func(answer llm.OpenAIAnswer) error {
+			content += answer.Choices[0].Delta.Content
+			return nil
+		})
+	require.NoError(t, err)
+	require.Equal(t, "Hello", content)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	attrs := attributes(spans[0])
+	require.Equal(t, "openai", attrs[System].AsString())
+	require.Equal(t, "chatcmpl-1", attrs[ResponseID].AsString())
+	require.Equal(t, []string{"stop"}, attrs[ResponseFinishReasons].AsStringSlice())
+	require.NotContains(t, attrs, UsageInputTokens)
+}
+
+type fakeStore struct{ err error }
+
+func (s fakeStore) SearchTopNSimilarities(llm.VectorRecord, int) ([]llm.VectorRecord, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return []llm.VectorRecord{{Id: "1"}, {Id: "2"}}, nil
+}
+
+func TestSearchTopNSimilarities(t *testing.T) {
+	recorder := recordSpans(t)
+
+	ctx, parent := Tracer().Start(context.Background(), "rag")
+	_, err := SearchTopNSimilarities(ctx, "elasticsearch", "golang-index", fakeStore{}, llm.VectorRecord{}, 5)
+	require.NoError(t, err)
+	_, err = SearchTopNSimilarities(ctx, "elasticsearch", "golang-index", fakeStore{errors.New("down")}, llm.VectorRecord{}, 5)
+	require.EqualError(t, err, "down")
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	for _, span := range spans[:2] {
+		require.Equal(t, "search golang-index", span.Name())
+		require.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+	}
+	attrs := attributes(spans[0])
+	require.Equal(t, "elasticsearch", attrs[DBSystem].AsString())
+	require.Equal(t, "golang-index", attrs[DBCollectionName].AsString())
+	require.Equal(t, int64(2), attrs[DBResponseReturnedRows].AsInt64())
+	require.Equal(t, codes.Error, spans[1].Status().Code)
+}
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		name, exporter, endpoint string
+		expected                 string
+		err                      string
+	}{
+		{name: "default", expected: "none"},
+		{name: "endpoint", endpoint: "http://localhost:4318", expected: "otlp"},
+		{name: "console", exporter: "console", expected: "console"},
+		{name: "none overrides endpoint", exporter: "none", endpoint: "http://localhost:4318", expected: "none"},
+		{name: "unsupported", exporter: "zipkin", err: "unsupported OTEL_TRACES_EXPORTER: zipkin"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("OTEL_TRACES_EXPORTER", tc.exporter)
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", tc.endpoint)
+			t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+			previous := otel.GetTracerProvider()
+			t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+			shutdown, err := Setup(context.Background(), "test")
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, exporterName())
+			require.NoError(t, shutdown(context.Background()))
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Package usage accounts for the tokens and time spent by LLM calls, tools
+// and embeddings, so demos can show what a request cost.
+package usage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// Usage is the resources used by a request or a session. The zero value is
+// ready to use. Usage is not safe for concurrent use.
+type Usage struct {
+	// LLMCalls is the count of round-trips to the LLM.
+	LLMCalls int `json:"llm_calls"`
+	// PromptTokens is the count of tokens read by the LLM, across all calls.
+	PromptTokens int `json:"prompt_tokens"`
+	// CompletionTokens is the count of tokens generated by the LLM.
+	CompletionTokens int `json:"completion_tokens"`
+	// LLMDuration is the time waiting for the LLM, including network.
+	LLMDuration time.Duration `json:"llm_duration"`
+	// PromptEvalDuration is the time Ollama spent reading prompts.
+	PromptEvalDuration time.Duration `json:"prompt_eval_duration"`
+	// EvalDuration is the time Ollama spent generating tokens.
+	EvalDuration time.Duration `json:"eval_duration"`
+	// ToolCalls is the count of tools run, and ToolErrors those that failed.
+	ToolCalls  int `json:"tool_calls"`
+	ToolErrors int `json:"tool_errors"`
+	// ToolDuration is the time running tools.
+	ToolDuration time.Duration `json:"tool_duration"`
+	// Embeddings is the count of embeddings created.
+	Embeddings int `json:"embeddings"`
+	// EmbeddingDuration is the time creating embeddings.
+	EmbeddingDuration time.Duration `json:"embedding_duration"`
+	// Duration is the wall time of the request, or of all requests in a
+	// session.
+	Duration time.Duration `json:"duration"`
+}
+
+// TotalTokens is the sum of prompt and completion tokens.
+func (u *Usage) TotalTokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// TokensPerSecond is the rate Ollama generated tokens, or zero if unknown.
+func (u *Usage) TokensPerSecond() float64 {
+	if u.EvalDuration <= 0 {
+		return 0
+	}
+	return float64(u.CompletionTokens) / u.EvalDuration.Seconds()
+}
+
+// AddAnswer adds an Ollama chat answer which took d to receive.
+func (u *Usage) AddAnswer(answer llm.Answer, d time.Duration) {
+	u.LLMCalls++
+	u.LLMDuration += d
+	u.PromptTokens += int(answer.PromptEvalCount)
+	u.CompletionTokens += int(answer.EvalCount)
+	// Ollama reports durations in nanoseconds.
+	u.PromptEvalDuration += time.Duration(answer.PromptEvalDuration)
+	u.EvalDuration += time.Duration(answer.EvalDuration)
+}
+
+// AddOpenAIAnswer adds an OpenAI chat answer which took d to receive. Streams
+// only include token counts when requested, so these may be zero.
+func (u *Usage) AddOpenAIAnswer(answer llm.OpenAIAnswer, d time.Duration) {
+	u.LLMCalls++
+	u.LLMDuration += d
+	u.PromptTokens += int(answer.Usage.PromptTokens)
+	u.CompletionTokens += int(answer.Usage.CompletionTokens)
+}
+
+// AddTool adds a tool call which took d, and failed if err is not nil.
+func (u *Usage) AddTool(d time.Duration, err error) {
+	u.ToolCalls++
+	u.ToolDuration += d
+	if err != nil {
+		u.ToolErrors++
+	}
+}
+
+// AddEmbedding adds an embedding which took d to create.
+func (u *Usage) AddEmbedding(d time.Duration) {
+	u.Embeddings++
+	u.EmbeddingDuration += d
+}
+
+// Add adds other, for example to add a request to its session.
+func (u *Usage) Add(other Usage) {
+	u.LLMCalls += other.LLMCalls
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.LLMDuration += other.LLMDuration
+	u.PromptEvalDuration += other.PromptEvalDuration
+	u.EvalDuration += other.EvalDuration
+	u.ToolCalls += other.ToolCalls
+	u.ToolErrors += other.ToolErrors
+	u.ToolDuration += other.ToolDuration
+	u.Embeddings += other.Embeddings
+	u.EmbeddingDuration += other.EmbeddingDuration
+	u.Duration += other.Duration
+}
+
+// String summarizes the usage in one line, omitting what wasn't used. For
+// example, "2 LLM calls in 3.1s: 1200 prompt + 80 completion tokens (25.0
+// tokens/s), 1 tool call in 12ms, total 3.2s".
+func (u Usage) String() string {
+	var parts []string
+	if u.Embeddings > 0 {
+		parts = append(parts, fmt.Sprintf("%s in %s",
+			plural(u.Embeddings, "embedding"), round(u.EmbeddingDuration)))
+	}
+	if u.LLMCalls > 0 {
+		s := fmt.Sprintf("%s in %s", plural(u.LLMCalls, "LLM call"), round(u.LLMDuration))
+		if u.TotalTokens() > 0 {
+			s += fmt.Sprintf(": %d prompt + %d completion tokens", u.PromptTokens, u.CompletionTokens)
+		}
+		if tps := u.TokensPerSecond(); tps > 0 {
+			s += fmt.Sprintf(" (%.1f tokens/s)", tps)
+		}
+		parts = append(parts, s)
+	}
+	if u.ToolCalls > 0 {
+		s := fmt.Sprintf("%s in %s", plural(u.ToolCalls, "tool call"), round(u.ToolDuration))
+		if u.ToolErrors > 0 {
+			s += fmt.Sprintf(" (%d failed)", u.ToolErrors)
+		}
+		parts = append(parts, s)
+	}
+	if u.Duration > 0 {
+		parts = append(parts, "total "+round(u.Duration).String())
+	}
+	if len(parts) == 0 {
+		return "nothing used"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// round makes durations readable, without hiding fast calls.
+func round(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(100 * time.Millisecond)
+}
@@ -0,0 +1,70 @@
+package usage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/parakeet-nest/parakeet/llm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsage(t *testing.T) {
+	var u Usage
+	u.AddAnswer(llm.Answer{
+		PromptEvalCount:    1000,
+		EvalCount:          50,
+		PromptEvalDuration: int64(time.Second),
+		EvalDuration:       int64(2 * time.Second),
+	}, 3*time.Second)
+	u.AddTool(10*time.Millisecond, nil)
+	u.AddTool(2*time.Millisecond, errors.New("exit status 1"))
+
+	var openai llm.OpenAIAnswer
+	openai.Usage.PromptTokens = 200
+	openai.Usage.CompletionTokens = 30
+	u.AddOpenAIAnswer(openai, 100*time.Millisecond)
+	u.Duration = 3200 * time.Millisecond
+
+	require.Equal(t, 2, u.LLMCalls)
+	require.Equal(t, 1280, u.TotalTokens())
+	require.Equal(t, 40.0, u.TokensPerSecond())
+	require.Equal(t, "2 LLM calls in 3.1s: 1200 prompt + 80 completion tokens (40.0 tokens/s), "+
+		"2 tool calls in 12ms (1 failed), total 3.2s", u.String())
+
+	t.Run("add", func(t *testing.T) {
+		var session Usage
+		session.Add(u)
+		session.Add(u)
+		require.Equal(t, 4, session.LLMCalls)
+		require.Equal(t, 2*u.TotalTokens(), session.TotalTokens())
+		require.Equal(t, 2, session.ToolErrors)
+		require.Equal(t, 2*u.Duration, session.Duration)
+	})
+}
+
+func TestUsage_String(t *testing.T) {
+	tests := []struct {
+		name     string
+		usage    Usage
+		expected string
+	}{
+		{name: "zero", expected: "nothing used"},
+		{
+			name:     "embedding",
+			usage:    Usage{Embeddings: 1, EmbeddingDuration: 45 * time.Millisecond},
+			expected: "1 embedding in 45ms",
+		},
+		{
+			name:     "no token counts",
+			usage:    Usage{LLMCalls: 1, LLMDuration: 1234 * time.Millisecond},
+			expected: "1 LLM call in 1.2s",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, tc.usage.String())
+		})
+	}
+}